@@ -3,16 +3,23 @@ package api
 import (
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/aragon/ovote-node/censusbuilder"
+	"github.com/aragon/ovote-node/prover"
 	"github.com/aragon/ovote-node/types"
 	"github.com/aragon/ovote-node/votesaggregator"
 	"github.com/gin-gonic/gin"
+	"github.com/iden3/go-iden3-crypto/babyjub"
 	"go.vocdoni.io/dvote/log"
 )
 
+// maxVotesPerBatch is the maximum number of votes accepted in a request to the
+// votes batch endpoint
+const maxVotesPerBatch = 10000
+
 // API allows external requests to the Node
 type API struct {
 	r  *gin.Engine
@@ -40,14 +47,23 @@ func New(censusBuilder *censusbuilder.CensusBuilder,
 		r.POST("/census/:censusid", a.postAddKeys)
 		r.POST("/census/:censusid/close", a.postCloseCensus)
 		r.GET("/census/:censusid/merkleproof/:pubkey", a.getMerkleProofHandler)
+		r.GET("/census/:censusid/snapshot", a.getSnapshots)
+		r.POST("/census/:censusid/snapshot/:name", a.postNewSnapshot)
+		r.GET("/census/:censusid/snapshot/:name", a.getSnapshot)
+		r.GET("/census/:censusid/snapshot/:name/merkleproof/:pubkey",
+			a.getSnapshotMerkleProofHandler)
 	}
 
 	if votesAggregator != nil {
 		a.va = votesAggregator
 		r.POST("/process/:processid", a.postVote)
+		r.POST("/process/:processid/votes", a.postVotes)
 		r.GET("/process/:processid", a.getProcess)
+		r.GET("/process/:processid/receipt/:pubkey", a.getReceipt)
+		r.GET("/process/:processid/vote/:pubkey", a.getVoteStatus)
 		r.POST("/proof/:processid", a.postGenProof)
 		r.GET("/proof/:processid", a.getProof)
+		r.POST("/proof/:processid/callback", a.postProofCallback)
 	}
 
 	a.r = r
@@ -55,31 +71,29 @@ func New(censusBuilder *censusbuilder.CensusBuilder,
 	return &a, nil
 }
 
+// Handler returns the http.Handler of the API, to serve it from a custom
+// http.Server
+func (a *API) Handler() http.Handler {
+	return a.r
+}
+
 // Serve serves the API at the given port
 func (a *API) Serve(port string) error {
 	return a.r.Run(":" + port)
 }
 
-type errorMsg struct {
-	Message string `json:"message"`
-}
-
-func returnErr(c *gin.Context, err error) {
-	log.Warnw("HTTP API Bad request error", "err", err)
-	c.JSON(http.StatusBadRequest, errorMsg{
-		Message: err.Error(),
-	})
-}
-
 func (a *API) postNewCensus(c *gin.Context) {
-	var d newCensusReq
+	var d NewCensusReq
 	err := c.ShouldBindJSON(&d)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 
-	censusID, err := a.cb.NewCensus()
+	if d.MaxLevels == 0 {
+		d.MaxLevels = a.cb.NLevels()
+	}
+	censusID, err := a.cb.NewCensus(d.MaxLevels)
 	if err != nil {
 		returnErr(c, err)
 		return
@@ -96,15 +110,15 @@ func (a *API) postAddKeys(c *gin.Context) {
 	censusIDStr := c.Param("censusid")
 	censusIDInt, err := strconv.Atoi(censusIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	censusID := uint64(censusIDInt)
 
-	var d newCensusReq
+	var d NewCensusReq
 	err = c.ShouldBindJSON(&d)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 
@@ -117,7 +131,7 @@ func (a *API) postCloseCensus(c *gin.Context) {
 	censusIDStr := c.Param("censusid")
 	censusIDInt, err := strconv.Atoi(censusIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	censusID := uint64(censusIDInt)
@@ -139,7 +153,7 @@ func (a *API) getCensus(c *gin.Context) {
 	censusIDStr := c.Param("censusid")
 	censusID, err := strconv.Atoi(censusIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	censusInfo, err := a.cb.CensusInfo(uint64(censusID))
@@ -154,14 +168,14 @@ func (a *API) getMerkleProofHandler(c *gin.Context) {
 	censusIDStr := c.Param("censusid")
 	censusIDInt, err := strconv.Atoi(censusIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	censusID := uint64(censusIDInt)
 
 	pubK, err := types.HexToPublicKey(c.Param("pubkey"))
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 
@@ -182,19 +196,110 @@ func (a *API) getMerkleProofHandler(c *gin.Context) {
 		types.CensusProof{Index: index, MerkleProof: proof})
 }
 
+func (a *API) postNewSnapshot(c *gin.Context) {
+	censusIDStr := c.Param("censusid")
+	censusIDInt, err := strconv.Atoi(censusIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	censusID := uint64(censusIDInt)
+
+	snapshot, err := a.cb.NewSnapshot(censusID, c.Param("name"))
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (a *API) getSnapshot(c *gin.Context) {
+	censusIDStr := c.Param("censusid")
+	censusIDInt, err := strconv.Atoi(censusIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	censusID := uint64(censusIDInt)
+
+	snapshot, err := a.cb.GetSnapshot(censusID, c.Param("name"))
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (a *API) getSnapshots(c *gin.Context) {
+	censusIDStr := c.Param("censusid")
+	censusIDInt, err := strconv.Atoi(censusIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	censusID := uint64(censusIDInt)
+
+	snapshots, err := a.cb.Snapshots(censusID)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
+}
+
+func (a *API) getSnapshotMerkleProofHandler(c *gin.Context) {
+	censusIDStr := c.Param("censusid")
+	censusIDInt, err := strconv.Atoi(censusIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	censusID := uint64(censusIDInt)
+
+	pubK, err := types.HexToPublicKey(c.Param("pubkey"))
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	// get MerkleProof against the Snapshot root
+	index, proof, err := a.cb.GetSnapshotProof(censusID, c.Param("name"), pubK)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	// PublicKey not returned, as is already known by the user
+	c.JSON(http.StatusOK,
+		types.CensusProof{Index: index, MerkleProof: proof})
+}
+
 func (a *API) postVote(c *gin.Context) {
 	processIDStr := c.Param("processid")
 	processIDInt, err := strconv.Atoi(processIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	processID := uint64(processIDInt)
 
+	// the VotePackage can be sent in json or in the compact CBOR encoding
 	var vote types.VotePackage
-	err = c.ShouldBindJSON(&vote)
+	if c.ContentType() == types.VotePackageCBORContentType {
+		var b []byte
+		b, err = ioutil.ReadAll(c.Request.Body)
+		if err == nil {
+			err = vote.UnmarshalCBOR(b)
+		}
+	} else {
+		err = c.ShouldBindJSON(&vote)
+	}
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
+		return
+	}
+	hash, err := vote.Hash()
+	if err != nil {
+		invalidRequest(c, err)
 		return
 	}
 
@@ -204,14 +309,55 @@ func (a *API) postVote(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, VoteResp{VotePackageHash: hash})
+}
+
+// postVotes adds a batch of votes, used by the relayers that collect the votes
+// of multiple users
+func (a *API) postVotes(c *gin.Context) {
+	processIDStr := c.Param("processid")
+	processIDInt, err := strconv.Atoi(processIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	processID := uint64(processIDInt)
+
+	// the VotePackages can be sent in a json array or in a CBOR array
+	var votes []types.VotePackage
+	if c.ContentType() == types.VotePackageCBORContentType {
+		var b []byte
+		b, err = ioutil.ReadAll(c.Request.Body)
+		if err == nil {
+			votes, err = types.UnmarshalVotePackagesCBOR(b)
+		}
+	} else {
+		err = c.ShouldBindJSON(&votes)
+	}
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	if len(votes) == 0 || len(votes) > maxVotesPerBatch {
+		invalidRequest(c, fmt.Errorf("invalid number of votes: %d, expected"+
+			" between 1 and %d", len(votes), maxVotesPerBatch))
+		return
+	}
+
+	results, err := a.va.AddVotes(processID, votes)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, VotesResp{Results: results})
 }
 
 func (a *API) getProcess(c *gin.Context) {
 	processIDStr := c.Param("processid")
 	processID, err := strconv.Atoi(processIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	processInfo, err := a.va.ProcessInfo(uint64(processID))
@@ -222,13 +368,86 @@ func (a *API) getProcess(c *gin.Context) {
 	c.JSON(http.StatusOK, processInfo)
 }
 
-func (a *API) postGenProof(c *gin.Context) {
+func (a *API) getReceipt(c *gin.Context) {
+	processIDStr := c.Param("processid")
+	processIDInt, err := strconv.Atoi(processIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	processID := uint64(processIDInt)
+
+	pubK, err := types.HexToPublicKey(c.Param("pubkey"))
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	receipt, err := a.va.GetReceipt(processID, pubK)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, receipt)
+}
+
+func (a *API) getVoteStatus(c *gin.Context) {
 	processIDStr := c.Param("processid")
 	processIDInt, err := strconv.Atoi(processIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	processID := uint64(processIDInt)
+
+	pubK, err := types.HexToPublicKey(c.Param("pubkey"))
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+
+	// optional signature of the PublicKey over
+	// types.HashVoteStatusRequest, in hex, with the unix timestamp used in
+	// the signed message
+	var sig *babyjub.SignatureComp
+	var timestamp uint64
+	if sigHex := c.Query("signature"); sigHex != "" {
+		sigBytes, err := hex.DecodeString(sigHex)
+		if err != nil {
+			invalidRequest(c, err)
+			return
+		}
+		var sigComp babyjub.SignatureComp
+		if len(sigBytes) != len(sigComp) {
+			invalidRequest(c, fmt.Errorf("unexpected signature length: %d",
+				len(sigBytes)))
+			return
+		}
+		copy(sigComp[:], sigBytes)
+		sig = &sigComp
+
+		timestamp, err = strconv.ParseUint(c.Query("timestamp"), 10, 64)
+		if err != nil {
+			invalidRequest(c, fmt.Errorf("invalid timestamp: %w", err))
+			return
+		}
+	}
+
+	voteStatus, err := a.va.VoteStatus(processID, pubK, sig, timestamp)
 	if err != nil {
 		returnErr(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, voteStatus)
+}
+
+func (a *API) postGenProof(c *gin.Context) {
+	processIDStr := c.Param("processid")
+	processIDInt, err := strconv.Atoi(processIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
 	processID := uint64(processIDInt)
 
 	// trigger proof generation
@@ -245,17 +464,75 @@ func (a *API) getProof(c *gin.Context) {
 	processIDStr := c.Param("processid")
 	processIDInt, err := strconv.Atoi(processIDStr)
 	if err != nil {
-		returnErr(c, err)
+		invalidRequest(c, err)
 		return
 	}
 	processID := uint64(processIDInt)
 
 	// return proof if ready, if not return message saying that is not
 	// generated yet
-	proof, err := a.va.GetProof(processID)
+	proofInDB, err := a.va.GetProof(processID)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	proof, err := types.ParseProof(proofInDB.Proof)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	publicInputs, err := types.ParsePublicInputs(proofInDB.PublicInputs)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+
+	switch format := c.Query("format"); format {
+	case "", "json":
+		resp := ProofResp{
+			ProcessID:          processID,
+			ProofID:            proofInDB.ProofID,
+			Prover:             proofInDB.Prover,
+			Proof:              proof,
+			InsertedDatetime:   proofInDB.InsertedDatetime,
+			ProofAddedDatetime: proofInDB.ProofAddedDatetime,
+		}
+		for i := 0; i < len(publicInputs); i++ {
+			resp.PublicInputs = append(resp.PublicInputs,
+				publicInputs[i].String())
+		}
+		c.JSON(http.StatusOK, resp)
+	case "calldata":
+		calldata, err := proof.ResultCalldata(publicInputs)
+		if err != nil {
+			returnErr(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, calldata)
+	default:
+		invalidRequest(c, fmt.Errorf("unknown proof format %q", format))
+	}
+}
+
+func (a *API) postProofCallback(c *gin.Context) {
+	processIDStr := c.Param("processid")
+	processIDInt, err := strconv.Atoi(processIDStr)
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	processID := uint64(processIDInt)
+
+	body, err := c.GetRawData()
+	if err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	err = a.va.ProofCallback(processID, body,
+		c.GetHeader(prover.CallbackSignatureHeader))
 	if err != nil {
 		returnErr(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, proof)
+	c.JSON(http.StatusOK, "proof stored")
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/aragon/ovote-node/census"
 	"github.com/aragon/ovote-node/censusbuilder"
 	"github.com/aragon/ovote-node/db"
+	"github.com/aragon/ovote-node/prover"
 	"github.com/aragon/ovote-node/test"
 	"github.com/aragon/ovote-node/types"
 	"github.com/aragon/ovote-node/votesaggregator"
@@ -35,7 +36,9 @@ func newTestAPI(c *qt.C, chainID uint64) (API, *db.SQLite) {
 	opts := kvdb.Options{Path: c.TempDir()}
 	database, err := pebbledb.New(opts)
 	c.Assert(err, qt.IsNil)
-	cb, err := censusbuilder.New(database, c.TempDir())
+	// the censuses can have more levels than the circuit of the
+	// VotesAggregator, which checks the size of the census of each process
+	cb, err := censusbuilder.New(database, c.TempDir(), 16)
 	c.Assert(err, qt.IsNil)
 	r := gin.Default()
 
@@ -47,14 +50,29 @@ func newTestAPI(c *qt.C, chainID uint64) (API, *db.SQLite) {
 	err = sqlite.Migrate()
 	c.Assert(err, qt.IsNil)
 
-	va, err := votesaggregator.New(sqlite, chainID, nil)
+	receiptsDB, err := pebbledb.New(kvdb.Options{Path: c.TempDir()})
+	c.Assert(err, qt.IsNil)
+	va, err := votesaggregator.New(votesaggregator.Options{
+		SQLite:          sqlite,
+		ReceiptsDB:      receiptsDB,
+		ChainID:         chainID,
+		Circuit:         types.ZKCircuitMeta{NMaxVotes: 128, NLevels: 7},
+		VerificationKey: testVerificationKey(c),
+	})
 	c.Assert(err, qt.IsNil)
 
 	return API{r: r, cb: cb, va: va}, sqlite
 }
 
+// testVerificationKey returns a random VerificationKey
+func testVerificationKey(c *qt.C) *prover.VerificationKey {
+	vk, err := prover.ParseVerificationKey(test.GenGroth16(c, nil).VerificationKey)
+	c.Assert(err, qt.IsNil)
+	return vk
+}
+
 func doPostNewCensus(c *qt.C, a API, pubKs []babyjub.PublicKey, weights []*big.Int) uint64 {
-	reqData := newCensusReq{PublicKeys: pubKs, Weights: weights}
+	reqData := NewCensusReq{PublicKeys: pubKs, Weights: weights}
 	jsonReqData, err := json.Marshal(reqData)
 	c.Assert(err, qt.IsNil)
 
@@ -75,7 +93,7 @@ func doPostNewCensus(c *qt.C, a API, pubKs []babyjub.PublicKey, weights []*big.I
 
 func doPostAddKeys(c *qt.C, a API, censusID uint64, pubKs []babyjub.PublicKey, weights []*big.Int) {
 	censusIDStr := strconv.Itoa(int(censusID))
-	reqData := newCensusReq{PublicKeys: pubKs, Weights: weights}
+	reqData := NewCensusReq{PublicKeys: pubKs, Weights: weights}
 	jsonReqData, err := json.Marshal(reqData)
 	c.Assert(err, qt.IsNil)
 	req, err := http.NewRequest("POST", "/census/"+censusIDStr, bytes.NewBuffer(jsonReqData))
@@ -122,21 +140,31 @@ func doGetProof(c *qt.C, a API, censusID uint64, pubK babyjub.PublicKey) types.C
 	return cp
 }
 
-func doPostVote(c *qt.C, a API, processID uint64, vote types.VotePackage) {
-	processIDStr := strconv.Itoa(int(processID))
+func doPostVote(c *qt.C, a API, processID uint64, vote types.VotePackage) []byte {
 	jsonReqData, err := json.Marshal(vote)
 	c.Assert(err, qt.IsNil)
-	req, err := http.NewRequest("POST", "/process/"+processIDStr, bytes.NewBuffer(jsonReqData))
+	return doPostVoteBytes(c, a, processID, "application/json", jsonReqData)
+}
+
+func doPostVoteBytes(c *qt.C, a API, processID uint64, contentType string,
+	reqData []byte) []byte {
+	processIDStr := strconv.Itoa(int(processID))
+	req, err := http.NewRequest("POST", "/process/"+processIDStr, bytes.NewBuffer(reqData))
 	c.Assert(err, qt.IsNil)
+	req.Header.Set("Content-Type", contentType)
 	w := httptest.NewRecorder()
 	a.r.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
 		fmt.Println("doPostVote Error:", w.Code, w.Body)
 	}
 	c.Assert(w.Code, qt.Equals, http.StatusOK)
+	var resp VoteResp
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	c.Assert(err, qt.IsNil)
+	return resp.VotePackageHash
 }
 
-func doGetProcess(c *qt.C, a API, processID uint64) types.Process {
+func doGetProcess(c *qt.C, a API, processID uint64) types.ProcessInfo {
 	processIDStr := strconv.Itoa(int(processID))
 
 	req, err := http.NewRequest("GET", "/process/"+processIDStr, nil)
@@ -147,7 +175,7 @@ func doGetProcess(c *qt.C, a API, processID uint64) types.Process {
 
 	body, err := ioutil.ReadAll(w.Body)
 	c.Assert(err, qt.IsNil)
-	var process types.Process
+	var process types.ProcessInfo
 	err = json.Unmarshal(body, &process)
 	c.Assert(err, qt.IsNil)
 	return process
@@ -291,6 +319,9 @@ func TestGetProcessInfo(t *testing.T) {
 
 	process := doGetProcess(c, a, processID)
 	c.Assert(process.Status, qt.Equals, types.ProcessStatusOn)
+	c.Assert(process.NVotes, qt.Equals, uint64(0))
+	c.Assert(process.MinParticipationReached, qt.IsFalse)
+	c.Assert(process.Result.Int64(), qt.Equals, int64(0))
 
 	err = sqlite.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
 	c.Assert(err, qt.IsNil)
@@ -299,6 +330,76 @@ func TestGetProcessInfo(t *testing.T) {
 	c.Assert(process.Status, qt.Equals, types.ProcessStatusFrozen)
 }
 
+func TestGetProofFormats(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, sqlite := newTestAPI(c, chainID)
+	a.r.GET("/proof/:processid", a.getProof)
+
+	processID := uint64(123)
+	err := sqlite.StoreProcess(processID, []byte("testroot"), 100,
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+	// chainID, processID, censusRoot, receiptsRoot, nVotes, result,
+	// withReceipts
+	publicInputs := []*big.Int{big.NewInt(3), big.NewInt(123), big.NewInt(11),
+		big.NewInt(12), big.NewInt(20), big.NewInt(15), big.NewInt(1)}
+	g := test.GenGroth16(c, publicInputs)
+	err = sqlite.StoreProofID(processID, 1, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.AddProofToProofID(processID, 1, "prover0", g.Proof,
+		g.PublicInputs)
+	c.Assert(err, qt.IsNil)
+
+	doGet := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET",
+			fmt.Sprintf("/proof/%d%s", processID, query), nil)
+		a.r.ServeHTTP(w, req)
+		return w
+	}
+
+	// default & json formats
+	expected, err := types.ParseProof(g.Proof)
+	c.Assert(err, qt.IsNil)
+	expectedProof, err := json.Marshal(expected)
+	c.Assert(err, qt.IsNil)
+	for _, query := range []string{"", "?format=json"} {
+		w := doGet(query)
+		c.Assert(w.Code, qt.Equals, 200, qt.Commentf("%s", w.Body.String()))
+		var resp ProofResp
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resp.ProcessID, qt.Equals, processID)
+		c.Assert(resp.ProofID, qt.Equals, uint64(1))
+		c.Assert(resp.Prover, qt.Equals, "prover0")
+		respProof, err := json.Marshal(resp.Proof)
+		c.Assert(err, qt.IsNil)
+		c.Assert(respProof, qt.DeepEquals, expectedProof)
+		c.Assert(resp.PublicInputs, qt.DeepEquals,
+			[]string{"3", "123", "11", "12", "20", "15", "1"})
+	}
+
+	// calldata format
+	w := doGet("?format=calldata")
+	c.Assert(w.Code, qt.Equals, 200, qt.Commentf("%s", w.Body.String()))
+	var cd types.ResultCalldata
+	err = json.Unmarshal(w.Body.Bytes(), &cd)
+	c.Assert(err, qt.IsNil)
+	expectedCalldata, err := expected.ResultCalldata(publicInputs)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cd, qt.DeepEquals, *expectedCalldata)
+	c.Assert(cd.ProcessID, qt.Equals, processID)
+	c.Assert(cd.Result, qt.Equals, uint64(15))
+	c.Assert(cd.NVotes, qt.Equals, uint64(20))
+
+	// unknown format
+	w = doGet("?format=abc")
+	c.Assert(w.Code, qt.Equals, 400)
+	c.Assert(w.Body.String(), qt.Contains, "unknown proof format")
+}
+
 func TestBuildCensusAndPostVoteHandler(t *testing.T) {
 	c := qt.New(t)
 
@@ -424,6 +525,382 @@ func TestPostVoteHandler(t *testing.T) {
 	var msg errorMsg
 	err = json.Unmarshal(body, &msg)
 	c.Assert(err, qt.IsNil)
+	c.Assert(w.Code, qt.Equals, http.StatusConflict)
+	c.Assert(msg.Code, qt.Equals, ErrCodeVotingClosed)
 	c.Assert(msg.Message, qt.Equals,
 		"process ResPubStartBlock (20) reached, votes can not be added")
 }
+
+func TestPostVoteCBORHandler(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, sqlite := newTestAPI(c, chainID)
+	a.r.POST("/process/:processid", a.postVote)
+	a.r.GET("/process/:processid", a.getProcess)
+
+	nKeys := 10
+	keys := test.GenUserKeys(nKeys)
+	cens := test.GenCensus(c, keys)
+	err := cens.Census.Close()
+	c.Assert(err, qt.IsNil)
+	censusRoot, err := cens.Census.Root()
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	votes := test.GenVotes(c, cens, chainID, processID, 60)
+	err = sqlite.StoreProcess(processID, censusRoot, uint64(nKeys),
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+
+	// cast the votes in CBOR, the response contains the VotePackage hash
+	for i := 0; i < nKeys; i++ {
+		b, err := votes[i].MarshalCBOR()
+		c.Assert(err, qt.IsNil)
+		hash := doPostVoteBytes(c, a, processID,
+			types.VotePackageCBORContentType, b)
+		expected, err := votes[i].Hash()
+		c.Assert(err, qt.IsNil)
+		c.Assert(hash, qt.DeepEquals, expected)
+	}
+
+	// sending again a vote, in any encoding, returns the same hash without
+	// storing it twice
+	b, err := votes[0].MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+	hashCBOR := doPostVoteBytes(c, a, processID,
+		types.VotePackageCBORContentType, b)
+	hashJSON := doPostVote(c, a, processID, votes[0])
+	c.Assert(hashJSON, qt.DeepEquals, hashCBOR)
+	process := doGetProcess(c, a, processID)
+	c.Assert(process.NVotes, qt.Equals, uint64(nKeys))
+
+	// the CBOR VotePackage must be in canonical encoding
+	req, err := http.NewRequest("POST", "/process/123",
+		bytes.NewBuffer(append(b, 0)))
+	c.Assert(err, qt.IsNil)
+	req.Header.Set("Content-Type", types.VotePackageCBORContentType)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), qt.Contains, "not in canonical CBOR encoding")
+}
+
+func doPostVotes(c *qt.C, a API, processID uint64, contentType string,
+	reqData []byte) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", fmt.Sprintf("/process/%d/votes", processID),
+		bytes.NewBuffer(reqData))
+	c.Assert(err, qt.IsNil)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostVotesHandler(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, sqlite := newTestAPI(c, chainID)
+	a.r.POST("/process/:processid/votes", a.postVotes)
+	a.r.GET("/process/:processid", a.getProcess)
+
+	nKeys := 10
+	keys := test.GenUserKeys(nKeys)
+	cens := test.GenCensus(c, keys)
+	err := cens.Census.Close()
+	c.Assert(err, qt.IsNil)
+	censusRoot, err := cens.Census.Root()
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	votes := test.GenVotes(c, cens, chainID, processID, 60)
+	err = sqlite.StoreProcess(processID, censusRoot, uint64(nKeys),
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+
+	// send the votes in a json batch, with an invalid signature in the
+	// first one
+	invalid := votes[0]
+	invalid.Vote = []byte("invalidvotecontent")
+	jsonReqData, err := json.Marshal(append([]types.VotePackage{invalid},
+		votes[1:]...))
+	c.Assert(err, qt.IsNil)
+	w := doPostVotes(c, a, processID, "application/json", jsonReqData)
+	c.Assert(w.Code, qt.Equals, http.StatusOK, qt.Commentf("%s", w.Body))
+	var resp VotesResp
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(resp.Results), qt.Equals, nKeys)
+	c.Assert(resp.Results[0].Stored, qt.IsFalse)
+	c.Assert(resp.Results[0].Code, qt.Equals, types.VoteErrInvalidSignature)
+	for i := 1; i < nKeys; i++ {
+		c.Assert(resp.Results[i].Stored, qt.IsTrue)
+		hash, err := votes[i].Hash()
+		c.Assert(err, qt.IsNil)
+		c.Assert([]byte(resp.Results[i].VotePackageHash), qt.DeepEquals, hash)
+	}
+	process := doGetProcess(c, a, processID)
+	c.Assert(process.NVotes, qt.Equals, uint64(nKeys-1))
+
+	// send all the votes in a CBOR batch, only the missing one is stored
+	cborReqData := []byte{0x80 + byte(nKeys)} // array header
+	for i := 0; i < nKeys; i++ {
+		b, err := votes[i].MarshalCBOR()
+		c.Assert(err, qt.IsNil)
+		cborReqData = append(cborReqData, b...)
+	}
+	w = doPostVotes(c, a, processID, types.VotePackageCBORContentType, cborReqData)
+	c.Assert(w.Code, qt.Equals, http.StatusOK, qt.Commentf("%s", w.Body))
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	c.Assert(err, qt.IsNil)
+	for i := 0; i < nKeys; i++ {
+		c.Assert(resp.Results[i].Stored, qt.IsTrue)
+	}
+	process = doGetProcess(c, a, processID)
+	c.Assert(process.NVotes, qt.Equals, uint64(nKeys))
+
+	// empty batch
+	w = doPostVotes(c, a, processID, "application/json", []byte("[]"))
+	c.Assert(w.Code, qt.Equals, http.StatusBadRequest)
+	c.Assert(w.Body.String(), qt.Contains, "invalid number of votes: 0")
+}
+
+func doPostNewSnapshot(c *qt.C, a API, censusID uint64, name string) census.Snapshot {
+	censusIDStr := strconv.Itoa(int(censusID))
+	req, err := http.NewRequest("POST", "/census/"+censusIDStr+"/snapshot/"+name, nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	body, err := ioutil.ReadAll(w.Body)
+	c.Assert(err, qt.IsNil)
+	var snapshot census.Snapshot
+	err = json.Unmarshal(body, &snapshot)
+	c.Assert(err, qt.IsNil)
+	return snapshot
+}
+
+func doGetSnapshotProof(c *qt.C, a API, censusID uint64, name string,
+	pubK babyjub.PublicKey) types.CensusProof {
+	censusIDStr := strconv.Itoa(int(censusID))
+	pubKComp := pubK.Compress()
+	pubKHex := hex.EncodeToString(pubKComp[:])
+
+	req, err := http.NewRequest("GET",
+		"/census/"+censusIDStr+"/snapshot/"+name+"/merkleproof/"+pubKHex, nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	body, err := ioutil.ReadAll(w.Body)
+	c.Assert(err, qt.IsNil)
+	var cp types.CensusProof
+	err = json.Unmarshal(body, &cp)
+	c.Assert(err, qt.IsNil)
+	return cp
+}
+
+func TestSnapshotHandlers(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, _ := newTestAPI(c, chainID)
+	a.r.POST("/census", a.postNewCensus)
+	a.r.POST("/census/:censusid", a.postAddKeys)
+	a.r.GET("/census/:censusid/snapshot", a.getSnapshots)
+	a.r.POST("/census/:censusid/snapshot/:name", a.postNewSnapshot)
+	a.r.GET("/census/:censusid/snapshot/:name", a.getSnapshot)
+	a.r.GET("/census/:censusid/snapshot/:name/merkleproof/:pubkey",
+		a.getSnapshotMerkleProofHandler)
+
+	nKeys := 20
+	keys := test.GenUserKeys(nKeys)
+
+	censusID := doPostNewCensus(c, a, keys.PublicKeys[:10], keys.Weights[:10])
+	time.Sleep(1 * time.Second)
+	snapshot := doPostNewSnapshot(c, a, censusID, "first")
+	c.Assert(snapshot.Size, qt.Equals, uint64(10))
+
+	// add more keys to the still open census
+	doPostAddKeys(c, a, censusID, keys.PublicKeys[10:], keys.Weights[10:])
+	time.Sleep(1 * time.Second)
+	_ = doPostNewSnapshot(c, a, censusID, "second")
+
+	// proofs against the first snapshot are valid for its root
+	for i := 0; i < 10; i++ {
+		cp := doGetSnapshotProof(c, a, censusID, "first", keys.PublicKeys[i])
+		v, err := census.CheckProof(snapshot.Root, cp.MerkleProof, cp.Index,
+			&keys.PublicKeys[i], keys.Weights[i])
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.IsTrue)
+	}
+
+	req, err := http.NewRequest("GET", "/census/"+strconv.Itoa(int(censusID))+"/snapshot", nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+	var snapshots []census.Snapshot
+	err = json.Unmarshal(w.Body.Bytes(), &snapshots)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(snapshots), qt.Equals, 2)
+	c.Assert(snapshots[1].Size, qt.Equals, uint64(nKeys))
+}
+
+func TestPostNewCensusWithMaxLevels(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, _ := newTestAPI(c, chainID)
+	a.r.POST("/census", a.postNewCensus)
+	a.r.GET("/census/:censusid", a.getCensus)
+
+	doPost := func(maxLevels int) *httptest.ResponseRecorder {
+		keys := test.GenUserKeys(10)
+		reqData := NewCensusReq{PublicKeys: keys.PublicKeys,
+			Weights: keys.Weights, MaxLevels: maxLevels}
+		jsonReqData, err := json.Marshal(reqData)
+		c.Assert(err, qt.IsNil)
+		req, err := http.NewRequest("POST", "/census",
+			bytes.NewBuffer(jsonReqData))
+		c.Assert(err, qt.IsNil)
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		return w
+	}
+	getInfo := func(w *httptest.ResponseRecorder) census.Info {
+		c.Assert(w.Code, qt.Equals, http.StatusOK)
+		var censusID uint64
+		err := json.Unmarshal(w.Body.Bytes(), &censusID)
+		c.Assert(err, qt.IsNil)
+
+		time.Sleep(1 * time.Second)
+
+		req, err := http.NewRequest("GET", "/census/"+strconv.Itoa(int(censusID)), nil)
+		c.Assert(err, qt.IsNil)
+		w = httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		c.Assert(w.Code, qt.Equals, http.StatusOK)
+		var info census.Info
+		err = json.Unmarshal(w.Body.Bytes(), &info)
+		c.Assert(err, qt.IsNil)
+		return info
+	}
+
+	// the 10 keys do not fit in a census of 3 levels, expect the error to
+	// be stored
+	info := getInfo(doPost(3))
+	c.Assert(info.MaxLevels, qt.Equals, 3)
+	c.Assert(info.Size, qt.Equals, uint64(0))
+	c.Assert(info.ErrMsg, qt.Matches, census.ErrMaxNLeafsReached.Error()+".*")
+
+	// the circuit nLevels is used when it is not set
+	info = getInfo(doPost(0))
+	c.Assert(info.MaxLevels, qt.Equals, 16)
+	c.Assert(info.Size, qt.Equals, uint64(10))
+
+	// the census MaxLevels can not exceed the circuit nLevels
+	w := doPost(17)
+	c.Assert(w.Code, qt.Equals, http.StatusUnprocessableEntity)
+	var msg errorMsg
+	err := json.Unmarshal(w.Body.Bytes(), &msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg.Code, qt.Equals, ErrCodeInvalidMaxLevels)
+}
+
+func doGetVoteStatus(c *qt.C, a API, processID uint64, pubK babyjub.PublicKey,
+	sig *babyjub.SignatureComp, timestamp uint64) (int, []byte) {
+	processIDStr := strconv.Itoa(int(processID))
+	pubKComp := pubK.Compress()
+	url := "/process/" + processIDStr + "/vote/" + hex.EncodeToString(pubKComp[:])
+	if sig != nil {
+		url += "?signature=" + hex.EncodeToString(sig[:]) +
+			"&timestamp=" + strconv.FormatUint(timestamp, 10)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	return w.Code, w.Body.Bytes()
+}
+
+func TestGetVoteStatusHandler(t *testing.T) {
+	c := qt.New(t)
+
+	chainID := uint64(3)
+	a, sqlite := newTestAPI(c, chainID)
+	a.r.POST("/process/:processid", a.postVote)
+	a.r.GET("/process/:processid/vote/:pubkey", a.getVoteStatus)
+
+	nKeys := 2
+	keys := test.GenUserKeys(nKeys)
+	cens := test.GenCensus(c, keys)
+	err := cens.Census.Close()
+	c.Assert(err, qt.IsNil)
+	censusRoot, err := cens.Census.Root()
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	votes := test.GenVotes(c, cens, chainID, processID, 60)
+	err = sqlite.StoreProcess(processID, censusRoot, uint64(nKeys),
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+
+	doPostVote(c, a, processID, votes[0])
+
+	// get the status of the vote, signing the request
+	timestamp := uint64(time.Now().Unix())
+	msg, err := types.HashVoteStatusRequest(chainID, processID,
+		&keys.PublicKeys[0], timestamp)
+	c.Assert(err, qt.IsNil)
+	sig := keys.PrivateKeys[0].SignPoseidon(msg).Compress()
+	code, body := doGetVoteStatus(c, a, processID, keys.PublicKeys[0], &sig,
+		timestamp)
+	c.Assert(code, qt.Equals, http.StatusOK)
+	var status types.VoteStatus
+	err = json.Unmarshal(body, &status)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsTrue)
+	voteHash, err := types.HashVote(chainID, processID, votes[0].Vote)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.VoteHash.String(), qt.Equals, voteHash.String())
+
+	// the second key has not voted yet
+	code, body = doGetVoteStatus(c, a, processID, keys.PublicKeys[1], nil, 0)
+	c.Assert(code, qt.Equals, http.StatusOK)
+	status = types.VoteStatus{}
+	err = json.Unmarshal(body, &status)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsFalse)
+
+	// a signature from another key is rejected
+	code, _ = doGetVoteStatus(c, a, processID, keys.PublicKeys[1], &sig,
+		timestamp)
+	c.Assert(code, qt.Equals, http.StatusUnauthorized)
+
+	// the signature is bound to its timestamp, which can not be too old
+	code, _ = doGetVoteStatus(c, a, processID, keys.PublicKeys[0], &sig,
+		timestamp+1)
+	c.Assert(code, qt.Equals, http.StatusUnauthorized)
+	oldTimestamp := timestamp - 3600
+	msg, err = types.HashVoteStatusRequest(chainID, processID,
+		&keys.PublicKeys[0], oldTimestamp)
+	c.Assert(err, qt.IsNil)
+	oldSig := keys.PrivateKeys[0].SignPoseidon(msg).Compress()
+	code, _ = doGetVoteStatus(c, a, processID, keys.PublicKeys[0], &oldSig,
+		oldTimestamp)
+	c.Assert(code, qt.Equals, http.StatusUnauthorized)
+
+	// a signature that is not a compressed point is a bad request
+	var malformedSig babyjub.SignatureComp
+	for i := 0; i < len(malformedSig); i++ {
+		malformedSig[i] = 0xff
+	}
+	code, body = doGetVoteStatus(c, a, processID, keys.PublicKeys[0],
+		&malformedSig, timestamp)
+	c.Assert(code, qt.Equals, http.StatusBadRequest)
+	c.Assert(string(body), qt.Contains, "malformed signature")
+}
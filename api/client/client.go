@@ -0,0 +1,332 @@
+// Package client implements the http client of the ovote-node API, used to
+// manage the censuses, send the votes and retrieve the proofs of the processes
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aragon/ovote-node/api"
+	"github.com/aragon/ovote-node/census"
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+)
+
+// Client implements the ovote-node http client
+type Client struct {
+	url string
+	c   *http.Client
+}
+
+// New returns a new Client for the given nodeURL
+func New(nodeURL string) *Client {
+	return &Client{
+		url: nodeURL,
+		c:   &http.Client{},
+	}
+}
+
+// Error is the error returned by the node API, the Code identifies the error
+// and the StatusCode is the http status of the response
+type Error struct {
+	StatusCode int           `json:"-"`
+	Code       api.ErrorCode `json:"code"`
+	Message    string        `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// ErrorCode returns the api.ErrorCode of the given error, or an empty code if
+// the error was not returned by the node API
+func ErrorCode(err error) api.ErrorCode {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// do sends a request with the given json body (nil if none) to the given path
+// of the node, and decodes the json response into resp (if not nil). The
+// responses with an error status are returned as *Error.
+func (c *Client) do(method, path string, body, resp interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.send(req, resp)
+}
+
+func (c *Client) send(req *http.Request, resp interface{}) error {
+	httpResp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close() //nolint:errcheck
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: httpResp.StatusCode}
+		if err = json.Unmarshal(respBody, apiErr); err != nil ||
+			apiErr.Message == "" {
+			apiErr.Message = fmt.Sprintf("unexpected status code %d",
+				httpResp.StatusCode)
+		}
+		return apiErr
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, resp)
+}
+
+func pubKHex(pubK *babyjub.PublicKey) string {
+	pubKComp := pubK.Compress()
+	return hex.EncodeToString(pubKComp[:])
+}
+
+func censusPath(censusID uint64) string {
+	return "/census/" + strconv.FormatUint(censusID, 10)
+}
+
+func processPath(processID uint64) string {
+	return "/process/" + strconv.FormatUint(processID, 10)
+}
+
+func proofPath(processID uint64) string {
+	return "/proof/" + strconv.FormatUint(processID, 10)
+}
+
+// NewCensus creates a new Census with the given maxLevels (types.MaxLevels if
+// 0), and adds to it the given PublicKeys & weights. The keys are added
+// asynchronously by the node, CensusInfo returns the result.
+func (c *Client) NewCensus(maxLevels int, pubKs []babyjub.PublicKey,
+	weights []*big.Int) (uint64, error) {
+	req := api.NewCensusReq{
+		PublicKeys: pubKs,
+		Weights:    weights,
+		MaxLevels:  maxLevels,
+	}
+	var censusID uint64
+	if err := c.do(http.MethodPost, "/census", req, &censusID); err != nil {
+		return 0, err
+	}
+	return censusID, nil
+}
+
+// AddKeys adds the given PublicKeys & weights to the given Census. The keys
+// are added asynchronously by the node, CensusInfo returns the result.
+func (c *Client) AddKeys(censusID uint64, pubKs []babyjub.PublicKey,
+	weights []*big.Int) error {
+	req := api.NewCensusReq{PublicKeys: pubKs, Weights: weights}
+	return c.do(http.MethodPost, censusPath(censusID), req, nil)
+}
+
+// CloseCensus closes the given Census, and returns its root
+func (c *Client) CloseCensus(censusID uint64) ([]byte, error) {
+	var rootHex string
+	err := c.do(http.MethodPost, censusPath(censusID)+"/close", nil, &rootHex)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(rootHex)
+}
+
+// CensusInfo returns the census.Info of the given Census
+func (c *Client) CensusInfo(censusID uint64) (*census.Info, error) {
+	var info census.Info
+	if err := c.do(http.MethodGet, censusPath(censusID), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CensusProof returns the MerkleProof of the given PublicKey in the given
+// closed Census. The returned CensusProof only contains the Index and the
+// MerkleProof.
+func (c *Client) CensusProof(censusID uint64,
+	pubK *babyjub.PublicKey) (*types.CensusProof, error) {
+	var proof types.CensusProof
+	err := c.do(http.MethodGet, censusPath(censusID)+"/merkleproof/"+
+		pubKHex(pubK), nil, &proof)
+	if err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// NewSnapshot stores a Snapshot with the given name of the current state of
+// the given Census
+func (c *Client) NewSnapshot(censusID uint64, name string) (*census.Snapshot, error) {
+	var snapshot census.Snapshot
+	err := c.do(http.MethodPost, censusPath(censusID)+"/snapshot/"+
+		url.PathEscape(name), nil, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Snapshot returns the Snapshot with the given name of the given Census
+func (c *Client) Snapshot(censusID uint64, name string) (*census.Snapshot, error) {
+	var snapshot census.Snapshot
+	err := c.do(http.MethodGet, censusPath(censusID)+"/snapshot/"+
+		url.PathEscape(name), nil, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Snapshots returns the Snapshots of the given Census
+func (c *Client) Snapshots(censusID uint64) ([]census.Snapshot, error) {
+	var snapshots []census.Snapshot
+	err := c.do(http.MethodGet, censusPath(censusID)+"/snapshot", nil,
+		&snapshots)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// SnapshotProof returns the MerkleProof of the given PublicKey against the
+// root of the given Snapshot
+func (c *Client) SnapshotProof(censusID uint64, name string,
+	pubK *babyjub.PublicKey) (*types.CensusProof, error) {
+	var proof types.CensusProof
+	err := c.do(http.MethodGet, censusPath(censusID)+"/snapshot/"+
+		url.PathEscape(name)+"/merkleproof/"+pubKHex(pubK), nil, &proof)
+	if err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// PostVote sends the given VotePackage to the given process, and returns the
+// VotePackage hash, which identifies the vote
+func (c *Client) PostVote(processID uint64, vote *types.VotePackage) ([]byte, error) {
+	var resp api.VoteResp
+	if err := c.do(http.MethodPost, processPath(processID), vote, &resp); err != nil {
+		return nil, err
+	}
+	return resp.VotePackageHash, nil
+}
+
+// PostVotes sends the given batch of VotePackages to the given process, and
+// returns the result of each vote
+func (c *Client) PostVotes(processID uint64,
+	votes []types.VotePackage) ([]types.VoteResult, error) {
+	var resp api.VotesResp
+	err := c.do(http.MethodPost, processPath(processID)+"/votes", votes, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// Process returns the types.ProcessInfo of the given process
+func (c *Client) Process(processID uint64) (*types.ProcessInfo, error) {
+	var info types.ProcessInfo
+	if err := c.do(http.MethodGet, processPath(processID), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Receipt returns the proof of inclusion of the vote of the given PublicKey
+// in the receipts tree of the given process
+func (c *Client) Receipt(processID uint64,
+	pubK *babyjub.PublicKey) (*types.ReceiptProof, error) {
+	var receipt types.ReceiptProof
+	err := c.do(http.MethodGet, processPath(processID)+"/receipt/"+
+		pubKHex(pubK), nil, &receipt)
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// VoteStatus returns the status of the vote of the given PublicKey in the
+// given process. The signature of types.HashVoteStatusRequest, with the given
+// timestamp, is only required if the node has VoteStatusAuth enabled,
+// otherwise it can be nil.
+func (c *Client) VoteStatus(processID uint64, pubK *babyjub.PublicKey,
+	sig *babyjub.SignatureComp, timestamp uint64) (*types.VoteStatus, error) {
+	path := processPath(processID) + "/vote/" + pubKHex(pubK)
+	if sig != nil {
+		path += "?signature=" + hex.EncodeToString(sig[:]) +
+			"&timestamp=" + strconv.FormatUint(timestamp, 10)
+	}
+	var status types.VoteStatus
+	if err := c.do(http.MethodGet, path, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GenProof triggers the proof generation of the given process
+func (c *Client) GenProof(processID uint64) error {
+	return c.do(http.MethodPost, proofPath(processID), nil, nil)
+}
+
+// Proof returns the proof of the given process, with its public inputs
+func (c *Client) Proof(processID uint64) (*api.ProofResp, error) {
+	var proof api.ProofResp
+	if err := c.do(http.MethodGet, proofPath(processID), nil, &proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// ProofCalldata returns the calldata of the OVOTE contract call that
+// publishes the result of the given process with its proof
+func (c *Client) ProofCalldata(processID uint64) (*types.ResultCalldata, error) {
+	var calldata types.ResultCalldata
+	err := c.do(http.MethodGet, proofPath(processID)+"?format=calldata", nil,
+		&calldata)
+	if err != nil {
+		return nil, err
+	}
+	return &calldata, nil
+}
+
+// ProofCallback sends the given proof completion callback body, signed with
+// the CallbackSecret shared with the node, as done by the prover-server
+func (c *Client) ProofCallback(processID uint64, body []byte, secret []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url+proofPath(processID)+
+		"/callback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(prover.CallbackSignatureHeader,
+		prover.SignCallback(secret, body))
+	return c.send(req, nil)
+}
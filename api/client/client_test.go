@@ -0,0 +1,309 @@
+package client
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/api"
+	"github.com/aragon/ovote-node/censusbuilder"
+	"github.com/aragon/ovote-node/db"
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
+	"github.com/aragon/ovote-node/votesaggregator"
+	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/vocdoni/arbo"
+	kvdb "go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/pebbledb"
+)
+
+const chainID = uint64(3)
+
+// newTestAPI returns an api.API with both the CensusBuilder and the
+// VotesAggregator, and the db of its VotesAggregator
+func newTestAPI(c *qt.C) (*api.API, *db.SQLite) {
+	database, err := pebbledb.New(kvdb.Options{Path: c.TempDir()})
+	c.Assert(err, qt.IsNil)
+	cb, err := censusbuilder.New(database, c.TempDir(), 7)
+	c.Assert(err, qt.IsNil)
+
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+	sqlite := db.NewSQLite(sqlDB)
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	receiptsDB, err := pebbledb.New(kvdb.Options{Path: c.TempDir()})
+	c.Assert(err, qt.IsNil)
+	verificationKey, err := prover.ParseVerificationKey(
+		test.GenGroth16(c, nil).VerificationKey)
+	c.Assert(err, qt.IsNil)
+	va, err := votesaggregator.New(votesaggregator.Options{
+		SQLite:          sqlite,
+		ReceiptsDB:      receiptsDB,
+		ChainID:         chainID,
+		Circuit:         types.ZKCircuitMeta{NMaxVotes: 128, NLevels: 7},
+		VerificationKey: verificationKey,
+		// the prover-server is not reachable
+		Provers: prover.NewPool(prover.NewClient("http://127.0.0.1:0")),
+	})
+	c.Assert(err, qt.IsNil)
+
+	a, err := api.New(cb, va)
+	c.Assert(err, qt.IsNil)
+	return a, sqlite
+}
+
+// newTestNode serves an in-process api.API, returning a Client to it and the
+// db of its VotesAggregator, used to add the processes
+func newTestNode(c *qt.C) (*Client, *db.SQLite) {
+	a, sqlite := newTestAPI(c)
+	ts := httptest.NewServer(a.Handler())
+	c.Cleanup(ts.Close)
+	return New(ts.URL), sqlite
+}
+
+func assertErrorCode(c *qt.C, err error, status int, code api.ErrorCode) {
+	apiErr, ok := err.(*Error)
+	c.Assert(ok, qt.IsTrue, qt.Commentf("%v", err))
+	c.Assert(apiErr.StatusCode, qt.Equals, status)
+	c.Assert(apiErr.Code, qt.Equals, code)
+	c.Assert(ErrorCode(err), qt.Equals, code)
+}
+
+func TestCensus(t *testing.T) {
+	c := qt.New(t)
+	cl, _ := newTestNode(c)
+
+	nKeys := 10
+	keys := test.GenUserKeys(nKeys)
+	censusID, err := cl.NewCensus(7, keys.PublicKeys[:5], keys.Weights[:5])
+	c.Assert(err, qt.IsNil)
+	err = cl.AddKeys(censusID, keys.PublicKeys[5:], keys.Weights[5:])
+	c.Assert(err, qt.IsNil)
+	// the keys are added asynchronously
+	waitCensusSize(c, cl, censusID, uint64(nKeys))
+
+	info, err := cl.CensusInfo(censusID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Closed, qt.IsFalse)
+	c.Assert(info.MaxLevels, qt.Equals, 7)
+
+	// the MerkleProofs are only available once the census is closed
+	_, err = cl.CensusProof(censusID, &keys.PublicKeys[0])
+	assertErrorCode(c, err, http.StatusConflict, api.ErrCodeCensusNotClosed)
+
+	snapshot, err := cl.NewSnapshot(censusID, "first")
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot.Size, qt.Equals, uint64(nKeys))
+	_, err = cl.NewSnapshot(censusID, "first")
+	assertErrorCode(c, err, http.StatusConflict, api.ErrCodeSnapshotExists)
+	snapshot2, err := cl.Snapshot(censusID, "first")
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot2.Root, qt.DeepEquals, snapshot.Root)
+	snapshots, err := cl.Snapshots(censusID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(snapshots), qt.Equals, 1)
+	proof, err := cl.SnapshotProof(censusID, "first", &keys.PublicKeys[3])
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Index, qt.Equals, uint64(3))
+	_, err = cl.Snapshot(censusID, "second")
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeSnapshotNotFound)
+
+	root, err := cl.CloseCensus(censusID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(root, qt.DeepEquals, snapshot.Root)
+	_, err = cl.CloseCensus(censusID)
+	assertErrorCode(c, err, http.StatusConflict, api.ErrCodeCensusClosed)
+
+	proof, err = cl.CensusProof(censusID, &keys.PublicKeys[3])
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Index, qt.Equals, uint64(3))
+	c.Assert(proof.MerkleProof, qt.Not(qt.HasLen), 0)
+
+	_, err = cl.CensusInfo(censusID + 1)
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeCensusNotFound)
+}
+
+func waitCensusSize(c *qt.C, cl *Client, censusID, size uint64) {
+	for i := 0; i < 100; i++ {
+		info, err := cl.CensusInfo(censusID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(info.ErrMsg, qt.Equals, "")
+		if info.Size == size {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("census size %d not reached", size)
+}
+
+func TestVoterFlow(t *testing.T) {
+	c := qt.New(t)
+	cl, sqlite := newTestNode(c)
+
+	nKeys := 4
+	keys := test.GenUserKeys(nKeys)
+	censusID, err := cl.NewCensus(7, keys.PublicKeys, keys.Weights)
+	c.Assert(err, qt.IsNil)
+	waitCensusSize(c, cl, censusID, uint64(nKeys))
+	censusRoot, err := cl.CloseCensus(censusID)
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	err = sqlite.StoreProcess(processID, censusRoot, uint64(nKeys),
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+
+	voteBytes := arbo.BigIntToBytes(arbo.HashFunctionPoseidon.Len(),
+		big.NewInt(1))
+
+	// the first key votes with the whole voter flow
+	hash, err := cl.Vote(chainID, processID, censusID, &keys.PrivateKeys[0],
+		keys.Weights[0], voteBytes)
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash, qt.HasLen, 32)
+
+	status, err := cl.SignedVoteStatus(chainID, processID, &keys.PrivateKeys[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsTrue)
+	c.Assert([]byte(status.VotePackageHash), qt.DeepEquals, hash)
+	voteHash, err := types.HashVote(chainID, processID, voteBytes)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.VoteHash.String(), qt.Equals, voteHash.String())
+	status, err = cl.VoteStatus(processID, &keys.PublicKeys[1], nil, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsFalse)
+
+	// a vote signed for another process is rejected
+	vote, err := cl.BuildVote(chainID, processID+1, censusID,
+		&keys.PrivateKeys[1], keys.Weights[1], voteBytes)
+	c.Assert(err, qt.IsNil)
+	_, err = cl.PostVote(processID, vote)
+	assertErrorCode(c, err, http.StatusUnprocessableEntity,
+		api.ErrCodeInvalidSignature)
+
+	// the rest of the keys vote in a batch, together with the first vote
+	var votes []types.VotePackage
+	for i := 0; i < nKeys; i++ {
+		vote, err := cl.BuildVote(chainID, processID, censusID,
+			&keys.PrivateKeys[i], keys.Weights[i], voteBytes)
+		c.Assert(err, qt.IsNil)
+		votes = append(votes, *vote)
+	}
+	results, err := cl.PostVotes(processID, votes)
+	c.Assert(err, qt.IsNil)
+	c.Assert(results, qt.HasLen, nKeys)
+	for i := 0; i < nKeys; i++ {
+		c.Assert(results[i].Stored, qt.IsTrue, qt.Commentf("%d", i))
+	}
+
+	info, err := cl.Process(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.NVotes, qt.Equals, uint64(nKeys))
+
+	_, err = cl.Process(processID + 1)
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeProcessNotFound)
+	_, err = cl.Receipt(processID, &keys.PublicKeys[0])
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeResultNotFound)
+
+	// the proof can not be generated until the node is synced, nor while
+	// the prover-server is down
+	err = cl.GenProof(processID)
+	assertErrorCode(c, err, http.StatusServiceUnavailable, api.ErrCodeNotSynced)
+	err = sqlite.InitMeta(chainID, 30)
+	c.Assert(err, qt.IsNil)
+	err = cl.GenProof(processID)
+	assertErrorCode(c, err, http.StatusServiceUnavailable,
+		api.ErrCodeProverUnavailable)
+	_, err = cl.Proof(processID)
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeProofNotFound)
+	_, err = cl.ProofCalldata(processID)
+	assertErrorCode(c, err, http.StatusNotFound, api.ErrCodeProofNotFound)
+
+	body, err := json.Marshal(map[string]interface{}{"id": 1})
+	c.Assert(err, qt.IsNil)
+	err = cl.ProofCallback(processID, body, []byte("secret"))
+	assertErrorCode(c, err, http.StatusUnauthorized, api.ErrCodeUnauthorized)
+}
+
+func TestProof(t *testing.T) {
+	c := qt.New(t)
+	cl, sqlite := newTestNode(c)
+
+	processID := uint64(123)
+	err := sqlite.StoreProcess(processID, []byte("testroot"), 100,
+		10, 20, 20, 20, 60, 1)
+	c.Assert(err, qt.IsNil)
+	// chainID, processID, censusRoot, receiptsRoot, nVotes, result,
+	// withReceipts
+	publicInputs := []*big.Int{big.NewInt(3), big.NewInt(123), big.NewInt(11),
+		big.NewInt(12), big.NewInt(20), big.NewInt(15), big.NewInt(1)}
+	g := test.GenGroth16(c, publicInputs)
+	err = sqlite.StoreProofID(processID, 1, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.AddProofToProofID(processID, 1, "prover0", g.Proof,
+		g.PublicInputs)
+	c.Assert(err, qt.IsNil)
+
+	proof, err := cl.Proof(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.ProcessID, qt.Equals, processID)
+	c.Assert(proof.ProofID, qt.Equals, uint64(1))
+	c.Assert(proof.Prover, qt.Equals, "prover0")
+	c.Assert(proof.PublicInputs, qt.DeepEquals,
+		[]string{"3", "123", "11", "12", "20", "15", "1"})
+	expected, err := types.ParseProof(g.Proof)
+	c.Assert(err, qt.IsNil)
+	respProof, err := json.Marshal(proof.Proof)
+	c.Assert(err, qt.IsNil)
+	c.Assert(respProof, qt.JSONEquals, expected)
+
+	calldata, err := cl.ProofCalldata(processID)
+	c.Assert(err, qt.IsNil)
+	expectedCalldata, err := expected.ResultCalldata(publicInputs)
+	c.Assert(err, qt.IsNil)
+	c.Assert(calldata, qt.DeepEquals, expectedCalldata)
+}
+
+// TestRoutesCovered checks that every route of the api.API has a method in
+// the Client
+func TestRoutesCovered(t *testing.T) {
+	c := qt.New(t)
+	a, _ := newTestAPI(c)
+
+	covered := map[string]string{
+		"POST /census":                                             "NewCensus",
+		"GET /census/:censusid":                                    "CensusInfo",
+		"POST /census/:censusid":                                   "AddKeys",
+		"POST /census/:censusid/close":                             "CloseCensus",
+		"GET /census/:censusid/merkleproof/:pubkey":                "CensusProof",
+		"GET /census/:censusid/snapshot":                           "Snapshots",
+		"POST /census/:censusid/snapshot/:name":                    "NewSnapshot",
+		"GET /census/:censusid/snapshot/:name":                     "Snapshot",
+		"GET /census/:censusid/snapshot/:name/merkleproof/:pubkey": "SnapshotProof",
+		"POST /process/:processid":                                 "PostVote",
+		"POST /process/:processid/votes":                           "PostVotes",
+		"GET /process/:processid":                                  "Process",
+		"GET /process/:processid/receipt/:pubkey":                  "Receipt",
+		"GET /process/:processid/vote/:pubkey":                     "VoteStatus",
+		"POST /proof/:processid":                                   "GenProof",
+		"GET /proof/:processid":                                    "Proof, ProofCalldata",
+		"POST /proof/:processid/callback":                          "ProofCallback",
+	}
+	routes := a.Handler().(*gin.Engine).Routes()
+	c.Assert(routes, qt.HasLen, len(covered))
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		_, ok := covered[key]
+		c.Assert(ok, qt.IsTrue, qt.Commentf("route %s not covered", key))
+	}
+}
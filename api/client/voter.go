@@ -0,0 +1,61 @@
+package client
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/aragon/ovote-node/types"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+)
+
+// BuildVote returns the VotePackage of the given vote value, signed by the
+// given PrivateKey following types.HashVote, with the MerkleProof of its
+// PublicKey in the given closed Census. The weight is the one of the
+// PublicKey in the Census.
+func (c *Client) BuildVote(chainID, processID, censusID uint64,
+	sk *babyjub.PrivateKey, weight *big.Int, vote []byte) (*types.VotePackage, error) {
+	pubK := sk.Public()
+	censusProof, err := c.CensusProof(censusID, pubK)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := types.HashVote(chainID, processID, vote)
+	if err != nil {
+		return nil, err
+	}
+	return &types.VotePackage{
+		Signature: sk.SignPoseidon(msg).Compress(),
+		CensusProof: types.CensusProof{
+			Index:       censusProof.Index,
+			PublicKey:   pubK,
+			Weight:      weight,
+			MerkleProof: censusProof.MerkleProof,
+		},
+		Vote: vote,
+	}, nil
+}
+
+// Vote builds the VotePackage of the given vote value as BuildVote does, and
+// sends it to the given process. It returns the VotePackage hash.
+func (c *Client) Vote(chainID, processID, censusID uint64,
+	sk *babyjub.PrivateKey, weight *big.Int, vote []byte) ([]byte, error) {
+	votePackage, err := c.BuildVote(chainID, processID, censusID, sk, weight, vote)
+	if err != nil {
+		return nil, err
+	}
+	return c.PostVote(processID, votePackage)
+}
+
+// SignedVoteStatus returns the status of the vote of the PublicKey of the
+// given PrivateKey, signing the request with it at the current time
+func (c *Client) SignedVoteStatus(chainID, processID uint64,
+	sk *babyjub.PrivateKey) (*types.VoteStatus, error) {
+	pubK := sk.Public()
+	timestamp := uint64(time.Now().Unix())
+	msg, err := types.HashVoteStatusRequest(chainID, processID, pubK, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	sig := sk.SignPoseidon(msg).Compress()
+	return c.VoteStatus(processID, pubK, &sig, timestamp)
+}
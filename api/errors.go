@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aragon/ovote-node/census"
+	"github.com/aragon/ovote-node/censusbuilder"
+	"github.com/aragon/ovote-node/db"
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
+	"github.com/aragon/ovote-node/votesaggregator"
+	"github.com/gin-gonic/gin"
+	"go.vocdoni.io/dvote/log"
+)
+
+// ErrorCode identifies the error returned by the API, so that the clients
+// can handle it without parsing the message
+type ErrorCode string
+
+const (
+	// ErrCodeInvalidRequest indicates that the request can not be parsed
+	ErrCodeInvalidRequest ErrorCode = "invalidRequest"
+	// ErrCodeInternal indicates an unexpected error of the node
+	ErrCodeInternal ErrorCode = "internalError"
+
+	// ErrCodeUnauthorized indicates that the request signature is missing
+	// or does not match
+	ErrCodeUnauthorized ErrorCode = "unauthorized"
+
+	// ErrCodeCensusNotFound indicates that the Census does not exist
+	ErrCodeCensusNotFound ErrorCode = "censusNotFound"
+	// ErrCodeSnapshotNotFound indicates that the Snapshot does not exist
+	ErrCodeSnapshotNotFound ErrorCode = "snapshotNotFound"
+	// ErrCodePublicKeyNotFound indicates that the PublicKey is not in the
+	// Census
+	ErrCodePublicKeyNotFound ErrorCode = "publicKeyNotFound"
+	// ErrCodeProcessNotFound indicates that the Process does not exist
+	ErrCodeProcessNotFound ErrorCode = "processNotFound"
+	// ErrCodeVoteNotFound indicates that the vote does not exist
+	ErrCodeVoteNotFound ErrorCode = "voteNotFound"
+	// ErrCodeResultNotFound indicates that the result of the Process has not
+	// been published yet
+	ErrCodeResultNotFound ErrorCode = "resultNotFound"
+	// ErrCodeReceiptNotFound indicates that the vote is not in the receipts
+	// tree of the Process
+	ErrCodeReceiptNotFound ErrorCode = "receiptNotFound"
+	// ErrCodeProofNotFound indicates that the proof generation of the
+	// Process has not been triggered
+	ErrCodeProofNotFound ErrorCode = "proofNotFound"
+
+	// ErrCodeCensusNotClosed indicates that the Census needs to be closed
+	ErrCodeCensusNotClosed ErrorCode = "censusNotClosed"
+	// ErrCodeCensusClosed indicates that the Census is already closed
+	ErrCodeCensusClosed ErrorCode = "censusClosed"
+	// ErrCodeSnapshotExists indicates that the Snapshot name is in use
+	ErrCodeSnapshotExists ErrorCode = "snapshotExists"
+	// ErrCodeVotingClosed indicates that the Process does not accept votes
+	ErrCodeVotingClosed ErrorCode = "votingClosed"
+	// ErrCodeVoteAlreadyStored indicates that a different vote of the same
+	// PublicKey or census index is already stored
+	ErrCodeVoteAlreadyStored ErrorCode = "voteAlreadyStored"
+	// ErrCodeResPubStartBlockNotReached indicates that the proof can not be
+	// generated until the ResPubStartBlock of the Process
+	ErrCodeResPubStartBlockNotReached ErrorCode = "resPubStartBlockNotReached"
+	// ErrCodeQuorumNotReached indicates that the votes do not reach the
+	// thresholds of the Process
+	ErrCodeQuorumNotReached ErrorCode = "quorumNotReached"
+	// ErrCodeProofNotReady indicates that the proof is being generated
+	ErrCodeProofNotReady ErrorCode = "proofNotReady"
+	// ErrCodeProofFailed indicates that the last proof attempt failed
+	ErrCodeProofFailed ErrorCode = "proofFailed"
+	// ErrCodeMaxProofAttempts indicates that no more proof attempts are
+	// allowed for the Process
+	ErrCodeMaxProofAttempts ErrorCode = "maxProofAttempts"
+	// ErrCodeProofRetryBackoff indicates that the proof generation can be
+	// retried later
+	ErrCodeProofRetryBackoff ErrorCode = "proofRetryBackoff"
+
+	// ErrCodeInvalidSignature indicates that the signature does not match
+	// the PublicKey
+	ErrCodeInvalidSignature ErrorCode = "invalidSignature"
+	// ErrCodeInvalidMerkleProof indicates that the MerkleProof does not
+	// match the CensusRoot
+	ErrCodeInvalidMerkleProof ErrorCode = "invalidMerkleProof"
+	// ErrCodeMerkleProofTooDeep indicates that the MerkleProof does not fit
+	// in the circuit
+	ErrCodeMerkleProofTooDeep ErrorCode = "merkleProofTooDeep"
+	// ErrCodeInvalidVote indicates that the VotePackage is malformed, or its
+	// values can not be counted
+	ErrCodeInvalidVote ErrorCode = "invalidVote"
+	// ErrCodeCensusFull indicates that the Census can not contain more keys
+	ErrCodeCensusFull ErrorCode = "censusFull"
+	// ErrCodeInvalidMaxLevels indicates that the Census MaxLevels is not
+	// supported
+	ErrCodeInvalidMaxLevels ErrorCode = "invalidMaxLevels"
+	// ErrCodeCircuitCapacity indicates that the Process census or votes do
+	// not fit in the circuit
+	ErrCodeCircuitCapacity ErrorCode = "circuitCapacity"
+
+	// ErrCodeVerifierBusy indicates that the votes can not be verified at
+	// the moment, and should be sent again later
+	ErrCodeVerifierBusy ErrorCode = "verifierBusy"
+
+	// ErrCodeInvalidProof indicates that the proof returned by the prover
+	// has been rejected
+	ErrCodeInvalidProof ErrorCode = "invalidProof"
+
+	// ErrCodeProverUnavailable indicates that no prover can be reached
+	ErrCodeProverUnavailable ErrorCode = "proverUnavailable"
+	// ErrCodeNotSynced indicates that the node has not synced the
+	// SmartContract yet
+	ErrCodeNotSynced ErrorCode = "notSynced"
+)
+
+// apiErrors maps the sentinel errors of the node to the status and code of
+// the API response. The errors not matched are returned as internal errors.
+var apiErrors = []struct {
+	err    error
+	status int
+	code   ErrorCode
+}{
+	{votesaggregator.ErrCallbacksDisabled, http.StatusUnauthorized, ErrCodeUnauthorized},
+	{votesaggregator.ErrInvalidCallbackSignature, http.StatusUnauthorized, ErrCodeUnauthorized},
+	{votesaggregator.ErrInvalidCallback, http.StatusUnauthorized, ErrCodeUnauthorized},
+	{votesaggregator.ErrSignatureRequired, http.StatusUnauthorized, ErrCodeUnauthorized},
+	{votesaggregator.ErrVoteStatusRequestExpired, http.StatusUnauthorized,
+		ErrCodeUnauthorized},
+	{types.ErrInvalidVoteStatusSignature, http.StatusUnauthorized, ErrCodeUnauthorized},
+
+	{types.ErrMalformedSignature, http.StatusBadRequest, ErrCodeInvalidRequest},
+
+	{censusbuilder.ErrCensusNotFound, http.StatusNotFound, ErrCodeCensusNotFound},
+	{census.ErrSnapshotNotFound, http.StatusNotFound, ErrCodeSnapshotNotFound},
+	{census.ErrPublicKeyNotFound, http.StatusNotFound, ErrCodePublicKeyNotFound},
+	{db.ErrProcessNotInDB, http.StatusNotFound, ErrCodeProcessNotFound},
+	{db.ErrVoteNotInDB, http.StatusNotFound, ErrCodeVoteNotFound},
+	{db.ErrResultNotInDB, http.StatusNotFound, ErrCodeResultNotFound},
+	{votesaggregator.ErrReceiptNotFound, http.StatusNotFound, ErrCodeReceiptNotFound},
+	{db.ErrProofNotInDB, http.StatusNotFound, ErrCodeProofNotFound},
+
+	{census.ErrCensusNotClosed, http.StatusConflict, ErrCodeCensusNotClosed},
+	{census.ErrCensusClosed, http.StatusConflict, ErrCodeCensusClosed},
+	{census.ErrCensusAlreadyClosed, http.StatusConflict, ErrCodeCensusClosed},
+	{census.ErrSnapshotExists, http.StatusConflict, ErrCodeSnapshotExists},
+	{votesaggregator.ErrVotingClosed, http.StatusConflict, ErrCodeVotingClosed},
+	{db.ErrVoteAlreadyStored, http.StatusConflict, ErrCodeVoteAlreadyStored},
+	{votesaggregator.ErrResPubStartBlockNotReached, http.StatusConflict,
+		ErrCodeResPubStartBlockNotReached},
+	{votesaggregator.ErrQuorumNotReached, http.StatusConflict, ErrCodeQuorumNotReached},
+	{prover.ErrProofNotReady, http.StatusConflict, ErrCodeProofNotReady},
+	{votesaggregator.ErrProofFailed, http.StatusConflict, ErrCodeProofFailed},
+	{prover.ErrProofFailed, http.StatusConflict, ErrCodeProofFailed},
+	{votesaggregator.ErrMaxProofAttempts, http.StatusConflict, ErrCodeMaxProofAttempts},
+	{votesaggregator.ErrProofRetryBackoff, http.StatusConflict, ErrCodeProofRetryBackoff},
+
+	{types.ErrInvalidSignature, http.StatusUnprocessableEntity, ErrCodeInvalidSignature},
+	{types.ErrInvalidMerkleProof, http.StatusUnprocessableEntity, ErrCodeInvalidMerkleProof},
+	{votesaggregator.ErrInvalidVotePackage, http.StatusUnprocessableEntity,
+		ErrCodeInvalidVote},
+	{votesaggregator.ErrMerkleProofTooDeep, http.StatusUnprocessableEntity,
+		ErrCodeMerkleProofTooDeep},
+	{votesaggregator.ErrInvalidVoteValue, http.StatusUnprocessableEntity, ErrCodeInvalidVote},
+	{census.ErrMaxNLeafsReached, http.StatusUnprocessableEntity, ErrCodeCensusFull},
+	{census.ErrInvalidMaxLevels, http.StatusUnprocessableEntity, ErrCodeInvalidMaxLevels},
+	{votesaggregator.ErrCircuitCapacity, http.StatusUnprocessableEntity,
+		ErrCodeCircuitCapacity},
+	{votesaggregator.ErrTooManyVotes, http.StatusUnprocessableEntity,
+		ErrCodeCircuitCapacity},
+
+	{votesaggregator.ErrVerifierBusy, http.StatusTooManyRequests, ErrCodeVerifierBusy},
+
+	{prover.ErrInvalidProof, http.StatusInternalServerError, ErrCodeInvalidProof},
+
+	{prover.ErrNoProverAvailable, http.StatusServiceUnavailable, ErrCodeProverUnavailable},
+	{prover.ErrProverUnavailable, http.StatusServiceUnavailable, ErrCodeProverUnavailable},
+	{db.ErrMetaNotInDB, http.StatusServiceUnavailable, ErrCodeNotSynced},
+}
+
+type errorMsg struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// errorStatus returns the status and code of the API response for the given
+// error
+func errorStatus(err error) (int, ErrorCode) {
+	for i := 0; i < len(apiErrors); i++ {
+		if errors.Is(err, apiErrors[i].err) {
+			return apiErrors[i].status, apiErrors[i].code
+		}
+	}
+	return http.StatusInternalServerError, ErrCodeInternal
+}
+
+// returnErr returns the given error with the status and code that match it
+func returnErr(c *gin.Context, err error) {
+	status, code := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		log.Warnw("HTTP API error", "status", status, "code", code, "err", err)
+	} else {
+		log.Debugw("HTTP API error", "status", status, "code", code, "err", err)
+	}
+	c.JSON(status, errorMsg{Code: code, Message: err.Error()})
+}
+
+// invalidRequest returns the given error, produced while parsing the request,
+// as a bad request
+func invalidRequest(c *gin.Context, err error) {
+	log.Debugw("HTTP API bad request", "err", err)
+	c.JSON(http.StatusBadRequest, errorMsg{
+		Code:    ErrCodeInvalidRequest,
+		Message: err.Error(),
+	})
+}
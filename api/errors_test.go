@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aragon/ovote-node/census"
+	"github.com/aragon/ovote-node/censusbuilder"
+	"github.com/aragon/ovote-node/db"
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
+	"github.com/aragon/ovote-node/votesaggregator"
+	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReturnErr(t *testing.T) {
+	c := qt.New(t)
+
+	testCases := []struct {
+		err    error
+		status int
+		code   ErrorCode
+	}{
+		{fmt.Errorf("%w, CensusID: 1", censusbuilder.ErrCensusNotFound),
+			http.StatusNotFound, ErrCodeCensusNotFound},
+		{fmt.Errorf("%w, ProcessID: 1", db.ErrProcessNotInDB),
+			http.StatusNotFound, ErrCodeProcessNotFound},
+		{census.ErrCensusNotClosed, http.StatusConflict, ErrCodeCensusNotClosed},
+		{fmt.Errorf("%w: first", census.ErrSnapshotExists),
+			http.StatusConflict, ErrCodeSnapshotExists},
+		{fmt.Errorf("%w, id: 1", prover.ErrProofNotReady),
+			http.StatusConflict, ErrCodeProofNotReady},
+		{fmt.Errorf("%w, index: 1", votesaggregator.ErrInvalidVoteValue),
+			http.StatusUnprocessableEntity, ErrCodeInvalidVote},
+		{votesaggregator.ErrVerifierBusy, http.StatusTooManyRequests,
+			ErrCodeVerifierBusy},
+		{votesaggregator.ErrInvalidCallbackSignature, http.StatusUnauthorized,
+			ErrCodeUnauthorized},
+		{types.ErrInvalidVoteStatusSignature, http.StatusUnauthorized,
+			ErrCodeUnauthorized},
+		{fmt.Errorf("%w: invalid point", types.ErrMalformedSignature),
+			http.StatusBadRequest, ErrCodeInvalidRequest},
+		{types.ErrInvalidSignature, http.StatusUnprocessableEntity,
+			ErrCodeInvalidSignature},
+		{fmt.Errorf("%w, timestamp 1 out of range", votesaggregator.ErrInvalidCallback),
+			http.StatusUnauthorized, ErrCodeUnauthorized},
+		{fmt.Errorf("%w: dial tcp", prover.ErrProverUnavailable),
+			http.StatusServiceUnavailable, ErrCodeProverUnavailable},
+		{errors.New("unexpected"), http.StatusInternalServerError,
+			ErrCodeInternal},
+	}
+
+	for _, tc := range testCases {
+		tcErr := tc.err
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			returnErr(c, tcErr)
+		})
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		c.Assert(err, qt.IsNil)
+		r.ServeHTTP(w, req)
+		c.Assert(w.Code, qt.Equals, tc.status, qt.Commentf("%s", tc.err))
+
+		var msg errorMsg
+		err = json.Unmarshal(w.Body.Bytes(), &msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(msg.Code, qt.Equals, tc.code)
+		c.Assert(msg.Message, qt.Equals, tc.err.Error())
+	}
+}
+
+func TestGetMissingResourcesHandlers(t *testing.T) {
+	c := qt.New(t)
+
+	a, _ := newTestAPI(c, 3)
+	a.r.GET("/process/:processid", a.getProcess)
+	a.r.GET("/proof/:processid", a.getProof)
+
+	doGet := func(path string) (int, ErrorCode) {
+		req, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, qt.IsNil)
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		var msg errorMsg
+		err = json.Unmarshal(w.Body.Bytes(), &msg)
+		c.Assert(err, qt.IsNil)
+		return w.Code, msg.Code
+	}
+
+	status, code := doGet("/process/abc")
+	c.Assert(status, qt.Equals, http.StatusBadRequest)
+	c.Assert(code, qt.Equals, ErrCodeInvalidRequest)
+
+	status, code = doGet("/process/123")
+	c.Assert(status, qt.Equals, http.StatusNotFound)
+	c.Assert(code, qt.Equals, ErrCodeProcessNotFound)
+
+	status, code = doGet("/proof/123")
+	c.Assert(status, qt.Equals, http.StatusNotFound)
+	c.Assert(code, qt.Equals, ErrCodeProofNotFound)
+}
@@ -2,13 +2,47 @@ package api
 
 import (
 	"math/big"
+	"time"
 
+	"github.com/aragon/ovote-node/types"
 	"github.com/iden3/go-iden3-crypto/babyjub"
 )
 
-type newCensusReq struct {
+// NewCensusReq is the request of the census endpoints, used both to create a
+// new Census and to add keys to it
+type NewCensusReq struct {
 	// babyjub.PublicKey Unmarshaler takes care of parsing hex
 	// representation of compressed PublicKeys
 	PublicKeys []babyjub.PublicKey `json:"publicKeys"`
 	Weights    []*big.Int          `json:"weights"`
+	// MaxLevels is only used when creating a new Census, and defines the
+	// maximum number of levels of the Census MerkleTree. It can not exceed
+	// the nLevels of the circuit used by the processes of the Census, which
+	// is used if it is not set.
+	MaxLevels int `json:"maxLevels,omitempty"`
+}
+
+// ProofResp is the response of the proof endpoint, with the proof
+// parsed and the public inputs as decimal strings
+type ProofResp struct {
+	ProcessID          uint64       `json:"processID"`
+	ProofID            uint64       `json:"proofID"`
+	Prover             string       `json:"prover"`
+	Proof              *types.Proof `json:"proof"`
+	PublicInputs       []string     `json:"publicInputs"`
+	InsertedDatetime   time.Time    `json:"insertedDatetime"`
+	ProofAddedDatetime time.Time    `json:"proofAddedDatetime"`
+}
+
+// VoteResp is the response of the vote endpoint, the VotePackageHash
+// identifies the vote, and can be used to send it again without storing it
+// twice
+type VoteResp struct {
+	VotePackageHash types.ByteArray `json:"votePackageHash"`
+}
+
+// VotesResp is the response of the votes batch endpoint, with the result of
+// each vote in the order in which they were sent
+type VotesResp struct {
+	Results []types.VoteResult `json:"results"`
 }
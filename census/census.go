@@ -3,9 +3,12 @@ package census
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/aragon/ovote-node/types"
 	"github.com/iden3/go-iden3-crypto/babyjub"
@@ -16,6 +19,8 @@ import (
 var (
 	dbKeyNextIndex    = []byte("nextIndex")
 	dbKeyCensusClosed = []byte("censusClosed")
+	dbKeyMaxLevels    = []byte("maxLevels")
+	dbPrefixSnapshot  = []byte("snapshot/")
 )
 
 var (
@@ -25,9 +30,25 @@ var (
 	// ErrCensusClosed is used when trying to add keys to a census and the census
 	// is already closed
 	ErrCensusClosed = errors.New("Census closed, can not add more keys")
+	// ErrCensusAlreadyClosed is used when trying to close a Census that is
+	// already closed
+	ErrCensusAlreadyClosed = errors.New("Census already closed")
+	// ErrInvalidMaxLevels is used when the MaxLevels of a Census is out of
+	// the supported range, or does not match the one of an existing Census
+	ErrInvalidMaxLevels = errors.New("invalid MaxLevels")
+	// ErrPublicKeyNotFound is used when the requested PublicKey does not
+	// exist in the Census
+	ErrPublicKeyNotFound = errors.New("publicKey does not exist in the census")
 	// ErrMaxNLeafsReached is used when trying to add a number of new publicKeys
-	// which would exceed the maximum number of keys in the census.
-	ErrMaxNLeafsReached = fmt.Errorf("MaxNLeafs (%d) reached", types.MaxNLeafs)
+	// which would exceed the maximum number of keys in the census, which is
+	// determined by the census MaxLevels.
+	ErrMaxNLeafsReached = errors.New("MaxNLeafs reached")
+	// ErrSnapshotExists is used when trying to create a Snapshot with a
+	// name that is already used by another Snapshot of the same Census
+	ErrSnapshotExists = errors.New("Snapshot already exists")
+	// ErrSnapshotNotFound is used when the requested Snapshot does not
+	// exist in the Census
+	ErrSnapshotNotFound = errors.New("Snapshot does not exist")
 )
 
 // Info contains metadata about a Census
@@ -38,29 +59,45 @@ type Info struct {
 	Size   uint64 `json:"size"`
 	Closed bool   `json:"closed"`
 	Root   []byte `json:"root,omitempty"`
+	// MaxLevels is the maximum number of levels of the Census MerkleTree,
+	// which determines the maximum number of keys (2^MaxLevels)
+	MaxLevels int `json:"maxLevels"`
+}
+
+// Snapshot contains the metadata of a named checkpoint of the Census, which
+// can be taken while the Census is still open. MerkleProofs can be generated
+// against the Snapshot Root even after more keys are added to the Census.
+type Snapshot struct {
+	Name string    `json:"name"`
+	Root []byte    `json:"root"`
+	Size uint64    `json:"size"`
+	Time time.Time `json:"time"`
 }
 
 // Census contains the MerkleTree with the PublicKeys
 type Census struct {
-	tree *arbo.Tree
-	db   db.Database
+	// mu ensures that the tree root and the nextIndex are consistent
+	// between them when taking a Snapshot while keys are being added
+	mu        sync.Mutex
+	tree      *arbo.Tree
+	db        db.Database
+	maxLevels int
 }
 
 // Options is used to pass the parameters to load a new Census
 type Options struct {
 	// DB defines the database that will be used for the census
 	DB db.Database
+	// MaxLevels defines the maximum number of levels of the Census
+	// MerkleTree, which should match the nLevels of the circuit that will
+	// be used with the Census. If not set (0), types.MaxLevels is used.
+	// When loading an existing Census, the stored MaxLevels is used, and
+	// MaxLevels must be 0 or match the stored one.
+	MaxLevels int
 }
 
 // New loads the census
 func New(opts Options) (*Census, error) {
-	arboConfig := arbo.Config{
-		Database:     opts.DB,
-		MaxLevels:    types.MaxLevels,
-		HashFunction: arbo.HashFunctionPoseidon,
-		// ThresholdNLeafs: not specified, use the default
-	}
-
 	// TODO benchmark concurrent usage to determine wether to do the
 	// approach of creating a new db dir for each Census, or to use the
 	// same db for all the Censuses using a different db prefix for each
@@ -68,14 +105,44 @@ func New(opts Options) (*Census, error) {
 	wTx := opts.DB.WriteTx()
 	defer wTx.Discard()
 
+	maxLevels, err := getMaxLevels(wTx)
+	if err == db.ErrKeyNotFound {
+		// new Census, store the MaxLevels
+		maxLevels = opts.MaxLevels
+		if maxLevels == 0 {
+			maxLevels = types.MaxLevels
+		}
+		if maxLevels < 1 || maxLevels > types.MaxLevels {
+			return nil, fmt.Errorf("%w, must be between 1 and %d, current: %d",
+				ErrInvalidMaxLevels, types.MaxLevels, maxLevels)
+		}
+		if err := setMaxLevels(wTx, maxLevels); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else if opts.MaxLevels != 0 && opts.MaxLevels != maxLevels {
+		return nil, fmt.Errorf("%w, Census already exists with MaxLevels %d,"+
+			" can not load it with MaxLevels %d", ErrInvalidMaxLevels,
+			maxLevels, opts.MaxLevels)
+	}
+
+	arboConfig := arbo.Config{
+		Database:     opts.DB,
+		MaxLevels:    maxLevels,
+		HashFunction: arbo.HashFunctionPoseidon,
+		// ThresholdNLeafs: not specified, use the default
+	}
+
 	tree, err := arbo.NewTreeWithTx(wTx, arboConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &Census{
-		tree: tree,
-		db:   opts.DB,
+		tree:      tree,
+		db:        opts.DB,
+		maxLevels: maxLevels,
 	}
 
 	// if nextIndex is not set in the db, initialize it to 0
@@ -87,8 +154,13 @@ func New(opts Options) (*Census, error) {
 		}
 	}
 
-	// store editable=true if
-	if err := wTx.Set(dbKeyCensusClosed, []byte{0}); err != nil {
+	// store editable=true if the census is new, so that loading an
+	// existing census does not reopen it
+	if _, err := wTx.Get(dbKeyCensusClosed); err == db.ErrKeyNotFound {
+		if err := wTx.Set(dbKeyCensusClosed, []byte{0}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -100,6 +172,36 @@ func New(opts Options) (*Census, error) {
 	return c, nil
 }
 
+func setMaxLevels(wTx db.WriteTx, maxLevels int) error {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(maxLevels))
+	return wTx.Set(dbKeyMaxLevels, b)
+}
+
+func getMaxLevels(rTx db.ReadTx) (int, error) {
+	b, err := rTx.Get(dbKeyMaxLevels)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint64(b)), nil
+}
+
+// MaxLevels returns the maximum number of levels of the Census MerkleTree
+func (c *Census) MaxLevels() int {
+	return c.maxLevels
+}
+
+// MaxNLeafs returns the maximum number of PublicKeys that the Census can hold
+func (c *Census) MaxNLeafs() uint64 {
+	return types.MaxNLeafsForLevels(c.maxLevels)
+}
+
+// indexBytes returns the leaf index (key) of the Census MerkleTree for the
+// given index, with the length determined by the Census MaxLevels
+func (c *Census) indexBytes(index uint64) []byte {
+	return types.Uint64ToIndex(index)[:types.IndexLen(c.maxLevels)]
+}
+
 func (c *Census) setNextIndex(wTx db.WriteTx, nextIndex uint64) error {
 	b := make([]byte, 8)
 	binary.LittleEndian.PutUint64(b, uint64(nextIndex))
@@ -163,7 +265,7 @@ func (c *Census) Close() error {
 		return err
 	}
 	if isClosed {
-		return fmt.Errorf("Census already closed")
+		return ErrCensusAlreadyClosed
 	}
 	wTx := c.db.WriteTx()
 	defer wTx.Discard()
@@ -239,8 +341,9 @@ func (c *Census) Info() (*Info, error) {
 	ci := &Info{
 		ErrMsg: errMsg,
 		Size:   size,
-		Closed: isClosed,
-		Root:   root,
+		Closed:    isClosed,
+		Root:      root,
+		MaxLevels: c.maxLevels,
 	}
 
 	return ci, nil
@@ -257,6 +360,9 @@ func (c *Census) AddPublicKeys(pubKs []babyjub.PublicKey,
 	if isClosed {
 		return nil, ErrCensusClosed
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	wTx := c.db.WriteTx()
 	defer wTx.Discard()
 
@@ -265,9 +371,11 @@ func (c *Census) AddPublicKeys(pubKs []babyjub.PublicKey,
 		return nil, err
 	}
 
-	if nextIndex+uint64(len(pubKs)) > types.MaxNLeafs {
-		return nil, fmt.Errorf("%s, current index: %d, trying to add %d keys",
-			ErrMaxNLeafsReached, nextIndex, len(pubKs))
+	maxNLeafs := c.MaxNLeafs()
+	if uint64(len(pubKs)) > maxNLeafs-nextIndex {
+		return nil, fmt.Errorf("%s (%d, MaxLevels: %d), current index: %d,"+
+			" trying to add %d keys", ErrMaxNLeafsReached, maxNLeafs,
+			c.maxLevels, nextIndex, len(pubKs))
 	}
 	var indexes [][]byte
 	var pubKHashes [][]byte
@@ -281,7 +389,7 @@ func (c *Census) AddPublicKeys(pubKs []babyjub.PublicKey,
 			nextIndex+uint64(i),
 			weights[i],
 		)
-		indexBytes := types.Uint64ToIndex(index)
+		indexBytes := c.indexBytes(index)
 		indexes = append(indexes[:], indexBytes)
 
 		// store the mapping between PublicKey->Index,Weight
@@ -332,6 +440,12 @@ func (c *Census) GetProof(pubK *babyjub.PublicKey) (uint64, []byte, error) {
 		return 0, nil, ErrCensusNotClosed
 	}
 
+	return c.genProof(c.tree, pubK)
+}
+
+// genProof returns the index and the MerkleProof of the given PublicKey in the
+// given tree, which can be the Census tree or a Snapshot of it
+func (c *Census) genProof(tree *arbo.Tree, pubK *babyjub.PublicKey) (uint64, []byte, error) {
 	rTx := c.db.ReadTx()
 	defer rTx.Discard()
 
@@ -345,15 +459,14 @@ func (c *Census) GetProof(pubK *babyjub.PublicKey) (uint64, []byte, error) {
 	if err != nil {
 		return 0, nil, err
 	}
-	index32Bytes := types.Uint64ToIndex(index)
-	_, leafV, s, existence, err := c.tree.GenProof(index32Bytes)
+	_, leafV, s, existence, err := tree.GenProof(c.indexBytes(index))
 	if err != nil {
 		return 0, nil, err
 	}
 	if !existence {
 		// proof of non-existence currently not needed in the current use case
 		return 0, nil,
-			fmt.Errorf("publicKey does not exist in the census (%x)", pubKComp[:])
+			fmt.Errorf("%w (%x)", ErrPublicKeyNotFound, pubKComp[:])
 	}
 	hashPubKBytes, err := types.HashPubKBytes(pubK, weight)
 	if err != nil {
@@ -366,6 +479,112 @@ func (c *Census) GetProof(pubK *babyjub.PublicKey) (uint64, []byte, error) {
 	return index, s, nil
 }
 
+func snapshotDBKey(name string) []byte {
+	return append(append([]byte{}, dbPrefixSnapshot...), []byte(name)...)
+}
+
+// NewSnapshot stores a Snapshot with the given name containing the current
+// Root and Size of the Census. The Census does not need to be closed.
+func (c *Census) NewSnapshot(name string) (*Snapshot, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Snapshot name can not be empty")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wTx := c.db.WriteTx()
+	defer wTx.Discard()
+
+	key := snapshotDBKey(name)
+	if _, err := wTx.Get(key); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotExists, name)
+	} else if err != db.ErrKeyNotFound {
+		return nil, err
+	}
+
+	root, err := c.tree.RootWithTx(wTx)
+	if err != nil {
+		return nil, err
+	}
+	size, err := c.getNextIndex(wTx)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Name: name,
+		Root: root,
+		Size: size,
+		Time: time.Now().UTC(),
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := wTx.Set(key, b); err != nil {
+		return nil, err
+	}
+
+	// commit the db.WriteTx
+	if err := wTx.Commit(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetSnapshot returns the Snapshot with the given name
+func (c *Census) GetSnapshot(name string) (*Snapshot, error) {
+	rTx := c.db.ReadTx()
+	defer rTx.Discard()
+
+	b, err := rTx.Get(snapshotDBKey(name))
+	if err == db.ErrKeyNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	} else if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Snapshots returns all the Snapshots of the Census, sorted by name
+func (c *Census) Snapshots() ([]Snapshot, error) {
+	var snapshots []Snapshot
+	var errUnmarshal error
+	err := c.db.Iterate(dbPrefixSnapshot, func(_, v []byte) bool {
+		var snapshot Snapshot
+		if errUnmarshal = json.Unmarshal(v, &snapshot); errUnmarshal != nil {
+			return false
+		}
+		snapshots = append(snapshots, snapshot)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errUnmarshal != nil {
+		return nil, errUnmarshal
+	}
+	return snapshots, nil
+}
+
+// GetSnapshotProof returns the index and the MerkleProof compressed for the
+// given PublicKey against the Root of the Snapshot with the given name
+func (c *Census) GetSnapshotProof(name string, pubK *babyjub.PublicKey) (
+	uint64, []byte, error) {
+	snapshot, err := c.GetSnapshot(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	tree, err := c.tree.Snapshot(snapshot.Root)
+	if err != nil {
+		return 0, nil, err
+	}
+	return c.genProof(tree, pubK)
+}
+
 // CheckProof checks a given MerkleProof of the given PublicKey (& index)
 // for the given CensusRoot
 func CheckProof(root, proof []byte, index uint64, pubK *babyjub.PublicKey,
@@ -29,7 +29,7 @@ func newTestDB(c *qt.C) db.Database {
 
 func newTestCensus(c *qt.C) *Census {
 	database := newTestDB(c)
-	opts := Options{database}
+	opts := Options{DB: database}
 	census, err := New(opts)
 	c.Assert(err, qt.IsNil)
 	return census
@@ -222,3 +222,143 @@ func TestInfo(t *testing.T) {
 	c.Assert(ci.Closed, qt.IsTrue)
 	c.Assert(ci.Root, qt.DeepEquals, root)
 }
+
+func TestSnapshots(t *testing.T) {
+	c := qt.New(t)
+
+	census := newTestCensus(c)
+
+	nKeys := 100
+	// generate the publicKeys
+	var pubKs []babyjub.PublicKey
+	var weights []*big.Int
+	for i := 0; i < nKeys; i++ {
+		sk := babyjub.NewRandPrivKey()
+		pubK := sk.Public()
+		pubKs = append(pubKs, *pubK)
+		weights = append(weights, big.NewInt(1))
+	}
+
+	// add the first half of the keys and take a snapshot
+	invalids, err := census.AddPublicKeys(pubKs[:nKeys/2], weights[:nKeys/2])
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(invalids), qt.Equals, 0)
+
+	snapshot, err := census.NewSnapshot("checkpoint0")
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot.Size, qt.Equals, uint64(nKeys/2))
+	root0, err := census.IntermediateRoot()
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot.Root, qt.DeepEquals, root0)
+
+	// expect error when reusing the name
+	_, err = census.NewSnapshot("checkpoint0")
+	c.Assert(err, qt.ErrorMatches, ErrSnapshotExists.Error()+".*")
+
+	// add the rest of the keys, and take another snapshot
+	invalids, err = census.AddPublicKeys(pubKs[nKeys/2:], weights[nKeys/2:])
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(invalids), qt.Equals, 0)
+
+	snapshot, err = census.NewSnapshot("checkpoint1")
+	c.Assert(err, qt.IsNil)
+	c.Assert(snapshot.Size, qt.Equals, uint64(nKeys))
+	root1 := snapshot.Root
+	c.Assert(root1, qt.Not(qt.DeepEquals), root0)
+
+	snapshots, err := census.Snapshots()
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(snapshots), qt.Equals, 2)
+	c.Assert(snapshots[0].Name, qt.Equals, "checkpoint0")
+	c.Assert(snapshots[1].Name, qt.Equals, "checkpoint1")
+
+	_, err = census.GetSnapshot("nonexistent")
+	c.Assert(err, qt.ErrorMatches, ErrSnapshotNotFound.Error()+".*")
+
+	// the census is still open, but proofs against the snapshots can be
+	// generated
+	for i := 0; i < nKeys; i++ {
+		index, proof, err := census.GetSnapshotProof("checkpoint0", &pubKs[i])
+		if i >= nKeys/2 {
+			// keys added after the snapshot are not in it
+			c.Assert(err, qt.Not(qt.IsNil))
+			continue
+		}
+		c.Assert(err, qt.IsNil)
+		v, err := CheckProof(root0, proof, index, &pubKs[i], weights[i])
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.IsTrue)
+
+		index, proof, err = census.GetSnapshotProof("checkpoint1", &pubKs[i])
+		c.Assert(err, qt.IsNil)
+		v, err = CheckProof(root1, proof, index, &pubKs[i], weights[i])
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.IsTrue)
+	}
+}
+
+func TestMaxLevels(t *testing.T) {
+	c := qt.New(t)
+
+	database := newTestDB(c)
+	census, err := New(Options{DB: database, MaxLevels: 4})
+	c.Assert(err, qt.IsNil)
+	c.Assert(census.MaxLevels(), qt.Equals, 4)
+	c.Assert(census.MaxNLeafs(), qt.Equals, uint64(16))
+
+	var pubKs []babyjub.PublicKey
+	var weights []*big.Int
+	for i := 0; i < 17; i++ {
+		sk := babyjub.NewRandPrivKey()
+		pubKs = append(pubKs, *sk.Public())
+		weights = append(weights, big.NewInt(1))
+	}
+
+	invalids, err := census.AddPublicKeys(pubKs[:10], weights[:10])
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(invalids), qt.Equals, 0)
+
+	// expect error when exceeding the 2^4 keys
+	_, err = census.AddPublicKeys(pubKs[10:], weights[10:])
+	c.Assert(err, qt.ErrorMatches, ErrMaxNLeafsReached.Error()+".*")
+
+	invalids, err = census.AddPublicKeys(pubKs[10:16], weights[10:16])
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(invalids), qt.Equals, 0)
+
+	err = census.Close()
+	c.Assert(err, qt.IsNil)
+	root, err := census.Root()
+	c.Assert(err, qt.IsNil)
+
+	info, err := census.Info()
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.MaxLevels, qt.Equals, 4)
+
+	for i := 0; i < 16; i++ {
+		index, proof, err := census.GetProof(&pubKs[i])
+		c.Assert(err, qt.IsNil)
+		siblings, err := arbo.UnpackSiblings(arbo.HashFunctionPoseidon, proof)
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(siblings) <= 4, qt.IsTrue)
+
+		v, err := CheckProof(root, proof, index, &pubKs[i], weights[i])
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.IsTrue)
+	}
+
+	// loading the census again keeps the stored MaxLevels, and the
+	// census remains closed
+	census2, err := New(Options{DB: database})
+	c.Assert(err, qt.IsNil)
+	c.Assert(census2.MaxLevels(), qt.Equals, 4)
+	isClosed, err := census2.IsClosed()
+	c.Assert(err, qt.IsNil)
+	c.Assert(isClosed, qt.IsTrue)
+	_, err = New(Options{DB: database, MaxLevels: 8})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// expect error for invalid MaxLevels
+	_, err = New(Options{DB: newTestDB(c), MaxLevels: types.MaxLevels + 1})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
@@ -2,6 +2,7 @@ package censusbuilder
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
@@ -9,26 +10,39 @@ import (
 	"strconv"
 
 	"github.com/aragon/ovote-node/census"
+	"github.com/aragon/ovote-node/types"
 	"github.com/iden3/go-iden3-crypto/babyjub"
 	"go.vocdoni.io/dvote/db"
 	"go.vocdoni.io/dvote/db/pebbledb"
 	"go.vocdoni.io/dvote/log"
 )
 
+// ErrCensusNotFound is used when the requested Census does not exist
+var ErrCensusNotFound = errors.New("Census does not exist")
+
 // CensusBuilder manages multiple Census MerkleTrees
 type CensusBuilder struct {
 	subDBsPath string
 	db         db.Database
+	// nLevels is the number of levels of the circuit used with the
+	// censuses, which bounds the MaxLevels of the new censuses
+	nLevels int
 
 	// censuses contains the loaded census
 	censuses map[uint64]*census.Census
 }
 
-// New loads the CensusBuilder
-func New(database db.Database, subDBsPath string) (*CensusBuilder, error) {
+// New loads the CensusBuilder, which creates the censuses for a circuit of the
+// given nLevels
+func New(database db.Database, subDBsPath string, nLevels int) (*CensusBuilder, error) {
+	if nLevels < 1 || nLevels > types.MaxLevels {
+		return nil, fmt.Errorf("%w, circuit nLevels must be between 1 and %d,"+
+			" current: %d", census.ErrInvalidMaxLevels, types.MaxLevels, nLevels)
+	}
 	cb := &CensusBuilder{
 		subDBsPath: subDBsPath,
 		db:         database,
+		nLevels:    nLevels,
 		censuses:   make(map[uint64]*census.Census),
 	}
 
@@ -76,7 +90,7 @@ func (cb *CensusBuilder) getNextCensusID(rTx db.ReadTx) (uint64, error) {
 }
 
 // createCensus will create the Census sub-db and point to it in memory
-func (cb *CensusBuilder) createCensus(censusID uint64) error {
+func (cb *CensusBuilder) createCensus(censusID uint64, maxLevels int) error {
 	path := filepath.Join(cb.subDBsPath, strconv.Itoa(int(censusID)))
 
 	// check if sub-db already exists for the Census
@@ -90,7 +104,7 @@ func (cb *CensusBuilder) createCensus(censusID uint64) error {
 	if err != nil {
 		return err
 	}
-	optsCensus := census.Options{DB: database}
+	optsCensus := census.Options{DB: database, MaxLevels: maxLevels}
 	c, err := census.New(optsCensus)
 	if err != nil {
 		return err
@@ -107,7 +121,7 @@ func (cb *CensusBuilder) loadCensusIfNotYet(censusID uint64) error {
 		// check if sub-db exists for the Census
 		_, err := os.Stat(path)
 		if os.IsNotExist(err) {
-			return fmt.Errorf("CensusID=%d does not exist", censusID)
+			return fmt.Errorf("%w, CensusID: %d", ErrCensusNotFound, censusID)
 		}
 
 		// census not loaded, load it
@@ -130,8 +144,22 @@ func (cb *CensusBuilder) loadCensusIfNotYet(censusID uint64) error {
 // will be required, to ensure that all these actions are performed by the same
 // key. Probably the authentication will be at the API level.
 
-// NewCensus will create a new Census, if the Census already exists, will load it
-func (cb *CensusBuilder) NewCensus() (uint64, error) {
+// NLevels returns the number of levels of the circuit used with the censuses
+func (cb *CensusBuilder) NLevels() int {
+	return cb.nLevels
+}
+
+// NewCensus will create a new Census with the given maxLevels, which can not
+// exceed the nLevels of the circuit that will be used with the Census, as
+// smaller trees fit in the circuit.
+func (cb *CensusBuilder) NewCensus(maxLevels int) (uint64, error) {
+	// check maxLevels before creating the Census sub-db
+	if maxLevels < 1 || maxLevels > cb.nLevels {
+		return 0, fmt.Errorf("%w, must be between 1 and the circuit nLevels"+
+			" (%d), current: %d", census.ErrInvalidMaxLevels, cb.nLevels,
+			maxLevels)
+	}
+
 	rTx := cb.db.ReadTx()
 	defer rTx.Discard()
 	nextCensusID, err := cb.getNextCensusID(rTx)
@@ -139,7 +167,7 @@ func (cb *CensusBuilder) NewCensus() (uint64, error) {
 		return 0, err
 	}
 
-	err = cb.createCensus(nextCensusID)
+	err = cb.createCensus(nextCensusID, maxLevels)
 	if err != nil {
 		return 0, err
 	}
@@ -154,7 +182,8 @@ func (cb *CensusBuilder) NewCensus() (uint64, error) {
 	if err := wTx.Commit(); err != nil {
 		return 0, err
 	}
-	log.Debugf("[CensusID=%d] New census created", nextCensusID)
+	log.Debugf("[CensusID=%d] New census created, MaxLevels: %d", nextCensusID,
+		cb.censuses[nextCensusID].MaxLevels())
 
 	return nextCensusID, nil
 }
@@ -178,7 +207,7 @@ func (cb *CensusBuilder) CensusRoot(censusID uint64) ([]byte, error) {
 	}
 	root, err := cb.censuses[censusID].Root()
 	if err != nil {
-		return nil, fmt.Errorf("Can not get the CensusRoot, %s", err)
+		return nil, fmt.Errorf("Can not get the CensusRoot, %w", err)
 	}
 	return root, nil
 }
@@ -257,3 +286,46 @@ func (cb *CensusBuilder) GetProof(censusID uint64, pubK *babyjub.PublicKey) (
 	}
 	return index, proof, nil
 }
+
+// NewSnapshot stores a Snapshot with the given name of the current state of
+// the Census for the given censusID. The Census does not need to be closed.
+func (cb *CensusBuilder) NewSnapshot(censusID uint64, name string) (*census.Snapshot, error) {
+	if err := cb.loadCensusIfNotYet(censusID); err != nil {
+		return nil, err
+	}
+	snapshot, err := cb.censuses[censusID].NewSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[CensusID=%d] Snapshot %s created. Root: %x, Size: %d",
+		censusID, name, snapshot.Root, snapshot.Size)
+	return snapshot, nil
+}
+
+// GetSnapshot returns the Snapshot with the given name of the Census for the
+// given censusID
+func (cb *CensusBuilder) GetSnapshot(censusID uint64, name string) (*census.Snapshot, error) {
+	if err := cb.loadCensusIfNotYet(censusID); err != nil {
+		return nil, err
+	}
+	return cb.censuses[censusID].GetSnapshot(name)
+}
+
+// Snapshots returns all the Snapshots of the Census for the given censusID
+func (cb *CensusBuilder) Snapshots(censusID uint64) ([]census.Snapshot, error) {
+	if err := cb.loadCensusIfNotYet(censusID); err != nil {
+		return nil, err
+	}
+	return cb.censuses[censusID].Snapshots()
+}
+
+// GetSnapshotProof returns the index and the MerkleProof compressed for the
+// given PublicKey against the Root of the Snapshot with the given name of the
+// Census for the given censusID
+func (cb *CensusBuilder) GetSnapshotProof(censusID uint64, name string,
+	pubK *babyjub.PublicKey) (uint64, []byte, error) {
+	if err := cb.loadCensusIfNotYet(censusID); err != nil {
+		return 0, nil, err
+	}
+	return cb.censuses[censusID].GetSnapshotProof(name, pubK)
+}
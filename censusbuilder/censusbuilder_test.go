@@ -1,6 +1,7 @@
 package censusbuilder
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/aragon/ovote-node/census"
@@ -11,6 +12,8 @@ import (
 	"go.vocdoni.io/dvote/db/pebbledb"
 )
 
+const testNLevels = 16
+
 func newTestDB(c *qt.C) db.Database {
 	var database db.Database
 	var err error
@@ -25,10 +28,10 @@ func TestNewCensus(t *testing.T) {
 
 	// create the CensusBuilder
 	database := newTestDB(c)
-	cb, err := New(database, c.TempDir())
+	cb, err := New(database, c.TempDir(), testNLevels)
 	c.Assert(err, qt.IsNil)
 
-	censusID1, err := cb.NewCensus()
+	censusID1, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	err = cb.CloseCensus(censusID1)
 	c.Assert(err, qt.IsNil)
@@ -38,7 +41,7 @@ func TestNewCensus(t *testing.T) {
 	_, err = cb.CensusRoot(censusID1)
 	c.Assert(err, qt.IsNil)
 
-	censusID2, err := cb.NewCensus()
+	censusID2, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	c.Assert(censusID1, qt.Equals, uint64(0))
 
@@ -49,6 +52,23 @@ func TestNewCensus(t *testing.T) {
 
 	err = cb.CloseCensus(censusID2)
 	c.Assert(err, qt.IsNil)
+
+	// the censuses can have less levels than the circuit, but not more
+	censusID3, err := cb.NewCensus(testNLevels - 1)
+	c.Assert(err, qt.IsNil)
+	info, err := cb.CensusInfo(censusID3)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.MaxLevels, qt.Equals, testNLevels-1)
+	_, err = cb.NewCensus(1)
+	c.Assert(err, qt.IsNil)
+	_, err = cb.NewCensus(0)
+	c.Assert(errors.Is(err, census.ErrInvalidMaxLevels), qt.IsTrue)
+	_, err = cb.NewCensus(testNLevels + 1)
+	c.Assert(errors.Is(err, census.ErrInvalidMaxLevels), qt.IsTrue)
+	c.Assert(err, qt.ErrorMatches, ".*circuit nLevels \\(16\\).*")
+
+	_, err = New(newTestDB(c), c.TempDir(), 0)
+	c.Assert(errors.Is(err, census.ErrInvalidMaxLevels), qt.IsTrue)
 }
 
 func TestAddPublicKeys(t *testing.T) {
@@ -60,10 +80,10 @@ func TestAddPublicKeys(t *testing.T) {
 
 	// create the CensusBuilder
 	database := newTestDB(c)
-	cb, err := New(database, c.TempDir())
+	cb, err := New(database, c.TempDir(), testNLevels)
 	c.Assert(err, qt.IsNil)
 
-	censusID1, err := cb.NewCensus()
+	censusID1, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	err = cb.AddPublicKeys(censusID1, keys.PublicKeys, keys.Weights)
 	c.Assert(err, qt.IsNil)
@@ -74,7 +94,7 @@ func TestAddPublicKeys(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 
 	// create a 2nd Census, with the same pubKs than the 1st one
-	censusID2, err := cb.NewCensus()
+	censusID2, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	err = cb.AddPublicKeys(censusID2, keys.PublicKeys, keys.Weights)
 	c.Assert(err, qt.IsNil)
@@ -109,10 +129,10 @@ func TestGetProof(t *testing.T) {
 
 	// create the CensusBuilder
 	database := newTestDB(c)
-	cb, err := New(database, c.TempDir())
+	cb, err := New(database, c.TempDir(), testNLevels)
 	c.Assert(err, qt.IsNil)
 
-	censusID, err := cb.NewCensus()
+	censusID, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	err = cb.AddPublicKeys(censusID, keys.PublicKeys, keys.Weights)
 	c.Assert(err, qt.IsNil)
@@ -142,10 +162,10 @@ func TestCensusInfo(t *testing.T) {
 
 	// create the CensusBuilder
 	database := newTestDB(c)
-	cb, err := New(database, c.TempDir())
+	cb, err := New(database, c.TempDir(), testNLevels)
 	c.Assert(err, qt.IsNil)
 
-	censusID, err := cb.NewCensus()
+	censusID, err := cb.NewCensus(testNLevels)
 	c.Assert(err, qt.IsNil)
 	err = cb.AddPublicKeys(censusID, keys.PublicKeys, keys.Weights)
 	c.Assert(err, qt.IsNil)
@@ -4,12 +4,15 @@ import (
 	"database/sql"
 	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/aragon/ovote-node/api"
 	"github.com/aragon/ovote-node/censusbuilder"
 	"github.com/aragon/ovote-node/db"
 	"github.com/aragon/ovote-node/eth"
 	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
 	"github.com/aragon/ovote-node/votesaggregator"
 	"github.com/ethereum/go-ethereum/common"
 	_ "github.com/mattn/go-sqlite3"
@@ -21,10 +24,24 @@ import (
 
 // Config contains the main configuration parameters of the node
 type Config struct {
-	dir, logLevel, port             string
-	startScanBlock                  uint64
-	censusBuilder, votesAggregator  bool
-	contractAddr, ethURL, proverURL string
+	dir, logLevel, port            string
+	startScanBlock                 uint64
+	censusBuilder, votesAggregator bool
+	contractAddr, ethURL           string
+	proverURLs                     []string
+	nMaxVotes, nLevels             int
+	voteStatusAuth                 bool
+	voteStatusTTL                  time.Duration
+	hideTally                      bool
+	proveWithoutQuorum             bool
+	verificationKeyPath            string
+	proofTimeout                   time.Duration
+	maxProofAttempts               int
+	callbacks                      bool
+	proverClientID, proverSecret   string
+	localProverPath                string
+	verifyWorkers, verifyQueue     int
+	verifyCache                    int
 }
 
 func main() {
@@ -44,7 +61,41 @@ func main() {
 	flag.StringVar(&config.contractAddr, "addr", "", "OVOTE contract address")
 	flag.Uint64Var(&config.startScanBlock, "block", 0,
 		"Start scanning block (usually the block where the OVOTE contract was deployed)")
-	flag.StringVar(&config.proverURL, "prover", "127.0.0.1:9000", "prover url")
+	flag.StringSliceVar(&config.proverURLs, "prover",
+		[]string{"127.0.0.1:9000"},
+		"prover urls (comma separated), the proofs are balanced between them")
+	flag.DurationVar(&config.proofTimeout, "prooftimeout", 30*time.Minute,
+		"deadline of each proof generation attempt")
+	flag.IntVar(&config.maxProofAttempts, "proofattempts", 3,
+		"maximum number of proof generation attempts of a process")
+	flag.StringVar(&config.localProverPath, "localprover", "",
+		"local prover json config file, to generate proofs in this process")
+	flag.BoolVar(&config.callbacks, "callbacks", false,
+		"request the provers to send the generated proofs to the callback url of this node"+
+			" in their clients config (requires --proversecret)")
+	flag.StringVar(&config.proverClientID, "proverclientid", "",
+		"client id of this node in the provers, used to authenticate the requests")
+	flag.StringVar(&config.proverSecret, "proversecret", "",
+		"secret shared with the provers to sign the requests of this node")
+	flag.IntVar(&config.nMaxVotes, "nmaxvotes", 128, "circuit maximum number of votes")
+	flag.IntVar(&config.nLevels, "nlevels", 7, "circuit number of census levels")
+	flag.BoolVar(&config.voteStatusAuth, "votestatusauth", false,
+		"require the voter signature to get the status of a vote")
+	flag.DurationVar(&config.voteStatusTTL, "votestatusttl", 5*time.Minute,
+		"maximum age of the signed vote status requests")
+	flag.BoolVar(&config.hideTally, "hidetally", false,
+		"hide the result of the processes until they are frozen")
+	flag.BoolVar(&config.proveWithoutQuorum, "provewithoutquorum", false,
+		"generate the proof of the processes that do not reach the thresholds")
+	flag.StringVar(&config.verificationKeyPath, "verificationkey", "",
+		"circuit verification key json file, used to verify the proofs"+
+			" (required with -v)")
+	flag.IntVar(&config.verifyWorkers, "verifyworkers", runtime.NumCPU(),
+		"number of votes verified concurrently")
+	flag.IntVar(&config.verifyQueue, "verifyqueue", 1024,
+		"number of votes waiting to be verified, once full the votes are rejected with a 429")
+	flag.IntVar(&config.verifyCache, "verifycache", 10000,
+		"number of vote verification results cached, to not verify twice the votes sent again")
 	// TODO add flag for configurable threshold of minimum census size (to prevent small censuses)
 
 	flag.CommandLine.SortFlags = false
@@ -63,7 +114,8 @@ func main() {
 			log.Fatal(err)
 		}
 
-		censusBuilder, err = censusbuilder.New(database, filepath.Join(config.dir, "subsdb"))
+		censusBuilder, err = censusbuilder.New(database,
+			filepath.Join(config.dir, "subsdb"), config.nLevels)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -116,13 +168,94 @@ func main() {
 		}
 		log.Infof("Eth scanning from block: %d", lastSyncBlockNum)
 
-		proverClient := prover.NewClient(config.proverURL)
+		var provers []prover.Prover
+		for _, url := range config.proverURLs {
+			if url == "" {
+				continue
+			}
+			proverClient := prover.NewClient(url)
+			if config.callbacks {
+				proverClient.EnableCallbacks()
+			}
+			if config.proverSecret != "" {
+				proverClient.SetAuth(config.proverClientID,
+					[]byte(config.proverSecret))
+			}
+			provers = append(provers, proverClient)
+		}
+		if config.localProverPath != "" {
+			localOpts, err := prover.LoadLocalOptions(config.localProverPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if localOpts.Dir == "" {
+				localOpts.Dir = filepath.Join(config.dir, "localprover")
+			}
+			localProver, err := prover.NewLocal(*localOpts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			provers = append(provers, localProver)
+		}
+		if len(provers) == 0 {
+			log.Fatal("no prover configured")
+		}
+		// the callbacks are signed with the secret of this node in the
+		// provers
+		var callbackSecret []byte
+		if config.callbacks {
+			if config.proverSecret == "" {
+				log.Fatal("proversecret flag is required to use callbacks")
+			}
+			callbackSecret = []byte(config.proverSecret)
+		}
+		if config.proverSecret != "" && config.proverClientID == "" {
+			log.Fatal("proverclientid flag is required to authenticate the requests")
+		}
+
+		// prepare the db where the receipts trees are stored
+		receiptsDB, err := pebbledb.New(kvdb.Options{
+			Path: filepath.Join(config.dir, "receipts")})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if config.verificationKeyPath == "" {
+			log.Fatal("verificationkey flag is required to verify the proofs")
+		}
+		verificationKey, err := prover.LoadVerificationKey(
+			config.verificationKeyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		// prepare VotesAggregator
-		votesAggregator, err = votesaggregator.New(sqlite, ethC.ChainID, proverClient)
+		circuit := types.ZKCircuitMeta{
+			NMaxVotes: config.nMaxVotes,
+			NLevels:   config.nLevels,
+		}
+		votesAggregator, err = votesaggregator.New(votesaggregator.Options{
+			SQLite:               sqlite,
+			ReceiptsDB:           receiptsDB,
+			ChainID:              ethC.ChainID,
+			Circuit:              circuit,
+			Provers:              prover.NewPool(provers...),
+			ProofTimeout:         config.proofTimeout,
+			MaxProofAttempts:     config.maxProofAttempts,
+			VoteStatusAuth:       config.voteStatusAuth,
+			VoteStatusRequestTTL: config.voteStatusTTL,
+			HideTally:            config.hideTally,
+			ProveWithoutQuorum:   config.proveWithoutQuorum,
+			VerificationKey:      verificationKey,
+			CallbackSecret:       callbackSecret,
+			VerifyWorkers:        config.verifyWorkers,
+			VerifyQueueSize:      config.verifyQueue,
+			VerifyCacheSize:      config.verifyCache,
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
+		go votesAggregator.SyncProcesses()
 
 		err = ethC.Sync()
 		if err != nil {
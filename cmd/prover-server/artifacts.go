@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	fileZKInputs = "zkinputs.json"
+	fileWitness  = "witness.wtns"
+	fileProof    = "proof.json"
+	filePublic   = "public.json"
+
+	// cleanupInterval is the number of seconds between the checks of the
+	// expired job files
+	cleanupInterval = 3600
+)
+
+// retention determines how long the files generated by the jobs are kept
+type retention struct {
+	// keepWitness keeps the witness once the proof has been generated
+	keepWitness bool
+	// keepRetrieved keeps the proof once the node has confirmed its
+	// retrieval, until it expires
+	keepRetrieved bool
+	// proofTTL is the time after which the files of the finished jobs are
+	// removed, zero keeps them forever
+	proofTTL time.Duration
+}
+
+// jobDir returns the directory where the files of the given job are stored
+func (a *api) jobDir(id uint64) string {
+	return filepath.Join(a.jobsDir, strconv.FormatUint(id, 10))
+}
+
+// jobFile returns the path of the given file of the given job
+func (a *api) jobFile(id uint64, name string) string {
+	return filepath.Join(a.jobDir(id), name)
+}
+
+// removeJobFiles removes the directory of the given job
+func (a *api) removeJobFiles(id uint64) {
+	if err := os.RemoveAll(a.jobDir(id)); err != nil {
+		log.Warnw("can not remove job files", "id", id, "err", err)
+	}
+}
+
+// removeWitness removes the witness of the given job, unless it has to be kept
+func (a *api) removeWitness(id uint64) {
+	if a.retention.keepWitness {
+		return
+	}
+	err := os.Remove(a.jobFile(id, fileWitness))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnw("can not remove witness", "id", id, "err", err)
+	}
+}
+
+// releaseJob removes the files of the given finished job, which is no longer
+// served
+func (a *api) releaseJob(id uint64) error {
+	a.removeJobFiles(id)
+	return a.jobs.remove(id)
+}
+
+// retrieved is called once the node has confirmed the retrieval of the proof
+// of the given job, which is released unless it has to be kept
+func (a *api) retrieved(id uint64) error {
+	if a.retention.keepRetrieved {
+		return nil
+	}
+	return a.releaseJob(id)
+}
+
+// cleanup periodically releases the finished jobs older than the proofTTL.
+// This method is designed to be called in a goroutine
+func (a *api) cleanup() {
+	if a.retention.proofTTL == 0 {
+		return
+	}
+	for {
+		if err := a.releaseExpired(); err != nil {
+			log.Error(err)
+		}
+		time.Sleep(cleanupInterval * time.Second)
+	}
+}
+
+// releaseExpired releases the finished jobs older than the proofTTL
+func (a *api) releaseExpired() error {
+	expired, err := a.jobs.finishedBefore(time.Now().Add(-a.retention.proofTTL))
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(expired); i++ {
+		if err := a.releaseJob(expired[i].ID); err != nil {
+			return err
+		}
+		log.Debugw("expired job files removed", "id", expired[i].ID)
+	}
+	return nil
+}
+
+// diskUsage returns the size in bytes of the files under the given directory
+func diskUsage(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/pebbledb"
+)
+
+func TestRetention(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	jobs, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	a := &api{
+		jobs:    jobs,
+		jobsDir: c.TempDir(),
+		retention: retention{
+			proofTTL: time.Hour,
+		},
+	}
+
+	// two finished jobs, with all their files
+	for i := uint64(1); i <= 2; i++ {
+		_, err = jobs.add("", "default", nil, []byte("zkinputs"))
+		c.Assert(err, qt.IsNil)
+		_, err = jobs.claim()
+		c.Assert(err, qt.IsNil)
+		err = jobs.setStatus(i, jobStatusDone, "")
+		c.Assert(err, qt.IsNil)
+
+		err = os.MkdirAll(a.jobDir(i), 0750)
+		c.Assert(err, qt.IsNil)
+		for _, f := range []string{fileZKInputs, fileWitness, fileProof, filePublic} {
+			err = ioutil.WriteFile(a.jobFile(i, f), make([]byte, 10), 0600)
+			c.Assert(err, qt.IsNil)
+		}
+	}
+	usage, err := diskUsage(a.jobsDir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(usage, qt.Equals, uint64(80))
+
+	// the witness is removed unless it has to be kept
+	a.retention.keepWitness = true
+	a.removeWitness(1)
+	_, err = os.Stat(a.jobFile(1, fileWitness))
+	c.Assert(err, qt.IsNil)
+	a.retention.keepWitness = false
+	a.removeWitness(1)
+	_, err = os.Stat(a.jobFile(1, fileWitness))
+	c.Assert(os.IsNotExist(err), qt.IsTrue)
+
+	// the confirmed retrievals are released unless they have to be kept
+	a.retention.keepRetrieved = true
+	err = a.retrieved(1)
+	c.Assert(err, qt.IsNil)
+	_, err = jobs.get(1)
+	c.Assert(err, qt.IsNil)
+	a.retention.keepRetrieved = false
+	err = a.retrieved(1)
+	c.Assert(err, qt.IsNil)
+	_, err = jobs.get(1)
+	c.Assert(err, qt.Equals, errJobNotFound)
+	_, err = os.Stat(a.jobDir(1))
+	c.Assert(os.IsNotExist(err), qt.IsTrue)
+	_, err = jobs.zkInputs(1)
+	c.Assert(err, qt.Equals, errNoZKInputsInDB)
+
+	// the job 2 has not expired yet
+	err = a.releaseExpired()
+	c.Assert(err, qt.IsNil)
+	usage, err = diskUsage(a.jobsDir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(usage, qt.Equals, uint64(40))
+
+	a.retention.proofTTL = time.Nanosecond
+	err = a.releaseExpired()
+	c.Assert(err, qt.IsNil)
+	_, err = jobs.get(2)
+	c.Assert(err, qt.Equals, errJobNotFound)
+	usage, err = diskUsage(a.jobsDir)
+	c.Assert(err, qt.IsNil)
+	c.Assert(usage, qt.Equals, uint64(0))
+
+	expired, err := jobs.finishedBefore(time.Now())
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(expired), qt.Equals, 0)
+}
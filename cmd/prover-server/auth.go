@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aragon/ovote-node/prover"
+	"github.com/gin-gonic/gin"
+	"go.vocdoni.io/dvote/log"
+)
+
+// clientCtxKey is the key of the gin context where the ID of the
+// authenticated client is stored
+const clientCtxKey = "client"
+
+// clientConfig contains the configuration of a client of the prover-server
+type clientConfig struct {
+	// Secret is shared with the client to authenticate its requests, and
+	// to sign the proof completion callbacks sent to it
+	Secret string `json:"secret"`
+	// CallbackURL is the base url of the client API, to which the proof
+	// completion callbacks are sent. If empty, the client can not request
+	// callbacks.
+	CallbackURL string `json:"callbackURL"`
+}
+
+// UnmarshalJSON accepts the client config as an object, or as the string of
+// its secret
+func (cc *clientConfig) UnmarshalJSON(b []byte) error {
+	var secret string
+	if err := json.Unmarshal(b, &secret); err == nil {
+		*cc = clientConfig{Secret: secret}
+		return nil
+	}
+	type config clientConfig
+	return json.Unmarshal(b, (*config)(cc))
+}
+
+// loadClients reads the clients allowed to use the prover-server from the
+// given json config file, which maps each client ID to its config
+func loadClients(path string) (map[string]clientConfig, error) {
+	b, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var clients map[string]clientConfig
+	if err := json.Unmarshal(b, &clients); err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no clients defined in %s", path)
+	}
+	for id, client := range clients {
+		if id == "" || client.Secret == "" {
+			return nil, fmt.Errorf("client without id or secret in %s", path)
+		}
+		if client.CallbackURL != "" {
+			u, err := url.Parse(client.CallbackURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+				u.Host == "" {
+				return nil, fmt.Errorf("invalid callback url of client %q in %s",
+					id, path)
+			}
+		}
+	}
+	return clients, nil
+}
+
+// nonceCache keeps the nonces of the authenticated requests during the window
+// in which their signature is accepted, to reject the replayed requests
+type nonceCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	nonces map[string]time.Time
+	// lastPrune is the time at which the expired nonces were last removed
+	lastPrune time.Time
+}
+
+// newNonceCache returns a nonceCache that keeps the nonces for the window of
+// the request timestamps accepted by prover.VerifyRequest
+func newNonceCache() *nonceCache {
+	return &nonceCache{
+		ttl:       2 * prover.AuthMaxClockSkew,
+		nonces:    make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// use stores the given nonce of the given client, returning
+// prover.ErrRequestReplayed if it has already been used
+func (n *nonceCache) use(clientID, nonce string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if now.Sub(n.lastPrune) > n.ttl {
+		for k, expiry := range n.nonces {
+			if now.After(expiry) {
+				delete(n.nonces, k)
+			}
+		}
+		n.lastPrune = now
+	}
+	key := clientID + "/" + nonce
+	if expiry, ok := n.nonces[key]; ok && now.Before(expiry) {
+		return prover.ErrRequestReplayed
+	}
+	n.nonces[key] = now.Add(n.ttl)
+	return nil
+}
+
+func unauthorized(c *gin.Context, err error) {
+	log.Warnw("HTTP API unauthorized request", "err", err)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, errorMsg{
+		Message: err.Error(),
+	})
+}
+
+// authenticate checks the signature of the request with the secret of its
+// client, rejecting the requests whose nonce has already been used, and
+// stores the client ID in the context. If there are no clients configured,
+// the requests are not authenticated.
+func (a *api) authenticate(c *gin.Context) {
+	if len(a.clients) == 0 {
+		return
+	}
+	clientID := c.GetHeader(prover.AuthClientHeader)
+	client, ok := a.clients[clientID]
+	if !ok {
+		unauthorized(c, fmt.Errorf("unknown client %q", clientID))
+		return
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		returnErr(c, err)
+		c.Abort()
+		return
+	}
+	// restore the body for the handler
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = prover.VerifyRequest([]byte(client.Secret), c.Request.Method,
+		c.Request.URL.RequestURI(), c.GetHeader(prover.AuthTimestampHeader),
+		c.GetHeader(prover.AuthNonceHeader), body,
+		c.GetHeader(prover.AuthSignatureHeader))
+	if err != nil {
+		unauthorized(c, err)
+		return
+	}
+	// the nonce is only stored once the signature is valid
+	if err := a.nonces.use(clientID, c.GetHeader(prover.AuthNonceHeader)); err != nil {
+		unauthorized(c, err)
+		return
+	}
+	c.Set(clientCtxKey, clientID)
+}
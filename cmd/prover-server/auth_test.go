@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/prover"
+	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
+	"go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/pebbledb"
+)
+
+func TestLoadClients(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(c.TempDir(), "clients.json")
+	err := ioutil.WriteFile(path, []byte(`{"node0": "secret0",
+		"node1": {"secret": "secret1", "callbackURL": "https://node1:8080"}}`), 0600)
+	c.Assert(err, qt.IsNil)
+	clients, err := loadClients(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(clients, qt.DeepEquals, map[string]clientConfig{
+		"node0": {Secret: "secret0"},
+		"node1": {Secret: "secret1", CallbackURL: "https://node1:8080"},
+	})
+
+	err = ioutil.WriteFile(path, []byte(`{"node0": {"secret": "secret0",
+		"callbackURL": "node0:8080"}}`), 0600)
+	c.Assert(err, qt.IsNil)
+	_, err = loadClients(path)
+	c.Assert(err, qt.ErrorMatches, "invalid callback url of client \"node0\" in .*")
+
+	err = ioutil.WriteFile(path, []byte(`{"node0": ""}`), 0600)
+	c.Assert(err, qt.IsNil)
+	_, err = loadClients(path)
+	c.Assert(err, qt.ErrorMatches, "client without id or secret in .*")
+
+	err = ioutil.WriteFile(path, []byte(`{}`), 0600)
+	c.Assert(err, qt.IsNil)
+	_, err = loadClients(path)
+	c.Assert(err, qt.ErrorMatches, "no clients defined in .*")
+}
+
+func TestAuthenticate(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	jobs, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	a := &api{
+		r:    gin.Default(),
+		jobs: jobs,
+		clients: map[string]clientConfig{
+			"node0": {Secret: "secret0"},
+			"node1": {Secret: "secret1"},
+		},
+		nonces: newNonceCache(),
+	}
+	proof := a.r.Group("/proof", a.authenticate)
+	proof.GET("/:id/status", a.getProofStatus)
+	ts := httptest.NewServer(a.r)
+	defer ts.Close()
+
+	j, err := jobs.add("node0", "default", nil, []byte("zkinputs"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Client, qt.Equals, "node0")
+
+	do := func(req *http.Request) int {
+		resp, err := http.DefaultClient.Do(req)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resp.Body.Close(), qt.IsNil)
+		return resp.StatusCode
+	}
+	newRequest := func(clientID string, secret []byte) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/proof/1/status", nil)
+		c.Assert(err, qt.IsNil)
+		if secret != nil {
+			err = prover.SignRequest(req, clientID, secret, nil)
+			c.Assert(err, qt.IsNil)
+		}
+		return req
+	}
+	getStatus := func(clientID string, secret []byte) int {
+		return do(newRequest(clientID, secret))
+	}
+
+	c.Assert(getStatus("node0", []byte("secret0")), qt.Equals, http.StatusOK)
+	// the jobs of other clients are not found
+	c.Assert(getStatus("node1", []byte("secret1")), qt.Equals, http.StatusNotFound)
+	// unsigned, unknown client or wrong secret
+	c.Assert(getStatus("", nil), qt.Equals, http.StatusUnauthorized)
+	c.Assert(getStatus("node2", []byte("secret0")), qt.Equals, http.StatusUnauthorized)
+	c.Assert(getStatus("node0", []byte("secret1")), qt.Equals, http.StatusUnauthorized)
+
+	// a signed request can not be replayed
+	req := newRequest("node0", []byte("secret0"))
+	c.Assert(do(req), qt.Equals, http.StatusOK)
+	c.Assert(do(req), qt.Equals, http.StatusUnauthorized)
+	// nor sent without nonce
+	req = newRequest("node0", []byte("secret0"))
+	req.Header.Del(prover.AuthNonceHeader)
+	c.Assert(do(req), qt.Equals, http.StatusUnauthorized)
+}
+
+func TestNonceCache(t *testing.T) {
+	c := qt.New(t)
+
+	n := newNonceCache()
+	c.Assert(n.use("node0", "nonce0"), qt.IsNil)
+	c.Assert(n.use("node0", "nonce0"), qt.Equals, prover.ErrRequestReplayed)
+	// the nonces are kept per client
+	c.Assert(n.use("node1", "nonce0"), qt.IsNil)
+
+	// the expired nonces are removed
+	n.ttl = time.Millisecond
+	n.nonces["node0/nonce0"] = time.Now().Add(-time.Second)
+	n.lastPrune = time.Now().Add(-time.Second)
+	c.Assert(n.use("node0", "nonce1"), qt.IsNil)
+	_, ok := n.nonces["node0/nonce0"]
+	c.Assert(ok, qt.IsFalse)
+	c.Assert(n.use("node0", "nonce0"), qt.IsNil)
+}
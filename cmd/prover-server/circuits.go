@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
+)
+
+// circuit contains the metadata and the paths to the artifacts of a circuit
+// used to generate the proofs
+type circuit struct {
+	Name      string `json:"name"`
+	NMaxVotes int    `json:"nMaxVotes"`
+	NLevels   int    `json:"nLevels"`
+	// Wasm is the path to the circuit wasm
+	Wasm string `json:"wasm"`
+	// WitnessGenerator is the path to the generate_witness.js of the
+	// circuit
+	WitnessGenerator string `json:"witnessGenerator"`
+	// Zkey is the path to the proving key
+	Zkey string `json:"zkey"`
+	// VerificationKey is the path to the verification key
+	VerificationKey string `json:"verificationKey"`
+	// vk is the verification key loaded at startup
+	vk *prover.VerificationKey
+}
+
+// circuitInfo is the public view of a circuit, without the paths to its
+// artifacts in the server
+type circuitInfo struct {
+	Name      string `json:"name"`
+	NMaxVotes int    `json:"nMaxVotes"`
+	NLevels   int    `json:"nLevels"`
+}
+
+// circuitsInfo returns the public view of the given circuits
+func circuitsInfo(circuits []circuit) []circuitInfo {
+	infos := make([]circuitInfo, len(circuits))
+	for i := 0; i < len(circuits); i++ {
+		infos[i] = circuitInfo{
+			Name:      circuits[i].Name,
+			NMaxVotes: circuits[i].NMaxVotes,
+			NLevels:   circuits[i].NLevels,
+		}
+	}
+	return infos
+}
+
+// defaultCircuits returns the circuit placed at the current directory, used
+// when no circuits config file is given
+func defaultCircuits() []circuit {
+	return []circuit{{
+		Name:             "default",
+		NMaxVotes:        128, //nolint:gomnd
+		NLevels:          7,   //nolint:gomnd
+		Wasm:             "circuit.wasm",
+		WitnessGenerator: "./circuit_js/generate_witness.js",
+		Zkey:             "circuit.zkey",
+		VerificationKey:  "verification_key.json",
+	}}
+}
+
+// loadCircuits reads the circuits from the given json config file
+func loadCircuits(path string) ([]circuit, error) {
+	b, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var circuits []circuit
+	if err := json.Unmarshal(b, &circuits); err != nil {
+		return nil, err
+	}
+	if len(circuits) == 0 {
+		return nil, fmt.Errorf("no circuits defined in %s", path)
+	}
+
+	names := make(map[string]bool)
+	for _, c := range circuits {
+		if c.Name == "" {
+			return nil, fmt.Errorf("circuit without name in %s", path)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("circuit %s defined more than once", c.Name)
+		}
+		names[c.Name] = true
+		if c.NMaxVotes <= 0 || c.NLevels <= 0 {
+			return nil, fmt.Errorf("circuit %s: invalid nMaxVotes: %d,"+
+				" nLevels: %d", c.Name, c.NMaxVotes, c.NLevels)
+		}
+		if c.Wasm == "" || c.WitnessGenerator == "" || c.Zkey == "" ||
+			c.VerificationKey == "" {
+			return nil, fmt.Errorf("circuit %s: missing artifact paths", c.Name)
+		}
+	}
+	return circuits, nil
+}
+
+// loadVerificationKeys loads the verification keys of the given circuits, so
+// that a missing key is detected at startup instead of failing every job
+func loadVerificationKeys(circuits []circuit) error {
+	for i := 0; i < len(circuits); i++ {
+		vk, err := prover.LoadVerificationKey(circuits[i].VerificationKey)
+		if err != nil {
+			return fmt.Errorf("circuit %s: can not load the verification key"+
+				" (it can be exported with `snarkjs zkey export verificationkey"+
+				" %s %s`): %w", circuits[i].Name, circuits[i].Zkey,
+				circuits[i].VerificationKey, err)
+		}
+		circuits[i].vk = vk
+	}
+	return nil
+}
+
+// findCircuit returns the circuit with the given name. If no name is given,
+// returns the circuit that matches the shape of the given ZKInputs.
+func findCircuit(circuits []circuit, name string, zki *types.ZKInputs) (*circuit, error) {
+	nMaxVotes, nLevels := zki.Meta.NMaxVotes, zki.Meta.NLevels
+	for i := 0; i < len(circuits); i++ {
+		c := &circuits[i]
+		if name != "" && c.Name != name {
+			continue
+		}
+		if c.NMaxVotes == nMaxVotes && c.NLevels == nLevels {
+			return c, nil
+		}
+		if name != "" {
+			return nil, fmt.Errorf("zkInputs (nMaxVotes: %d, nLevels: %d)"+
+				" do not match the circuit %s (nMaxVotes: %d, nLevels: %d)",
+				nMaxVotes, nLevels, c.Name, c.NMaxVotes, c.NLevels)
+		}
+	}
+	if name != "" {
+		return nil, fmt.Errorf("circuit %s not found", name)
+	}
+	return nil, fmt.Errorf("no circuit found for the zkInputs"+
+		" (nMaxVotes: %d, nLevels: %d)", nMaxVotes, nLevels)
+}
+
+// getCircuit returns the circuit with the given name
+func getCircuit(circuits []circuit, name string) (*circuit, error) {
+	for i := 0; i < len(circuits); i++ {
+		if circuits[i].Name == name {
+			return &circuits[i], nil
+		}
+	}
+	return nil, fmt.Errorf("circuit %s not found", name)
+}
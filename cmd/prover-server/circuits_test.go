@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestLoadAndFindCircuits(t *testing.T) {
+	c := qt.New(t)
+
+	path := filepath.Join(c.TempDir(), "circuits.json")
+	err := ioutil.WriteFile(path, []byte(`[
+		{"name": "small", "nMaxVotes": 16, "nLevels": 4,
+		"wasm": "small.wasm", "witnessGenerator": "small_js/generate_witness.js",
+		"zkey": "small.zkey", "verificationKey": "small_vk.json"},
+		{"name": "big", "nMaxVotes": 128, "nLevels": 7,
+		"wasm": "big.wasm", "witnessGenerator": "big_js/generate_witness.js",
+		"zkey": "big.zkey", "verificationKey": "big_vk.json"}
+	]`), 0600)
+	c.Assert(err, qt.IsNil)
+
+	circuits, err := loadCircuits(path)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(circuits), qt.Equals, 2)
+	c.Assert(circuits[0].Zkey, qt.Equals, "small.zkey")
+
+	// without name, the circuit is selected by the zkInputs shape
+	circ, err := findCircuit(circuits, "", types.NewZKInputs(128, 7))
+	c.Assert(err, qt.IsNil)
+	c.Assert(circ.Name, qt.Equals, "big")
+
+	circ, err = findCircuit(circuits, "small", types.NewZKInputs(16, 4))
+	c.Assert(err, qt.IsNil)
+	c.Assert(circ.Name, qt.Equals, "small")
+
+	_, err = findCircuit(circuits, "small", types.NewZKInputs(128, 7))
+	c.Assert(err.Error(), qt.Equals, "zkInputs (nMaxVotes: 128, nLevels: 7)"+
+		" do not match the circuit small (nMaxVotes: 16, nLevels: 4)")
+	_, err = findCircuit(circuits, "medium", types.NewZKInputs(16, 4))
+	c.Assert(err.Error(), qt.Equals, "circuit medium not found")
+	_, err = findCircuit(circuits, "", types.NewZKInputs(8, 3))
+	c.Assert(err.Error(), qt.Equals, "no circuit found for the zkInputs"+
+		" (nMaxVotes: 8, nLevels: 3)")
+
+	// duplicated names are rejected
+	err = ioutil.WriteFile(path, []byte(`[
+		{"name": "small", "nMaxVotes": 16, "nLevels": 4,
+		"wasm": "a", "witnessGenerator": "b", "zkey": "c", "verificationKey": "d"},
+		{"name": "small", "nMaxVotes": 16, "nLevels": 4,
+		"wasm": "a", "witnessGenerator": "b", "zkey": "c", "verificationKey": "d"}
+	]`), 0600)
+	c.Assert(err, qt.IsNil)
+	_, err = loadCircuits(path)
+	c.Assert(err.Error(), qt.Equals, "circuit small defined more than once")
+}
+
+func TestLoadVerificationKeys(t *testing.T) {
+	c := qt.New(t)
+
+	// the default circuit requires the verification key in the current
+	// directory
+	circuits := defaultCircuits()
+	circuits[0].VerificationKey = filepath.Join(c.TempDir(), "verification_key.json")
+	err := loadVerificationKeys(circuits)
+	c.Assert(err, qt.ErrorMatches, "circuit default: can not load the verification"+
+		" key .*snarkjs zkey export verificationkey circuit.zkey .*")
+
+	g := test.GenGroth16(c, []*big.Int{big.NewInt(1)})
+	err = ioutil.WriteFile(circuits[0].VerificationKey, g.VerificationKey, 0600)
+	c.Assert(err, qt.IsNil)
+	err = loadVerificationKeys(circuits)
+	c.Assert(err, qt.IsNil)
+	c.Assert(circuits[0].vk.VerifyBytes(g.Proof, g.PublicInputs), qt.IsNil)
+}
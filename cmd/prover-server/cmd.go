@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/aragon/ovote-node/types"
 	"github.com/gin-gonic/gin"
@@ -15,19 +19,59 @@ import (
 	"go.vocdoni.io/dvote/log"
 )
 
-var port, dir string
+var (
+	port, dir, circuitsPath    string
+	nodeBin, proverBin         string
+	nWorkers                   int
+	clientsPath                string
+	keepWitness, keepRetrieved bool
+	proofRetention             time.Duration
+)
 
 type api struct {
-	r *gin.Engine
-	sync.Mutex
+	r        *gin.Engine
+	jobs     *jobQueue
+	circuits []circuit
+	// jobsDir is the directory where the files of each job are stored
+	jobsDir   string
+	retention retention
+	// nodeBin & proverBin are the paths to the node.js binary (used to
+	// generate the witness) and to the prover binary
+	nodeBin, proverBin string
 
-	lastID int
-	db     db.Database
+	// nWorkers determines the number of jobs processed concurrently
+	nWorkers int
+	// clients contains the config of each client ID, with the secret used
+	// to authenticate the requests and to sign the callbacks. If empty, the
+	// requests are not authenticated and the callbacks are not allowed.
+	clients map[string]clientConfig
+	// nonces contains the nonces of the authenticated requests
+	nonces *nonceCache
+	// mu protects busyWorkers, avgJobTime & running
+	mu          sync.Mutex
+	busyWorkers int
+	avgJobTime  time.Duration
+	// running contains the functions that cancel the running jobs
+	running map[uint64]context.CancelFunc
 }
 
 func main() {
 	flag.StringVarP(&port, "port", "p", "9000", "network port for the HTTP API")
 	flag.StringVarP(&dir, "dir", "d", "~/.proverserver", "db & files directory")
+	flag.IntVarP(&nWorkers, "workers", "w", defaultNWorkers(),
+		"number of proofs generated concurrently")
+	flag.StringVar(&circuitsPath, "circuits", "",
+		"circuits json config file (default: circuit in the current directory)")
+	flag.StringVar(&nodeBin, "node", "node", "node.js binary path")
+	flag.StringVar(&proverBin, "prover", "./prover", "prover binary path")
+	flag.StringVar(&clientsPath, "clients", "",
+		"clients json config file, with the secret shared with each node to authenticate its requests")
+	flag.BoolVar(&keepWitness, "keepwitness", false,
+		"keep the witness files once the proofs are generated")
+	flag.DurationVar(&proofRetention, "proofretention", 7*24*time.Hour,
+		"time after which the files of the finished jobs are removed (0 keeps them forever)")
+	flag.BoolVar(&keepRetrieved, "keepretrieved", false,
+		"keep the proof files once the node confirms their retrieval, until they expire")
 	flag.Parse()
 
 	opts := db.Options{Path: dir}
@@ -36,15 +80,63 @@ func main() {
 		log.Fatal(err)
 	}
 
+	jobs, err := newJobQueue(database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if nWorkers < 1 {
+		log.Fatalf("invalid number of workers: %d", nWorkers)
+	}
+	circuits := defaultCircuits()
+	if circuitsPath != "" {
+		circuits, err = loadCircuits(circuitsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := loadVerificationKeys(circuits); err != nil {
+		log.Fatal(err)
+	}
+
+	var clients map[string]clientConfig
+	if clientsPath != "" {
+		clients, err = loadClients(clientsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Warn("no clients config file given, the requests will not be authenticated")
+	}
+
 	a := api{}
-	a.db = database
+	a.clients = clients
+	a.nonces = newNonceCache()
+	a.jobs = jobs
+	a.jobsDir = filepath.Join(dir, "jobs")
+	a.retention = retention{
+		keepWitness:   keepWitness,
+		keepRetrieved: keepRetrieved,
+		proofTTL:      proofRetention,
+	}
+	a.circuits = circuits
+	a.nodeBin = nodeBin
+	a.proverBin = proverBin
+	a.nWorkers = nWorkers
+	a.running = make(map[uint64]context.CancelFunc)
 	a.r = gin.Default()
-	a.lastID = 0
 
 	a.r.GET("/status", a.getStatus)
-	a.r.POST("/proof", a.genProof)
-	a.r.GET("/proof/:id", a.getProof)
-	a.r.GET("/proof/:id/public", a.getPublicInputs)
+	a.r.GET("/circuits", a.getCircuits)
+	proof := a.r.Group("/proof", a.authenticate)
+	proof.POST("", a.postProof)
+	proof.GET("/:id", a.getProof)
+	proof.GET("/:id/status", a.getProofStatus)
+	proof.GET("/:id/public", a.getPublicInputs)
+	proof.DELETE("/:id", a.deleteProof)
+
+	a.startWorkers()
+	go a.cleanup()
 
 	err = a.r.Run(":" + port)
 	if err != nil {
@@ -63,60 +155,214 @@ func returnErr(c *gin.Context, err error) {
 	})
 }
 
+type statusMsg struct {
+	// Status is "busy" when a new job would have to wait for a worker
+	Status      string `json:"status"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busyWorkers"`
+	Queued      int    `json:"queued"`
+	// EstimatedWait is the estimated number of seconds until a new job
+	// would start being processed
+	EstimatedWait uint64 `json:"estimatedWait"`
+	// DiskUsage is the size in bytes of the files of the jobs
+	DiskUsage uint64 `json:"diskUsage"`
+}
+
 func (a *api) getStatus(c *gin.Context) {
-	if !a.isBusy() {
-		c.JSON(http.StatusLocked, gin.H{
-			"status": "prover busy",
-		})
+	queued, err := a.jobs.countQueued()
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	busyWorkers, _ := a.workersStatus()
+	usage, err := diskUsage(a.jobsDir)
+	if err != nil {
+		returnErr(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
+	status := "ok"
+	if busyWorkers+queued >= a.nWorkers {
+		status = "busy"
+	}
+	c.JSON(http.StatusOK, statusMsg{
+		Status:        status,
+		Workers:       a.nWorkers,
+		BusyWorkers:   busyWorkers,
+		Queued:        queued,
+		EstimatedWait: uint64(a.estimatedWait(busyWorkers, queued).Seconds()),
+		DiskUsage:     usage,
 	})
 }
 
-func (a *api) genProof(c *gin.Context) {
-	a.lastID++
-
-	if !a.isBusy() {
-		c.JSON(http.StatusLocked, gin.H{
-			"status": "prover busy",
-		})
-	}
+func (a *api) getCircuits(c *gin.Context) {
+	// the paths to the artifacts are not exposed
+	c.JSON(http.StatusOK, circuitsInfo(a.circuits))
+}
 
-	// get zkinputs.json and store it in disk
+func (a *api) postProof(c *gin.Context) {
+	// get zkinputs.json and store it in the jobs queue
 	var zki types.ZKInputs
 	if err := c.ShouldBindJSON(&zki); err != nil {
 		returnErr(c, err)
 		return
 	}
+	if err := zki.Validate(); err != nil {
+		returnErr(c, fmt.Errorf("invalid zkInputs: %w", err))
+		return
+	}
+	// the circuit can be selected by name, if not, the one matching the
+	// zkInputs is used
+	circ, err := findCircuit(a.circuits, c.Query("circuit"), &zki)
+	if err != nil {
+		returnErr(c, err)
+		return
+	}
+	// the callback url of the client is notified with the signed proof once
+	// generated. The processID & prover are not used by the prover-server,
+	// but included in the signed callback.
+	var callback *jobCallback
+	if c.Query("callback") == "true" {
+		clientID := c.GetString(clientCtxKey)
+		callbackURL := a.clients[clientID].CallbackURL
+		if callbackURL == "" {
+			returnErr(c, fmt.Errorf("callbacks are not enabled for client %q",
+				clientID))
+			return
+		}
+		processID, err := strconv.ParseUint(c.Query("processid"), 10, 64)
+		if err != nil {
+			returnErr(c, fmt.Errorf("invalid processid: %w", err))
+			return
+		}
+		if c.Query("prover") == "" {
+			returnErr(c, fmt.Errorf("prover is required with callback"))
+			return
+		}
+		callback = &jobCallback{
+			URL: fmt.Sprintf("%s/proof/%d/callback",
+				strings.TrimSuffix(callbackURL, "/"), processID),
+			ProcessID: processID,
+			Prover:    c.Query("prover"),
+		}
+	}
 	file, err := json.MarshalIndent(zki, "", " ")
 	if err != nil {
 		returnErr(c, err)
 		return
 	}
-	err = ioutil.WriteFile("zkinputs"+strconv.Itoa(a.lastID)+".json",
-		file, 0600)
+	j, err := a.jobs.add(c.GetString(clientCtxKey), circ.Name, callback, file)
 	if err != nil {
 		returnErr(c, err)
 		return
 	}
 
-	go a.genWitnessAndProof(strconv.Itoa(a.lastID))
-
 	// return the id, so the client knows which id to use to
 	// retrieve the proof later
 	c.JSON(http.StatusOK, gin.H{
-		"id": a.lastID,
+		"id": j.ID,
 	})
 }
 
+// getJob returns the job of the id param. If the job can not be returned, the
+// error response is written and nil is returned.
+func (a *api) getJob(c *gin.Context) *job {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		returnErr(c, err)
+		return nil
+	}
+	j, err := a.jobs.get(id)
+	// the jobs of other clients are not exposed
+	if err == nil && j.Client != c.GetString(clientCtxKey) {
+		err = errJobNotFound
+	}
+	if err == errJobNotFound {
+		c.JSON(http.StatusNotFound, errorMsg{
+			Message: fmt.Sprintf("%s, id: %d", err, id),
+		})
+		return nil
+	}
+	if err != nil {
+		returnErr(c, err)
+		return nil
+	}
+	return j
+}
+
+// getDoneJob returns the job of the id param if its proof has been generated.
+// If not, the error response is written and nil is returned.
+func (a *api) getDoneJob(c *gin.Context) *job {
+	j := a.getJob(c)
+	if j == nil {
+		return nil
+	}
+	switch j.Status {
+	case jobStatusDone:
+		return j
+	case jobStatusFailed:
+		returnErr(c, fmt.Errorf("proof generation failed, id: %d, error: %s",
+			j.ID, j.Error))
+	default:
+		// the clients retry the proofs not ready, identified by the
+		// status code
+		c.JSON(http.StatusConflict, errorMsg{
+			Message: fmt.Sprintf("proof not ready, id: %d, status: %s",
+				j.ID, j.Status),
+		})
+	}
+	return nil
+}
+
+func (a *api) getProofStatus(c *gin.Context) {
+	j := a.getJob(c)
+	if j == nil {
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
 func (a *api) getProof(c *gin.Context) {
-	idStr := c.Param("id")
-	c.File("proof" + idStr + ".json")
+	j := a.getDoneJob(c)
+	if j == nil {
+		return
+	}
+	c.File(a.jobFile(j.ID, fileProof))
 }
 
 func (a *api) getPublicInputs(c *gin.Context) {
-	idStr := c.Param("id")
-	c.File("public" + idStr + ".json")
+	j := a.getDoneJob(c)
+	if j == nil {
+		return
+	}
+	c.File(a.jobFile(j.ID, filePublic))
+}
+
+// deleteProof cancels the job of the id param, killing its subprocess if it is
+// running, and removes its files. For the finished jobs, it confirms the
+// retrieval of the proof, whose files are removed unless they have to be kept.
+func (a *api) deleteProof(c *gin.Context) {
+	j := a.getJob(c)
+	if j == nil {
+		return
+	}
+	if j.Status == jobStatusDone || j.Status == jobStatusFailed {
+		if err := a.retrieved(j.ID); err != nil {
+			returnErr(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, fmt.Sprintf("proof released, id: %d", j.ID))
+		return
+	}
+	if err := a.jobs.cancel(j.ID); err != nil {
+		returnErr(c, err)
+		return
+	}
+	// the files of a running job are removed by its worker, once the
+	// subprocess has been stopped
+	a.killJob(j.ID)
+	if j.Status == jobStatusQueued {
+		a.removeJobFiles(j.ID)
+	}
+	c.JSON(http.StatusOK, fmt.Sprintf("proof generation cancelled, id: %d", j.ID))
 }
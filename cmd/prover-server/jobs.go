@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.vocdoni.io/dvote/db"
+)
+
+// jobStatus determines the stage of the lifecycle of a proof generation job
+type jobStatus string
+
+const (
+	// jobStatusQueued indicates that the job is waiting to be processed
+	jobStatusQueued jobStatus = "queued"
+	// jobStatusWitness indicates that the witness is being computed
+	jobStatusWitness jobStatus = "witness"
+	// jobStatusProving indicates that the proof is being computed
+	jobStatusProving jobStatus = "proving"
+	// jobStatusDone indicates that the proof has been generated
+	jobStatusDone jobStatus = "done"
+	// jobStatusFailed indicates that the proof generation failed, the
+	// reason is stored in the job Error
+	jobStatusFailed jobStatus = "failed"
+	// jobStatusCancelled indicates that the job has been cancelled by the
+	// client
+	jobStatusCancelled jobStatus = "cancelled"
+)
+
+var (
+	dbKeyLastID      = []byte("lastID")
+	dbPrefixJob      = []byte("job/")
+	dbPrefixZKInputs = []byte("zkinputs/")
+	// dbPrefixQueued & dbPrefixFinished index the ids of the queued and of
+	// the finished jobs, so that they are found without decoding all the
+	// jobs
+	dbPrefixQueued   = []byte("queued/")
+	dbPrefixFinished = []byte("finished/")
+
+	errJobNotFound    = errors.New("job not found")
+	errNoZKInputsInDB = errors.New("zkinputs not found")
+	errJobCancelled   = errors.New("job cancelled")
+)
+
+// job contains the state of a proof generation
+type job struct {
+	ID uint64 `json:"id"`
+	// Client is the ID of the client that submitted the job
+	Client string `json:"client,omitempty"`
+	// Circuit is the name of the circuit used to generate the proof
+	Circuit string `json:"circuit"`
+	// Callback is the url to which the proof is sent once generated
+	Callback string `json:"callback,omitempty"`
+	// ProcessID & Prover are given by the client that requests the
+	// callback, and included in the signed callback
+	ProcessID uint64    `json:"processID,omitempty"`
+	Prover    string    `json:"prover,omitempty"`
+	Status    jobStatus `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Removed was set by the previous versions to the jobs whose files had
+	// been removed, which are now deleted
+	Removed bool `json:"removed,omitempty"`
+}
+
+// finished returns true if the job can not be processed anymore
+func (j *job) finished() bool {
+	switch j.Status {
+	case jobStatusDone, jobStatusFailed, jobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// jobQueue keeps the proof generation jobs persisted in the db, so that after
+// a restart the pending jobs are processed and the ids are not reused
+type jobQueue struct {
+	mu sync.Mutex
+	db db.Database
+	// newJobs is used to notify the workers that a new job has been queued
+	newJobs chan struct{}
+}
+
+// newJobQueue loads the jobQueue from the given db. The jobs that were being
+// processed when the server stopped are queued again. The indexes of the jobs
+// are rebuilt, and the jobs removed by previous versions are deleted.
+func newJobQueue(database db.Database) (*jobQueue, error) {
+	q := &jobQueue{
+		db:      database,
+		newJobs: make(chan struct{}, 1),
+	}
+
+	var jobs []job
+	var errIter error
+	err := database.Iterate(dbPrefixJob, func(_, v []byte) bool {
+		var j job
+		if errIter = json.Unmarshal(v, &j); errIter != nil {
+			return false
+		}
+		jobs = append(jobs, j)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errIter != nil {
+		return nil, errIter
+	}
+
+	wTx := database.WriteTx()
+	defer wTx.Discard()
+	for i := 0; i < len(jobs); i++ {
+		j := &jobs[i]
+		if j.Removed {
+			if err := deleteJob(wTx, j.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if j.Status == jobStatusWitness || j.Status == jobStatusProving {
+			j.Status = jobStatusQueued
+			j.UpdatedAt = time.Now()
+		}
+		if err := setJob(wTx, j); err != nil {
+			return nil, err
+		}
+	}
+	if err := wTx.Commit(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func jobKey(prefix []byte, id uint64) []byte {
+	var idBytes [8]byte
+	binary.BigEndian.PutUint64(idBytes[:], id)
+	return append(append([]byte{}, prefix...), idBytes[:]...)
+}
+
+// setJob stores the given job, and updates its indexes
+func setJob(wTx db.WriteTx, j *job) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := wTx.Set(jobKey(dbPrefixJob, j.ID), b); err != nil {
+		return err
+	}
+	if err := setIndex(wTx, dbPrefixQueued, j.ID,
+		j.Status == jobStatusQueued); err != nil {
+		return err
+	}
+	return setIndex(wTx, dbPrefixFinished, j.ID, j.finished())
+}
+
+// setIndex adds or removes the given id to the index of the given prefix
+func setIndex(wTx db.WriteTx, prefix []byte, id uint64, indexed bool) error {
+	if indexed {
+		return wTx.Set(jobKey(prefix, id), []byte{})
+	}
+	return wTx.Delete(jobKey(prefix, id))
+}
+
+// deleteJob deletes the job with the given id, together with its zkInputs and
+// indexes
+func deleteJob(wTx db.WriteTx, id uint64) error {
+	prefixes := [][]byte{dbPrefixJob, dbPrefixZKInputs, dbPrefixQueued,
+		dbPrefixFinished}
+	for i := 0; i < len(prefixes); i++ {
+		if err := wTx.Delete(jobKey(prefixes[i], id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedIDs returns the ids of the index of the given prefix, in ascending
+// order, up to the given limit (zero for no limit)
+func (q *jobQueue) indexedIDs(prefix []byte, limit int) ([]uint64, error) {
+	var ids []uint64
+	err := q.db.Iterate(prefix, func(k, _ []byte) bool {
+		ids = append(ids, binary.BigEndian.Uint64(k))
+		return limit == 0 || len(ids) < limit
+	})
+	return ids, err
+}
+
+// jobCallback contains the proof completion callback requested for a job
+type jobCallback struct {
+	URL       string
+	ProcessID uint64
+	Prover    string
+}
+
+// add stores a new job of the given client (empty if the authentication is
+// disabled) for the given circuit, callback (nil if none) and zkInputs, and
+// returns it
+func (q *jobQueue) add(client, circuitName string, callback *jobCallback,
+	zkInputs []byte) (*job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wTx := q.db.WriteTx()
+	defer wTx.Discard()
+
+	var lastID uint64
+	b, err := wTx.Get(dbKeyLastID)
+	if err == nil {
+		lastID = binary.LittleEndian.Uint64(b)
+	} else if err != db.ErrKeyNotFound {
+		return nil, err
+	}
+
+	now := time.Now()
+	j := &job{
+		ID:        lastID + 1,
+		Client:    client,
+		Circuit:   circuitName,
+		Status:    jobStatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if callback != nil {
+		j.Callback = callback.URL
+		j.ProcessID = callback.ProcessID
+		j.Prover = callback.Prover
+	}
+	var idBytes [8]byte
+	binary.LittleEndian.PutUint64(idBytes[:], j.ID)
+	if err := wTx.Set(dbKeyLastID, idBytes[:]); err != nil {
+		return nil, err
+	}
+	if err := wTx.Set(jobKey(dbPrefixZKInputs, j.ID), zkInputs); err != nil {
+		return nil, err
+	}
+	if err := setJob(wTx, j); err != nil {
+		return nil, err
+	}
+	if err := wTx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// notify without blocking, a pending notification is enough
+	select {
+	case q.newJobs <- struct{}{}:
+	default:
+	}
+	return j, nil
+}
+
+// get returns the job with the given id
+func (q *jobQueue) get(id uint64) (*job, error) {
+	rTx := q.db.ReadTx()
+	defer rTx.Discard()
+
+	b, err := rTx.Get(jobKey(dbPrefixJob, id))
+	if err == db.ErrKeyNotFound {
+		return nil, errJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var j job
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// zkInputs returns the zkInputs of the job with the given id
+func (q *jobQueue) zkInputs(id uint64) ([]byte, error) {
+	rTx := q.db.ReadTx()
+	defer rTx.Discard()
+
+	b, err := rTx.Get(jobKey(dbPrefixZKInputs, id))
+	if err == db.ErrKeyNotFound {
+		return nil, errNoZKInputsInDB
+	} else if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, b...), nil
+}
+
+// setStatus updates the status of the job with the given id, together with
+// the error message (empty if no error)
+func (q *jobQueue) setStatus(id uint64, status jobStatus, errMsg string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.updateStatus(id, status, errMsg)
+}
+
+// updateStatus updates the status of the job, the caller must hold the lock.
+// The cancelled jobs can not be updated.
+func (q *jobQueue) updateStatus(id uint64, status jobStatus, errMsg string) error {
+	j, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	if j.Status == jobStatusCancelled {
+		return errJobCancelled
+	}
+	j.Status = status
+	j.Error = errMsg
+	j.UpdatedAt = time.Now()
+
+	wTx := q.db.WriteTx()
+	defer wTx.Discard()
+	if err := setJob(wTx, j); err != nil {
+		return err
+	}
+	return wTx.Commit()
+}
+
+// cancel sets the job with the given id as cancelled, and removes its
+// zkInputs. Only the jobs that are not finished can be cancelled.
+func (q *jobQueue) cancel(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	switch j.Status {
+	case jobStatusQueued, jobStatusWitness, jobStatusProving:
+	default:
+		return fmt.Errorf("job can not be cancelled, id: %d, status: %s",
+			id, j.Status)
+	}
+	j.Status = jobStatusCancelled
+	j.UpdatedAt = time.Now()
+
+	wTx := q.db.WriteTx()
+	defer wTx.Discard()
+	if err := setJob(wTx, j); err != nil {
+		return err
+	}
+	if err := wTx.Delete(jobKey(dbPrefixZKInputs, id)); err != nil {
+		return err
+	}
+	return wTx.Commit()
+}
+
+// remove deletes the given finished job, once its files have been removed,
+// so that the finished jobs do not accumulate in the db
+func (q *jobQueue) remove(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wTx := q.db.WriteTx()
+	defer wTx.Discard()
+	if err := deleteJob(wTx, id); err != nil {
+		return err
+	}
+	return wTx.Commit()
+}
+
+// finishedBefore returns the finished jobs that were last updated before the
+// given time
+func (q *jobQueue) finishedBefore(t time.Time) ([]job, error) {
+	ids, err := q.indexedIDs(dbPrefixFinished, 0)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []job
+	for i := 0; i < len(ids); i++ {
+		j, err := q.get(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		if j.UpdatedAt.Before(t) {
+			jobs = append(jobs, *j)
+		}
+	}
+	return jobs, nil
+}
+
+// claim returns the oldest queued job, moving it to the jobStatusWitness
+// status so that it is not returned to other workers. Returns nil if there
+// are no queued jobs.
+func (q *jobQueue) claim() (*job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids, err := q.indexedIDs(dbPrefixQueued, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if err := q.updateStatus(ids[0], jobStatusWitness, ""); err != nil {
+		return nil, err
+	}
+	return q.get(ids[0])
+}
+
+// countQueued returns the number of queued jobs
+func (q *jobQueue) countQueued() (int, error) {
+	n := 0
+	err := q.db.Iterate(dbPrefixQueued, func(_, _ []byte) bool {
+		n++
+		return true
+	})
+	return n, err
+}
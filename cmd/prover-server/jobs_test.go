@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/pebbledb"
+)
+
+func TestJobQueue(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	q, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+
+	j, err := q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j, qt.IsNil)
+
+	for i := 0; i < 3; i++ {
+		j, err = q.add("", "default", nil, []byte("zkinputs"))
+		c.Assert(err, qt.IsNil)
+		c.Assert(j.ID, qt.Equals, uint64(i+1))
+		c.Assert(j.Status, qt.Equals, jobStatusQueued)
+	}
+
+	zki, err := q.zkInputs(2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(zki, qt.DeepEquals, []byte("zkinputs"))
+
+	_, err = q.get(4)
+	c.Assert(err, qt.Equals, errJobNotFound)
+
+	n, err := q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 3)
+
+	// the oldest queued job goes first
+	j, err = q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(1))
+	c.Assert(j.Status, qt.Equals, jobStatusWitness)
+
+	err = q.setStatus(1, jobStatusFailed, "witness error")
+	c.Assert(err, qt.IsNil)
+	j, err = q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(2))
+	err = q.setStatus(2, jobStatusProving, "")
+	c.Assert(err, qt.IsNil)
+
+	j, err = q.get(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Status, qt.Equals, jobStatusFailed)
+	c.Assert(j.Error, qt.Equals, "witness error")
+
+	n, err = q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 1)
+
+	// simulate a restart, the interrupted job is queued again and the ids
+	// are not reused
+	q, err = newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+
+	j, err = q.get(2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Status, qt.Equals, jobStatusQueued)
+	n, err = q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 2)
+
+	j, err = q.get(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Status, qt.Equals, jobStatusFailed)
+
+	j, err = q.add("", "default", nil, []byte("zkinputs"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(4))
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	q, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+
+	for i := 0; i < 3; i++ {
+		_, err = q.add("", "default", nil, []byte("zkinputs"))
+		c.Assert(err, qt.IsNil)
+	}
+
+	// cancel a queued job, it is not claimed
+	err = q.cancel(1)
+	c.Assert(err, qt.IsNil)
+	j, err := q.get(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Status, qt.Equals, jobStatusCancelled)
+	_, err = q.zkInputs(1)
+	c.Assert(err, qt.Equals, errNoZKInputsInDB)
+
+	j, err = q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(2))
+
+	// cancel a running job, its status can not be updated anymore
+	err = q.cancel(2)
+	c.Assert(err, qt.IsNil)
+	err = q.setStatus(2, jobStatusDone, "")
+	c.Assert(err, qt.Equals, errJobCancelled)
+
+	// finished jobs can not be cancelled
+	err = q.cancel(2)
+	c.Assert(err, qt.ErrorMatches, "job can not be cancelled, id: 2, status: cancelled")
+	_, err = q.claim()
+	c.Assert(err, qt.IsNil)
+	err = q.setStatus(3, jobStatusDone, "")
+	c.Assert(err, qt.IsNil)
+	err = q.cancel(3)
+	c.Assert(err, qt.ErrorMatches, "job can not be cancelled, id: 3, status: done")
+
+	err = q.cancel(4)
+	c.Assert(err, qt.Equals, errJobNotFound)
+
+	n, err := q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 0)
+}
+
+func TestJobQueueIndexes(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	// a job removed by a previous version, and a job stored without the
+	// indexes
+	wTx := database.WriteTx()
+	b, err := json.Marshal(job{ID: 1, Status: jobStatusDone, Removed: true})
+	c.Assert(err, qt.IsNil)
+	c.Assert(wTx.Set(jobKey(dbPrefixJob, 1), b), qt.IsNil)
+	b, err = json.Marshal(job{ID: 2, Status: jobStatusQueued})
+	c.Assert(err, qt.IsNil)
+	c.Assert(wTx.Set(jobKey(dbPrefixJob, 2), b), qt.IsNil)
+	var idBytes [8]byte
+	binary.LittleEndian.PutUint64(idBytes[:], 2)
+	c.Assert(wTx.Set(dbKeyLastID, idBytes[:]), qt.IsNil)
+	c.Assert(wTx.Commit(), qt.IsNil)
+
+	q, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	_, err = q.get(1)
+	c.Assert(err, qt.Equals, errJobNotFound)
+	n, err := q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 1)
+
+	_, err = q.add("", "default", nil, []byte("zkinputs"))
+	c.Assert(err, qt.IsNil)
+	j, err := q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(2))
+	err = q.setStatus(2, jobStatusDone, "")
+	c.Assert(err, qt.IsNil)
+
+	// the finished jobs leave the queued index, and are deleted once
+	// removed
+	n, err = q.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 1)
+	finished, err := q.finishedBefore(time.Now())
+	c.Assert(err, qt.IsNil)
+	c.Assert(finished, qt.HasLen, 1)
+	c.Assert(finished[0].ID, qt.Equals, uint64(2))
+
+	err = q.remove(2)
+	c.Assert(err, qt.IsNil)
+	_, err = q.get(2)
+	c.Assert(err, qt.Equals, errJobNotFound)
+	finished, err = q.finishedBefore(time.Now())
+	c.Assert(err, qt.IsNil)
+	c.Assert(finished, qt.HasLen, 0)
+	j, err = q.claim()
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.ID, qt.Equals, uint64(3))
+}
@@ -1,34 +1,115 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"os/exec"
-	"reflect"
+	"runtime"
 	"time"
 
+	"github.com/aragon/ovote-node/prover"
 	"go.vocdoni.io/dvote/log"
 )
 
-const mutexLocked = 1
+const (
+	// jobsSleepTime determines the seconds to wait before checking again
+	// the queue when there are no queued jobs
+	jobsSleepTime = 10
+	// cpusPerWorker is used to size the default number of workers, as the
+	// prover already parallelizes each proof generation over the cpus
+	cpusPerWorker = 8
+	// callbackTimeout determines the seconds to wait for the node response
+	// to a proof completion callback
+	callbackTimeout = 30
+)
+
+// defaultNWorkers returns the default number of workers for the machine
+func defaultNWorkers() int {
+	n := runtime.NumCPU() / cpusPerWorker
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// workersStatus returns the number of busy workers and the average time that
+// takes to process a job
+func (a *api) workersStatus() (int, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.busyWorkers, a.avgJobTime
+}
+
+// estimatedWait returns the estimated time until a new job would start being
+// processed, given the current number of busy workers and queued jobs
+func (a *api) estimatedWait(busyWorkers, queued int) time.Duration {
+	_, avgJobTime := a.workersStatus()
+	pending := busyWorkers + queued
+	if pending < a.nWorkers {
+		return 0
+	}
+	// number of rounds of jobs that have to be finished before
+	rounds := (pending-a.nWorkers)/a.nWorkers + 1
+	return time.Duration(rounds) * avgJobTime
+}
 
-func (a *api) isBusy() bool {
-	state := reflect.ValueOf(a).Elem().FieldByName("state")
-	return state.Int()&mutexLocked == mutexLocked
+// setRunning registers the function that cancels the running job with the
+// given id, nil unregisters it
+func (a *api) setRunning(id uint64, cancel context.CancelFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cancel == nil {
+		delete(a.running, id)
+		return
+	}
+	a.running[id] = cancel
+}
+
+// killJob stops the subprocess of the job with the given id, if it is running
+func (a *api) killJob(id uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cancel, ok := a.running[id]; ok {
+		cancel()
+	}
+}
+
+func (a *api) startJob() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.busyWorkers++
+}
+
+func (a *api) endJob(duration time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.busyWorkers--
+	// moving average, giving more weight to the recent jobs
+	if a.avgJobTime == 0 {
+		a.avgJobTime = duration
+		return
+	}
+	a.avgJobTime = (3*a.avgJobTime + duration) / 4 //nolint:gomnd
 }
 
-// busyFor locks the mutex for s seconds. This method is for testing
-// purposes only.
-//nolint:unused
-func (a *api) busyFor(s time.Duration) {
-	a.Lock()
-	time.Sleep(s)
-	a.Unlock()
+// startWorkers launches the configured number of workers, which process the
+// queued jobs
+func (a *api) startWorkers() {
+	for i := 0; i < a.nWorkers; i++ {
+		go a.worker()
+	}
 }
 
-func genWitness(id string) error {
-	// node ./circuit_js/generate_witness.js circuit.wasm zkinputs.json witness.wtns
-	// TODO user cmd flag for path on generate_witness.js
-	cmd := exec.Command("node", "./circuit_js/generate_witness.js", //nolint:gosec
-		"circuit.wasm", "zkinputs"+id+".json", "witness"+id+".wtns")
+func (a *api) genWitness(ctx context.Context, c *circuit, id uint64) error {
+	// node generate_witness.js circuit.wasm zkinputs.json witness.wtns
+	cmd := exec.CommandContext(ctx, a.nodeBin, c.WitnessGenerator, //nolint:gosec
+		c.Wasm, a.jobFile(id, fileZKInputs), a.jobFile(id, fileWitness))
 	stdout, err := cmd.Output()
 
 	if err != nil {
@@ -41,14 +122,14 @@ func genWitness(id string) error {
 	return nil
 }
 
-func genProof(id string) error {
-	// ~/bin/prover circuit.zkey witness.wtns proof.json public.json
-	// TODO user cmd flag for path on prover
-	cmd := exec.Command("./prover", "circuit.zkey", "witness"+id+".wtns", //nolint:gosec
-		"proof"+id+".json", "public"+id+".json")
+func (a *api) genProof(ctx context.Context, c *circuit, id uint64) error {
+	// prover circuit.zkey witness.wtns proof.json public.json
+	cmd := exec.CommandContext(ctx, a.proverBin, c.Zkey, //nolint:gosec
+		a.jobFile(id, fileWitness), a.jobFile(id, fileProof),
+		a.jobFile(id, filePublic))
 	stdout, err := cmd.Output()
 	if err != nil {
-		log.Error("genWitness error:", err)
+		log.Error("genProof error:", err)
 		return err
 	}
 
@@ -57,14 +138,162 @@ func genProof(id string) error {
 	return nil
 }
 
-func (a *api) genWitnessAndProof(id string) {
-	a.Lock()
-	defer a.Unlock()
+// verifyProof verifies the generated proof with the verification key of the
+// circuit, so that invalid proofs are not served
+func (a *api) verifyProof(c *circuit, id uint64) error {
+	proof, err := ioutil.ReadFile(a.jobFile(id, fileProof))
+	if err != nil {
+		return err
+	}
+	publicInputs, err := ioutil.ReadFile(a.jobFile(id, filePublic))
+	if err != nil {
+		return err
+	}
+	return c.vk.VerifyBytes(proof, publicInputs)
+}
+
+// worker processes the queued jobs one by one. This method is designed to be
+// called in a goroutine
+func (a *api) worker() {
+	for {
+		j, err := a.jobs.claim()
+		if err != nil {
+			log.Error(err)
+		}
+		if j == nil {
+			// wait until a new job is queued
+			select {
+			case <-a.jobs.newJobs:
+			case <-time.After(jobsSleepTime * time.Second):
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		a.setRunning(j.ID, cancel)
+		a.startJob()
+		start := time.Now()
+		err = a.runJob(ctx, j)
+		a.endJob(time.Since(start))
+		a.setRunning(j.ID, nil)
+		cancelled := errors.Is(ctx.Err(), context.Canceled)
+		cancel()
+		if err != nil && !cancelled {
+			// the job could have been cancelled before its context was
+			// registered, in which case it can not be set as failed
+			err2 := a.jobs.setStatus(j.ID, jobStatusFailed, err.Error())
+			cancelled = errors.Is(err2, errJobCancelled)
+			if err2 != nil && !cancelled {
+				log.Error(err2)
+			}
+			if !cancelled {
+				log.Errorw("proof generation failed", "id", j.ID, "err", err)
+				continue
+			}
+		}
+		if cancelled {
+			log.Infow("proof generation cancelled", "id", j.ID)
+			a.removeJobFiles(j.ID)
+			continue
+		}
+		if j.Callback != "" {
+			// if the callback fails, the node still can poll the proof.
+			// If not, the node has confirmed its retrieval.
+			if err := a.sendCallback(j); err != nil {
+				log.Warnw("proof callback failed", "id", j.ID,
+					"callback", j.Callback, "err", err)
+			} else if err := a.retrieved(j.ID); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// sendCallback sends the generated proof of the given job to its callback
+// url, signed with the secret of its client
+func (a *api) sendCallback(j *job) error {
+	client, ok := a.clients[j.Client]
+	if !ok {
+		return fmt.Errorf("client %q not registered", j.Client)
+	}
+	if j.Prover == "" {
+		// the callback url of the jobs queued by the previous versions
+		// was given by the client, the node polls them instead
+		return fmt.Errorf("job queued without the callback prover")
+	}
+	proof, err := ioutil.ReadFile(a.jobFile(j.ID, fileProof))
+	if err != nil {
+		return err
+	}
+	publicInputs, err := ioutil.ReadFile(a.jobFile(j.ID, filePublic))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(prover.Callback{
+		ProcessID:    j.ProcessID,
+		Prover:       j.Prover,
+		ID:           j.ID,
+		Timestamp:    time.Now().Unix(),
+		Proof:        proof,
+		PublicInputs: publicInputs,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, j.Callback, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(prover.CallbackSignatureHeader,
+		prover.SignCallback([]byte(client.Secret), body))
+	httpClient := &http.Client{Timeout: callbackTimeout * time.Second}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runJob computes the witness and the proof of the given job, which has
+// already been claimed
+func (a *api) runJob(ctx context.Context, j *job) error {
+	c, err := getCircuit(a.circuits, j.Circuit)
+	if err != nil {
+		return err
+	}
+	id := j.ID
+	zki, err := a.jobs.zkInputs(id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.jobDir(id), 0750); err != nil { //nolint:gomnd
+		return err
+	}
+	err = ioutil.WriteFile(a.jobFile(id, fileZKInputs), zki, 0600)
+	if err != nil {
+		return err
+	}
 
-	if err := genWitness(id); err != nil {
-		log.Error(err)
+	if err := a.genWitness(ctx, c, id); err != nil {
+		return err
+	}
+	if err := a.jobs.setStatus(id, jobStatusProving, ""); err != nil {
+		return err
 	}
-	if err := genProof(id); err != nil {
-		log.Error(err)
+	err = a.genProof(ctx, c, id)
+	// the witness is no longer needed, once the proof has been computed
+	a.removeWitness(id)
+	if err != nil {
+		return err
+	}
+	if err := a.verifyProof(c, id); err != nil {
+		return err
 	}
+	return a.jobs.setStatus(id, jobStatusDone, "")
 }
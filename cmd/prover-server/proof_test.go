@@ -1,32 +1,286 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
 	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
 	"go.vocdoni.io/dvote/db"
 	"go.vocdoni.io/dvote/db/pebbledb"
 )
 
-func TestPostNewCensusHandler(t *testing.T) {
-	t.Skip()
-	// TODO WIP
+func doGetStatus(c *qt.C, a *api) statusMsg {
+	req, err := http.NewRequest("GET", "/status", nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	var status statusMsg
+	err = json.Unmarshal(w.Body.Bytes(), &status)
+	c.Assert(err, qt.IsNil)
+	return status
+}
+
+func TestGetStatus(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	jobs, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	a := &api{
+		r:        gin.Default(),
+		jobs:     jobs,
+		jobsDir:  c.TempDir(),
+		nWorkers: 2,
+	}
+	a.r.GET("/status", a.getStatus)
+
+	status := doGetStatus(c, a)
+	c.Assert(status.Status, qt.Equals, "ok")
+	c.Assert(status.Workers, qt.Equals, 2)
+	c.Assert(status.BusyWorkers, qt.Equals, 0)
+	c.Assert(status.Queued, qt.Equals, 0)
+	c.Assert(status.EstimatedWait, qt.Equals, uint64(0))
+	c.Assert(status.DiskUsage, qt.Equals, uint64(0))
+
+	// simulate a finished job, to have an average job time
+	a.startJob()
+	a.endJob(10 * time.Second)
+
+	// one busy worker, there is still capacity
+	a.startJob()
+	status = doGetStatus(c, a)
+	c.Assert(status.Status, qt.Equals, "ok")
+	c.Assert(status.BusyWorkers, qt.Equals, 1)
+
+	// all workers busy and 3 queued jobs, a new job would wait until 2
+	// rounds of jobs finish
+	a.startJob()
+	for i := 0; i < 3; i++ {
+		_, err = jobs.add("", "default", nil, []byte("zkinputs"))
+		c.Assert(err, qt.IsNil)
+	}
+	status = doGetStatus(c, a)
+	c.Assert(status.Status, qt.Equals, "busy")
+	c.Assert(status.BusyWorkers, qt.Equals, 2)
+	c.Assert(status.Queued, qt.Equals, 3)
+	c.Assert(status.EstimatedWait, qt.Equals, uint64(20))
+}
+
+func TestGetCircuits(t *testing.T) {
+	c := qt.New(t)
+
+	a := &api{r: gin.Default(), circuits: defaultCircuits()}
+	a.r.GET("/circuits", a.getCircuits)
+
+	req, err := http.NewRequest("GET", "/circuits", nil)
+	c.Assert(err, qt.IsNil)
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	// only the circuit metadata is returned, not the artifact paths
+	var circuits []map[string]interface{}
+	err = json.Unmarshal(w.Body.Bytes(), &circuits)
+	c.Assert(err, qt.IsNil)
+	c.Assert(circuits, qt.DeepEquals, []map[string]interface{}{{
+		"name": "default", "nMaxVotes": float64(128), "nLevels": float64(7),
+	}})
+	c.Assert(w.Body.String(), qt.Not(qt.Contains), "zkey")
+}
+
+func TestSendCallback(t *testing.T) {
+	c := qt.New(t)
+
+	a := &api{jobsDir: c.TempDir()}
+	err := os.MkdirAll(a.jobDir(1000), 0750)
+	c.Assert(err, qt.IsNil)
+	err = ioutil.WriteFile(a.jobFile(1000, fileProof), []byte(`{"pi_a":[]}`), 0600)
+	c.Assert(err, qt.IsNil)
+	err = ioutil.WriteFile(a.jobFile(1000, filePublic), []byte(`["1"]`), 0600)
+	c.Assert(err, qt.IsNil)
+
+	secret := []byte("secret")
+	var received prover.Callback
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, qt.IsNil)
+			if !prover.VerifyCallback(secret, body,
+				r.Header.Get(prover.CallbackSignatureHeader)) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			c.Assert(json.Unmarshal(body, &received), qt.IsNil)
+		}))
+	defer ts.Close()
+
+	// the callback is signed with the secret of the client of the job
+	a.clients = map[string]clientConfig{
+		"node0": {Secret: string(secret)},
+		"node1": {Secret: "othersecret"},
+	}
+	j := &job{ID: 1000, Client: "node0", Callback: ts.URL, ProcessID: 5,
+		Prover: "http://prover:9000"}
+	err = a.sendCallback(j)
+	c.Assert(err, qt.IsNil)
+	c.Assert(received.ID, qt.Equals, uint64(1000))
+	c.Assert(received.ProcessID, qt.Equals, uint64(5))
+	c.Assert(received.Prover, qt.Equals, "http://prover:9000")
+	c.Assert(received.Expired(), qt.IsFalse)
+	c.Assert(string(received.Proof), qt.Equals, `{"pi_a":[]}`)
+	c.Assert(string(received.PublicInputs), qt.Equals, `["1"]`)
+
+	j.Client = "node1"
+	err = a.sendCallback(j)
+	c.Assert(err, qt.ErrorMatches, "unexpected status code 401")
+
+	// the jobs queued by the previous versions are not sent
+	err = a.sendCallback(&job{ID: 1000, Client: "node0", Callback: ts.URL})
+	c.Assert(err, qt.ErrorMatches, "job queued without the callback prover")
+}
+
+func TestDeleteProof(t *testing.T) {
+	c := qt.New(t)
+
+	opts := db.Options{Path: c.TempDir()}
+	database, err := pebbledb.New(opts)
+	c.Assert(err, qt.IsNil)
+
+	jobs, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	a := &api{
+		r:       gin.Default(),
+		jobs:    jobs,
+		jobsDir: c.TempDir(),
+		running: make(map[uint64]context.CancelFunc),
+	}
+	a.r.DELETE("/proof/:id", a.deleteProof)
+
+	doDelete := func(id string) int {
+		req, err := http.NewRequest("DELETE", "/proof/"+id, nil)
+		c.Assert(err, qt.IsNil)
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a running job, simulated by a registered context
+	for i := 0; i < 2; i++ {
+		_, err = jobs.add("", "default", nil, []byte("zkinputs"))
+		c.Assert(err, qt.IsNil)
+	}
+	j, err := jobs.claim()
+	c.Assert(err, qt.IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.setRunning(j.ID, cancel)
 
+	c.Assert(doDelete("1"), qt.Equals, http.StatusOK)
+	c.Assert(ctx.Err(), qt.Equals, context.Canceled)
+	j, err = jobs.get(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Status, qt.Equals, jobStatusCancelled)
+
+	// the files of a queued job are removed directly
+	err = os.MkdirAll(a.jobDir(2), 0750)
+	c.Assert(err, qt.IsNil)
+	err = ioutil.WriteFile(a.jobFile(2, fileZKInputs), []byte("zkinputs"), 0600)
+	c.Assert(err, qt.IsNil)
+	c.Assert(doDelete("2"), qt.Equals, http.StatusOK)
+	_, err = os.Stat(a.jobDir(2))
+	c.Assert(os.IsNotExist(err), qt.IsTrue)
+
+	c.Assert(doDelete("2"), qt.Equals, http.StatusBadRequest)
+	c.Assert(doDelete("3"), qt.Equals, http.StatusNotFound)
+}
+
+func TestPostProof(t *testing.T) {
 	c := qt.New(t)
 
 	opts := db.Options{Path: c.TempDir()}
 	database, err := pebbledb.New(opts)
 	c.Assert(err, qt.IsNil)
 
-	a := api{
-		db:     database,
-		lastID: 0,
+	jobs, err := newJobQueue(database)
+	c.Assert(err, qt.IsNil)
+	a := &api{
+		r:        gin.Default(),
+		jobs:     jobs,
+		circuits: defaultCircuits(),
+	}
+	// the requests are not signed, the client is taken from its header
+	a.r.POST("/proof", func(c *gin.Context) {
+		c.Set(clientCtxKey, c.GetHeader(prover.AuthClientHeader))
+	}, a.postProof)
+
+	doPostQuery := func(clientID, query string, zki *types.ZKInputs) (int, string) {
+		body, err := json.Marshal(zki)
+		c.Assert(err, qt.IsNil)
+		req, err := http.NewRequest("POST", "/proof"+query, bytes.NewReader(body))
+		c.Assert(err, qt.IsNil)
+		req.Header.Set(prover.AuthClientHeader, clientID)
+		w := httptest.NewRecorder()
+		a.r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	doPost := func(zki *types.ZKInputs) (int, string) {
+		return doPostQuery("", "", zki)
 	}
 
-	c.Assert(a.isBusy(), qt.IsFalse)
-	go a.busyFor(3 * time.Second)
-	time.Sleep(1 * time.Second)
-	c.Assert(a.isBusy(), qt.IsTrue)
-	time.Sleep(2 * time.Second)
+	zki := types.NewZKInputs(128, 7)
+	code, body := doPost(zki)
+	c.Assert(code, qt.Equals, http.StatusOK, qt.Commentf(body))
+	j, err := jobs.get(1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Circuit, qt.Equals, "default")
+
+	// the zkInputs are validated before queuing the job
+	zki.NVotes = big.NewInt(1)
+	code, body = doPost(zki)
+	c.Assert(code, qt.Equals, http.StatusBadRequest)
+	c.Assert(body, qt.Contains, "invalid zkInputs: nVotes mismatch")
+
+	code, body = doPost(types.NewZKInputs(16, 4))
+	c.Assert(code, qt.Equals, http.StatusBadRequest)
+	c.Assert(body, qt.Contains, "no circuit found for the zkInputs")
+	n, err := jobs.countQueued()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 1)
+
+	// the callbacks are only sent to the url configured for the client
+	a.clients = map[string]clientConfig{
+		"node0": {Secret: "secret0", CallbackURL: "http://node0:8080/"},
+		"node1": {Secret: "secret1"},
+	}
+	zki = types.NewZKInputs(128, 7)
+	query := "?callback=true&processid=5&prover=http%3A%2F%2Fprover%3A9000"
+	code, body = doPostQuery("node1", query, zki)
+	c.Assert(code, qt.Equals, http.StatusBadRequest)
+	c.Assert(body, qt.Contains, "callbacks are not enabled for client")
+	code, body = doPostQuery("node0", "?callback=true&processid=5", zki)
+	c.Assert(code, qt.Equals, http.StatusBadRequest)
+	c.Assert(body, qt.Contains, "prover is required with callback")
+	code, body = doPostQuery("node0", query, zki)
+	c.Assert(code, qt.Equals, http.StatusOK, qt.Commentf(body))
+	j, err = jobs.get(2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(j.Callback, qt.Equals, "http://node0:8080/proof/5/callback")
+	c.Assert(j.ProcessID, qt.Equals, uint64(5))
+	c.Assert(j.Prover, qt.Equals, "http://prover:9000")
 }
@@ -12,6 +12,9 @@ var (
 	// ErrMetaNotInDB is used to indicate when metadata (which includes
 	// lastSyncBlockNum) is not stored in the db
 	ErrMetaNotInDB = fmt.Errorf("Meta does not exist in the db")
+	// ErrProcessNotInDB is used to indicate when the process does not exist
+	// in the db
+	ErrProcessNotInDB = errors.New("Process does not exist in db")
 )
 
 // SQLite represents the SQLite database
@@ -26,7 +29,8 @@ func NewSQLite(db *sql.DB) *SQLite {
 	}
 }
 
-// Migrate creates the tables needed for the database
+// Migrate creates the tables needed for the database, and upgrades the tables
+// created by previous versions of the node
 func (r *SQLite) Migrate() error {
 	query := `
 	PRAGMA foreign_keys = ON;
@@ -64,6 +68,7 @@ func (r *SQLite) Migrate() error {
 		merkleproof BLOB NOT NULL UNIQUE,
 		signature BLOB NOT NULL,
 		vote BLOB NOT NULL,
+		hash BLOB NOT NULL UNIQUE,
 		insertedDatetime DATETIME,
 		processID INTEGER NOT NULL,
 		FOREIGN KEY(processID) REFERENCES processes(id)
@@ -76,12 +81,30 @@ func (r *SQLite) Migrate() error {
 
 	query = `
 	CREATE TABLE IF NOT EXISTS proofs(
-		proofid INTEGER NOT NULL PRIMARY KEY UNIQUE,
+		proofid INTEGER NOT NULL,
 		proof BLOB NOT NULL,
 		publicInputs BLOB NOT NULL,
 		insertedDatetime DATETIME,
 		proofAddedDatetime DATETIME,
 		processID INTEGER NOT NULL,
+		errMsg TEXT NOT NULL DEFAULT '',
+		prover TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(processID) REFERENCES processes(id)
+	);
+	`
+	_, err = r.db.Exec(query)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	CREATE TABLE IF NOT EXISTS results(
+		processID INTEGER NOT NULL PRIMARY KEY UNIQUE,
+		receiptsRoot BLOB NOT NULL,
+		result INTEGER NOT NULL,
+		nVotes INTEGER NOT NULL,
+		ethBlockNum INTEGER NOT NULL,
+		insertedDatetime DATETIME,
 		FOREIGN KEY(processID) REFERENCES processes(id)
 	);
 	`
@@ -103,7 +126,7 @@ func (r *SQLite) Migrate() error {
 		return err
 	}
 
-	return nil
+	return r.migrate()
 }
 
 // InitMeta initializes the meta table with the given chainID
@@ -2,11 +2,16 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"math/big"
 	"path/filepath"
 	"testing"
 
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
 	qt "github.com/frankban/quicktest"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/vocdoni/arbo"
 )
 
 func TestMetaTable(t *testing.T) {
@@ -34,3 +39,131 @@ func TestMetaTable(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(b, qt.Equals, uint64(1234))
 }
+
+// baselineSchema is the schema of the databases created by the first version
+// of the node, before the migrations
+const baselineSchema = `
+	CREATE TABLE processes(
+		id INTEGER NOT NULL PRIMARY KEY UNIQUE,
+		status INTEGER NOT NULL,
+		censusRoot BLOB NOT NULL,
+		censusSize INTEGER NOT NULL,
+		ethBlockNum INTEGER NOT NULL,
+		resPubStartBlock INTEGER NOT NULL,
+		resPubWindow INTEGER NOT NULL,
+		minParticipation INTEGER NOT NULL,
+		minPositiveVotes INTEGER NOT NULL,
+		type INTEGER NOT NULL,
+		insertedDatetime DATETIME
+	);
+	CREATE TABLE votepackages(
+		indx INTEGER NOT NULL PRIMARY KEY UNIQUE,
+		publicKey BLOB NOT NULL UNIQUE,
+		weight BLOB NOT NULL,
+		merkleproof BLOB NOT NULL UNIQUE,
+		signature BLOB NOT NULL,
+		vote BLOB NOT NULL,
+		insertedDatetime DATETIME,
+		processID INTEGER NOT NULL,
+		FOREIGN KEY(processID) REFERENCES processes(id)
+	);
+	CREATE TABLE proofs(
+		proofid INTEGER NOT NULL PRIMARY KEY UNIQUE,
+		proof BLOB NOT NULL,
+		publicInputs BLOB NOT NULL,
+		insertedDatetime DATETIME,
+		proofAddedDatetime DATETIME,
+		processID INTEGER NOT NULL,
+		FOREIGN KEY(processID) REFERENCES processes(id)
+	);
+	CREATE TABLE meta(
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		chainID INTEGER NOT NULL,
+		lastSyncBlockNum INTEGER NOT NULL,
+		lastUpdate DATETIME
+	);
+	`
+
+func TestMigrateBaseline(t *testing.T) {
+	c := qt.New(t)
+
+	db, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+
+	// fill a database with the baseline schema
+	_, err = db.Exec(baselineSchema)
+	c.Assert(err, qt.IsNil)
+	processID := uint64(123)
+	_, err = db.Exec(`INSERT INTO processes VALUES(?, 0, x'01', 100, 10, 20, 20,
+		60, 20, 1, CURRENT_TIMESTAMP)`, processID)
+	c.Assert(err, qt.IsNil)
+
+	keys := test.GenUserKeys(2)
+	var votes []types.VotePackage
+	for i := 0; i < 2; i++ {
+		vote := arbo.BigIntToBytes(32, big.NewInt(1))
+		votes = append(votes, types.VotePackage{
+			Signature: keys.PrivateKeys[i].SignPoseidon(big.NewInt(1)).Compress(),
+			CensusProof: types.CensusProof{
+				Index:       uint64(i),
+				PublicKey:   &keys.PublicKeys[i],
+				Weight:      big.NewInt(int64(i + 2)),
+				MerkleProof: []byte{byte(i)},
+			},
+			Vote: vote,
+		})
+	}
+	_, err = db.Exec(`INSERT INTO votepackages VALUES(?, ?, ?, ?, ?, ?,
+		CURRENT_TIMESTAMP, ?)`, votes[0].CensusProof.Index,
+		votes[0].CensusProof.PublicKey, votes[0].CensusProof.Weight.Bytes(),
+		votes[0].CensusProof.MerkleProof, votes[0].Signature[:], votes[0].Vote,
+		processID)
+	c.Assert(err, qt.IsNil)
+	_, err = db.Exec(`INSERT INTO proofs VALUES(1, x'', x'', CURRENT_TIMESTAMP,
+		CURRENT_TIMESTAMP, ?)`, processID)
+	c.Assert(err, qt.IsNil)
+
+	sqlite := NewSQLite(db)
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+	// the migrations are only applied once
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	// the stored vote is counted
+	nVotes, weight, result, err := sqlite.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotes, qt.Equals, uint64(1))
+	c.Assert(weight.Int64(), qt.Equals, int64(2))
+	c.Assert(result.Int64(), qt.Equals, int64(2))
+	_, hash, _, err := sqlite.ReadVoteStatusByPublicKey(processID, &keys.PublicKeys[0])
+	c.Assert(err, qt.IsNil)
+	expectedHash, err := votes[0].Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash, qt.DeepEquals, expectedHash)
+
+	// and the new votes are stored with the current columns
+	err = sqlite.StoreVotePackage(processID, votes[1])
+	c.Assert(err, qt.IsNil)
+	err = sqlite.StoreVotePackage(processID, votes[0])
+	c.Assert(errors.Is(err, ErrVoteAlreadyStored), qt.IsTrue)
+	nVotes, weight, result, err = sqlite.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotes, qt.Equals, uint64(2))
+	c.Assert(weight.Int64(), qt.Equals, int64(5))
+	c.Assert(result.Int64(), qt.Equals, int64(5))
+
+	// the stored proof has no prover, and the proof ids can be repeated
+	// between provers
+	proofs, err := sqlite.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofs, qt.HasLen, 1)
+	c.Assert(proofs[0].ProofID, qt.Equals, uint64(1))
+	c.Assert(proofs[0].Prover, qt.Equals, "")
+	err = sqlite.StoreProofID(processID, 1, "http://prover")
+	c.Assert(err, qt.IsNil)
+	proofs, err = sqlite.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofs, qt.HasLen, 2)
+	c.Assert(proofs[0].Prover, qt.Equals, "http://prover")
+}
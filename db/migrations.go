@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+
+	"github.com/aragon/ovote-node/types"
+)
+
+// migrations upgrade the tables of the databases created by previous versions
+// of the node, which are not recreated by Migrate as they already exist. The
+// migrations applied are tracked by the user_version of the database, and
+// each one checks the current schema, so it can also be applied to the
+// tables created with the current columns.
+var migrations = []func(tx *sql.Tx) error{
+	migrateVotePackageHash,
+	migrateProofs,
+}
+
+// migrate applies the migrations that have not been applied yet to the
+// database, each one in its own transaction
+func (r *SQLite) migrate() error {
+	var version int
+	if err := r.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[version](tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		// the pragma does not accept parameters
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the columns of the given table, with a flag that
+// indicates if they are part of the primary key
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = pk > 0
+	}
+	return columns, rows.Err()
+}
+
+// migrateVotePackageHash adds the hash column to the votepackages, computed
+// from the stored VotePackages, and makes it unique
+func migrateVotePackageHash(tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "votepackages")
+	if err != nil {
+		return err
+	}
+	if _, ok := columns["hash"]; ok {
+		return nil
+	}
+	_, err = tx.Exec("ALTER TABLE votepackages ADD COLUMN hash BLOB NOT NULL DEFAULT x''")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+	SELECT signature, indx, publicKey, weight, merkleproof, vote FROM votepackages
+	`)
+	if err != nil {
+		return err
+	}
+	var votes []types.VotePackage
+	for rows.Next() {
+		vote := types.VotePackage{}
+		var sigBytes []byte
+		var weightBytes []byte
+		err = rows.Scan(&sigBytes, &vote.CensusProof.Index,
+			&vote.CensusProof.PublicKey, &weightBytes,
+			&vote.CensusProof.MerkleProof, &vote.Vote)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		vote.CensusProof.Weight = new(big.Int).SetBytes(weightBytes)
+		copy(vote.Signature[:], sigBytes)
+		votes = append(votes, vote)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(votes); i++ {
+		hash, err := votes[i].Hash()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE votepackages SET hash = ? WHERE indx = ?",
+			hash, votes[i].CensusProof.Index)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS votepackages_hash ON votepackages(hash)
+	`)
+	return err
+}
+
+// migrateProofs adds the errMsg and prover columns to the proofs, and removes
+// the primary key of the proofid, as the proof ids of different provers can
+// be the same. The proofs generated before have an empty prover.
+func migrateProofs(tx *sql.Tx) error {
+	columns, err := tableColumns(tx, "proofs")
+	if err != nil {
+		return err
+	}
+	if _, ok := columns["errMsg"]; !ok {
+		_, err = tx.Exec("ALTER TABLE proofs ADD COLUMN errMsg TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := columns["prover"]; !ok {
+		_, err = tx.Exec("ALTER TABLE proofs ADD COLUMN prover TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+	if !columns["proofid"] {
+		return nil
+	}
+
+	// the primary key can not be dropped, so the table is recreated
+	_, err = tx.Exec(`
+	CREATE TABLE proofs_migrated(
+		proofid INTEGER NOT NULL,
+		proof BLOB NOT NULL,
+		publicInputs BLOB NOT NULL,
+		insertedDatetime DATETIME,
+		proofAddedDatetime DATETIME,
+		processID INTEGER NOT NULL,
+		errMsg TEXT NOT NULL DEFAULT '',
+		prover TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(processID) REFERENCES processes(id)
+	);
+	INSERT INTO proofs_migrated(proofid, proof, publicInputs,
+		insertedDatetime, proofAddedDatetime, processID, errMsg, prover)
+	SELECT proofid, proof, publicInputs, insertedDatetime,
+		proofAddedDatetime, processID, errMsg, prover FROM proofs;
+	DROP TABLE proofs;
+	ALTER TABLE proofs_migrated RENAME TO proofs;
+	`)
+	return err
+}
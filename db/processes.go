@@ -73,7 +73,7 @@ func (r *SQLite) GetProcessStatus(id uint64) (types.ProcessStatus, error) {
 	err := row.Scan(&status)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, fmt.Errorf("ProcessID: %d, does not exist in the db", id)
+			return 0, fmt.Errorf("%w, ProcessID: %d", ErrProcessNotInDB, id)
 		}
 		return 0, err
 	}
@@ -91,7 +91,7 @@ func (r *SQLite) ReadProcessByID(id uint64) (*types.Process, error) {
 		&process.MinPositiveVotes, &process.Type, &process.InsertedDatetime)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("ProcessID: %d, does not exist in the db", id)
+			return nil, fmt.Errorf("%w, ProcessID: %d", ErrProcessNotInDB, id)
 		}
 		return nil, err
 	}
@@ -154,6 +154,30 @@ func (r *SQLite) FrozeProcessesByCurrentBlockNum(currBlockNum uint64) error {
 	return nil
 }
 
+// CloseProcess sets the process status to ProcessStatusClosed, if its zkProof
+// has not been generated yet. This method is intended to be used by the
+// eth.Client when the process is closed in the SmartContract.
+func (r *SQLite) CloseProcess(id uint64) error {
+	sqlQuery := `
+	UPDATE processes
+	SET status = ?
+	WHERE (id = ? AND status IN (?, ?, ?))
+	`
+
+	stmt, err := r.db.Prepare(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close() //nolint:errcheck
+
+	_, err = stmt.Exec(types.ProcessStatusClosed, id, types.ProcessStatusOn,
+		types.ProcessStatusFrozen, types.ProcessStatusProofGenerating)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ReadProcessesByResPubStartBlock reads all the stored processes which contain
 // the given ResPubStartBlock
 func (r *SQLite) ReadProcessesByResPubStartBlock(resPubStartBlock uint64) (
@@ -272,3 +272,38 @@ func TestFrozeProcessesByCurrentBlockNum(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(len(processes), qt.Equals, 6)
 }
+
+func TestCloseProcess(t *testing.T) {
+	c := qt.New(t)
+
+	db, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+
+	sqlite := NewSQLite(db)
+
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	for i := uint64(0); i < 3; i++ {
+		err = sqlite.StoreProcess(i, []byte("censusRoot"), 100, 10, 20, 20,
+			60, 20, 1)
+		c.Assert(err, qt.IsNil)
+	}
+	err = sqlite.UpdateProcessStatus(1, types.ProcessStatusProofGenerating)
+	c.Assert(err, qt.IsNil)
+	err = sqlite.UpdateProcessStatus(2, types.ProcessStatusProofGenerated)
+	c.Assert(err, qt.IsNil)
+
+	for i := uint64(0); i < 3; i++ {
+		err = sqlite.CloseProcess(i)
+		c.Assert(err, qt.IsNil)
+	}
+
+	// the processes with the proof already generated are not closed
+	processes, err := sqlite.ReadProcessesByStatus(types.ProcessStatusClosed)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(processes), qt.Equals, 2)
+	status, err := sqlite.GetProcessStatus(2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status, qt.Equals, types.ProcessStatusProofGenerated)
+}
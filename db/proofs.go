@@ -10,11 +10,12 @@ import (
 )
 
 // ErrProofNotInDB is used to indicate when the proof does not exist in the db.
-var ErrProofNotInDB = "Proof does not exist in db"
+var ErrProofNotInDB = errors.New("Proof does not exist in db")
 
-// StoreProofID stores the given proofID for the given processID.  This method
-// should be called only from a prover-server response.
-func (r *SQLite) StoreProofID(processID, proofID uint64) error {
+// StoreProofID stores the given proofID for the given processID, together with
+// the url of the prover that generates it.  This method should be called only
+// from a prover-server response.
+func (r *SQLite) StoreProofID(processID, proofID uint64, prover string) error {
 	sqlQuery := `
 	INSERT INTO proofs(
 		proofid,
@@ -22,8 +23,9 @@ func (r *SQLite) StoreProofID(processID, proofID uint64) error {
 		publicInputs,
 		insertedDatetime,
 		proofAddedDatetime,
-		processID
-	) values(?, ?, ?, CURRENT_TIMESTAMP, ?, ?)
+		processID,
+		prover
+	) values(?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
 
 	stmt, err := r.db.Prepare(sqlQuery)
@@ -33,7 +35,8 @@ func (r *SQLite) StoreProofID(processID, proofID uint64) error {
 	defer stmt.Close() //nolint:errcheck
 
 	emptyBytes := []byte{}
-	_, err = stmt.Exec(proofID, emptyBytes, emptyBytes, time.Time{}, processID)
+	_, err = stmt.Exec(proofID, emptyBytes, emptyBytes, time.Time{}, processID,
+		prover)
 	if err != nil {
 		if err.Error() == "FOREIGN KEY constraint failed" {
 			return fmt.Errorf("Can not store Proof, ProcessID=%d does not exist",
@@ -45,14 +48,15 @@ func (r *SQLite) StoreProofID(processID, proofID uint64) error {
 }
 
 // AddProofToProofID stores the proof & publicInputs bytes for the given
-// processID and proofID. Important: if the processID & proofID does not exist
-// in the db yet, this method will not return any error, but will not store the
-// data.
-func (r *SQLite) AddProofToProofID(processID, proofID uint64, proof, publicInputs []byte) error {
+// processID, proofID and prover. Important: if the processID, proofID & prover
+// do not exist in the db yet, this method will not return any error, but will
+// not store the data.
+func (r *SQLite) AddProofToProofID(processID, proofID uint64, prover string,
+	proof, publicInputs []byte) error {
 	sqlQuery := `
 	UPDATE proofs
 	SET proof = ?, publicInputs = ?, proofAddedDatetime = CURRENT_TIMESTAMP
-	WHERE (processID = ? AND proofID = ?)
+	WHERE (processID = ? AND proofID = ? AND prover = ?)
 	`
 
 	stmt, err := r.db.Prepare(sqlQuery)
@@ -61,7 +65,32 @@ func (r *SQLite) AddProofToProofID(processID, proofID uint64, proof, publicInput
 	}
 	defer stmt.Close() //nolint:errcheck
 
-	_, err = stmt.Exec(proof, publicInputs, processID, proofID)
+	_, err = stmt.Exec(proof, publicInputs, processID, proofID, prover)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetProofError stores the reason why the proof of the given processID,
+// proofID and prover has been rejected, together with the rejected proof &
+// publicInputs bytes
+func (r *SQLite) SetProofError(processID, proofID uint64, prover string, proof,
+	publicInputs []byte, errMsg string) error {
+	sqlQuery := `
+	UPDATE proofs
+	SET proof = ?, publicInputs = ?, proofAddedDatetime = CURRENT_TIMESTAMP,
+		errMsg = ?
+	WHERE (processID = ? AND proofID = ? AND prover = ?)
+	`
+
+	stmt, err := r.db.Prepare(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close() //nolint:errcheck
+
+	_, err = stmt.Exec(proof, publicInputs, errMsg, processID, proofID, prover)
 	if err != nil {
 		return err
 	}
@@ -77,21 +106,23 @@ func (r *SQLite) GetProofByProcessID(processID uint64) (*types.ProofInDB, error)
 
 	var proof types.ProofInDB
 	err := row.Scan(&proof.ProofID, &proof.Proof, &proof.PublicInputs,
-		&proof.InsertedDatetime, &proof.ProofAddedDatetime, &proof.ProcessID)
+		&proof.InsertedDatetime, &proof.ProofAddedDatetime, &proof.ProcessID,
+		&proof.Error, &proof.Prover)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil,
-				fmt.Errorf("%s, ProcessID: %d", ErrProofNotInDB, processID)
+				fmt.Errorf("%w, ProcessID: %d", ErrProofNotInDB, processID)
 		}
 		return nil, err
 	}
 	return &proof, nil
 }
 
-// GetProofsByProcessID returns the stored proofs for a given ProcessID
+// GetProofsByProcessID returns the stored proofs for a given ProcessID, which
+// are the history of proof attempts, sorted from the last one
 func (r *SQLite) GetProofsByProcessID(processID uint64) ([]types.ProofInDB, error) {
 	rows, err := r.db.Query(
-		"SELECT * FROM proofs WHERE processID = ? ORDER BY proofAddedDatetime DESC",
+		"SELECT * FROM proofs WHERE processID = ? ORDER BY rowid DESC",
 		processID)
 	if err != nil {
 		return nil, err
@@ -103,7 +134,41 @@ func (r *SQLite) GetProofsByProcessID(processID uint64) ([]types.ProofInDB, erro
 		proof := types.ProofInDB{}
 		err = rows.Scan(&proof.ProofID, &proof.Proof,
 			&proof.PublicInputs, &proof.InsertedDatetime,
-			&proof.ProofAddedDatetime, &proof.ProcessID)
+			&proof.ProofAddedDatetime, &proof.ProcessID, &proof.Error,
+			&proof.Prover)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, nil
+}
+
+// GetPendingProofsByProcessStatus returns the proof attempts that have neither
+// a proof nor an error yet, of the processes that have the given status
+func (r *SQLite) GetPendingProofsByProcessStatus(status types.ProcessStatus) (
+	[]types.ProofInDB, error) {
+	sqlQuery := `
+	SELECT proofs.* FROM proofs
+	INNER JOIN processes ON proofs.processID = processes.id
+	WHERE (processes.status = ? AND length(proofs.proof) = 0
+		AND proofs.errMsg = '')
+	ORDER BY proofs.rowid
+	`
+
+	rows, err := r.db.Query(sqlQuery, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var proofs []types.ProofInDB
+	for rows.Next() {
+		proof := types.ProofInDB{}
+		err = rows.Scan(&proof.ProofID, &proof.Proof,
+			&proof.PublicInputs, &proof.InsertedDatetime,
+			&proof.ProofAddedDatetime, &proof.ProcessID, &proof.Error,
+			&proof.Prover)
 		if err != nil {
 			return nil, err
 		}
@@ -2,10 +2,12 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/aragon/ovote-node/types"
 	qt "github.com/frankban/quicktest"
 )
 
@@ -37,18 +39,20 @@ func TestProof(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 
 	proof, err := sqlite.GetProofByProcessID(processID)
-	c.Assert(err.Error(), qt.Equals, ErrProofNotInDB+", ProcessID: 123")
+	c.Assert(errors.Is(err, ErrProofNotInDB), qt.IsTrue)
+	c.Assert(err.Error(), qt.Equals, ErrProofNotInDB.Error()+", ProcessID: 123")
 	c.Assert(proof, qt.IsNil)
 
 	// expect no error, despite the ProofID is not stored yet
-	err = sqlite.AddProofToProofID(processID, 42, []byte("testproof"), []byte("publicInputs"))
+	err = sqlite.AddProofToProofID(processID, 42, "prover0", []byte("testproof"), []byte("publicInputs"))
 	c.Assert(err, qt.IsNil)
 
 	proof, err = sqlite.GetProofByProcessID(processID)
-	c.Assert(err.Error(), qt.Equals, ErrProofNotInDB+", ProcessID: 123")
+	c.Assert(errors.Is(err, ErrProofNotInDB), qt.IsTrue)
+	c.Assert(err.Error(), qt.Equals, ErrProofNotInDB.Error()+", ProcessID: 123")
 	c.Assert(proof, qt.IsNil)
 
-	err = sqlite.StoreProofID(processID, 42)
+	err = sqlite.StoreProofID(processID, 42, "prover0")
 	c.Assert(err, qt.IsNil)
 
 	proof, err = sqlite.GetProofByProcessID(processID)
@@ -59,7 +63,7 @@ func TestProof(t *testing.T) {
 	// expect proofAddedDatetime to not be set yet
 	c.Assert(proof.ProofAddedDatetime, qt.Equals, time.Time{})
 
-	err = sqlite.AddProofToProofID(processID, 42, []byte("testproof"), []byte("publicInputs"))
+	err = sqlite.AddProofToProofID(processID, 42, "prover0", []byte("testproof"), []byte("publicInputs"))
 	c.Assert(err, qt.IsNil)
 
 	proof, err = sqlite.GetProofByProcessID(processID)
@@ -72,7 +76,7 @@ func TestProof(t *testing.T) {
 	time.Sleep(1 * time.Second)
 
 	// store a different proofID for the same processID
-	err = sqlite.StoreProofID(processID, 43)
+	err = sqlite.StoreProofID(processID, 43, "prover1")
 	c.Assert(err, qt.IsNil)
 
 	// get the Proof for ProcessID, expect the proof to be the proofID=42
@@ -82,7 +86,7 @@ func TestProof(t *testing.T) {
 
 	// store the proofID=43 proof & inputs, and expect to get it when
 	// getting the proof by processID
-	err = sqlite.AddProofToProofID(processID, 43, []byte("testproof"), []byte("publicInputs"))
+	err = sqlite.AddProofToProofID(processID, 43, "prover1", []byte("testproof"), []byte("publicInputs"))
 	c.Assert(err, qt.IsNil)
 	proof, err = sqlite.GetProofByProcessID(processID)
 	c.Assert(err, qt.IsNil)
@@ -92,4 +96,78 @@ func TestProof(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(proofs[0].ProofID, qt.Equals, uint64(43))
 	c.Assert(proofs[1].ProofID, qt.Equals, uint64(42))
+	c.Assert(proofs[0].Error, qt.Equals, "")
+	c.Assert(proofs[0].Prover, qt.Equals, "prover1")
+	c.Assert(proofs[1].Prover, qt.Equals, "prover0")
+
+	// the same proofID from a different prover does not modify the proof
+	err = sqlite.AddProofToProofID(processID, 43, "prover0",
+		[]byte("otherproof"), []byte("publicInputs"))
+	c.Assert(err, qt.IsNil)
+	proof, err = sqlite.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Proof, qt.DeepEquals, []byte("testproof"))
+
+	time.Sleep(1 * time.Second)
+
+	// reject the proofID=43
+	err = sqlite.SetProofError(processID, 43, "prover1", []byte("invalidproof"),
+		[]byte("publicInputs"), "invalid proof")
+	c.Assert(err, qt.IsNil)
+	proof, err = sqlite.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.ProofID, qt.Equals, uint64(43))
+	c.Assert(proof.Proof, qt.DeepEquals, []byte("invalidproof"))
+	c.Assert(proof.Error, qt.Equals, "invalid proof")
+}
+
+func TestPendingProofsByProcessStatus(t *testing.T) {
+	c := qt.New(t)
+
+	database, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+
+	sqlite := NewSQLite(database)
+
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	for i := uint64(0); i < 2; i++ {
+		err = sqlite.StoreProcess(i, []byte("censusRoot"), 100, 10, 20, 20,
+			60, 20, 1)
+		c.Assert(err, qt.IsNil)
+		err = sqlite.UpdateProcessStatus(i, types.ProcessStatusProofGenerating)
+		c.Assert(err, qt.IsNil)
+	}
+
+	// process 0 has a failed attempt, a generated one and a pending one
+	err = sqlite.StoreProofID(0, 1, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.SetProofError(0, 1, "prover0", []byte{}, []byte{}, "timeout")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.StoreProofID(0, 2, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.AddProofToProofID(0, 2, "prover0", []byte("proof"),
+		[]byte("publicInputs"))
+	c.Assert(err, qt.IsNil)
+	err = sqlite.StoreProofID(0, 3, "prover1")
+	c.Assert(err, qt.IsNil)
+	// process 1 has a pending attempt, but a different status
+	err = sqlite.StoreProofID(1, 4, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = sqlite.UpdateProcessStatus(1, types.ProcessStatusFrozen)
+	c.Assert(err, qt.IsNil)
+
+	proofs, err := sqlite.GetPendingProofsByProcessStatus(
+		types.ProcessStatusProofGenerating)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(proofs), qt.Equals, 1)
+	c.Assert(proofs[0].ProcessID, qt.Equals, uint64(0))
+	c.Assert(proofs[0].ProofID, qt.Equals, uint64(3))
+	c.Assert(proofs[0].Prover, qt.Equals, "prover1")
+
+	proofs, err = sqlite.GetPendingProofsByProcessStatus(
+		types.ProcessStatusClosed)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(proofs), qt.Equals, 0)
 }
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/aragon/ovote-node/types"
+)
+
+// ErrResultNotInDB is used to indicate when the result of a process has not
+// been published yet
+var ErrResultNotInDB = errors.New("Result does not exist in db")
+
+// StoreResult stores the result published in the SmartContract for the given
+// processID. A result published again in the SmartContract (with more
+// votes) replaces the stored one, unless it comes from an older ethBlockNum.
+// This method should only be called when updating from SmartContracts.
+func (r *SQLite) StoreResult(processID uint64, receiptsRoot []byte, result,
+	nVotes, ethBlockNum uint64) error {
+	sqlQuery := `
+	INSERT INTO results(
+		processID,
+		receiptsRoot,
+		result,
+		nVotes,
+		ethBlockNum,
+		insertedDatetime
+	) values(?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(processID) DO UPDATE SET
+		receiptsRoot = excluded.receiptsRoot,
+		result = excluded.result,
+		nVotes = excluded.nVotes,
+		ethBlockNum = excluded.ethBlockNum,
+		insertedDatetime = excluded.insertedDatetime
+	WHERE excluded.ethBlockNum >= results.ethBlockNum
+	`
+
+	stmt, err := r.db.Prepare(sqlQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close() //nolint:errcheck
+
+	_, err = stmt.Exec(processID, receiptsRoot, result, nVotes, ethBlockNum)
+	if err != nil {
+		if err.Error() == "FOREIGN KEY constraint failed" {
+			return fmt.Errorf("Can not store Result, ProcessID=%d does not exist",
+				processID)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadResultByProcessID reads the published result for the given processID
+func (r *SQLite) ReadResultByProcessID(processID uint64) (*types.ProcessResult, error) {
+	row := r.db.QueryRow(`
+	SELECT processID, receiptsRoot, result, nVotes, ethBlockNum, insertedDatetime
+	FROM results WHERE processID = ?
+	`, processID)
+
+	var result types.ProcessResult
+	var receiptsRoot []byte
+	err := row.Scan(&result.ProcessID, &receiptsRoot, &result.Result,
+		&result.NVotes, &result.EthBlockNum, &result.InsertedDatetime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w, ProcessID: %d", ErrResultNotInDB, processID)
+		}
+		return nil, err
+	}
+	result.ReceiptsRoot = receiptsRoot
+	return &result, nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestResult(t *testing.T) {
+	c := qt.New(t)
+
+	database, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+
+	sqlite := NewSQLite(database)
+
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	receiptsRoot := []byte("receiptsRoot")
+
+	// expect error when storing the result, as processID does not exist yet
+	err = sqlite.StoreResult(processID, receiptsRoot, 6, 10, 50)
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.Error(), qt.Equals, "Can not store Result, ProcessID=123 does not exist")
+
+	censusRoot := []byte("censusRoot")
+	censusSize := uint64(100)
+	ethBlockNum := uint64(10)
+	resPubStartBlock := uint64(20)
+	resPubWindow := uint64(20)
+	minParticipation := uint8(20)
+	minPositiveVotes := uint8(60)
+	typ := uint8(1)
+
+	err = sqlite.StoreProcess(processID, censusRoot, censusSize,
+		ethBlockNum, resPubStartBlock, resPubWindow, minParticipation,
+		minPositiveVotes, typ)
+	c.Assert(err, qt.IsNil)
+
+	_, err = sqlite.ReadResultByProcessID(processID)
+	c.Assert(err.Error(), qt.Equals, ErrResultNotInDB.Error()+", ProcessID: 123")
+
+	err = sqlite.StoreResult(processID, receiptsRoot, 6, 10, 50)
+	c.Assert(err, qt.IsNil)
+
+	result, err := sqlite.ReadResultByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.ProcessID, qt.Equals, processID)
+	c.Assert([]byte(result.ReceiptsRoot), qt.DeepEquals, receiptsRoot)
+	c.Assert(result.Result, qt.Equals, uint64(6))
+	c.Assert(result.NVotes, qt.Equals, uint64(10))
+	c.Assert(result.EthBlockNum, qt.Equals, uint64(50))
+
+	// the result published again with more votes replaces the stored one
+	receiptsRoot2 := []byte("receiptsRoot2")
+	err = sqlite.StoreResult(processID, receiptsRoot2, 8, 12, 55)
+	c.Assert(err, qt.IsNil)
+	result, err = sqlite.ReadResultByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert([]byte(result.ReceiptsRoot), qt.DeepEquals, receiptsRoot2)
+	c.Assert(result.Result, qt.Equals, uint64(8))
+	c.Assert(result.NVotes, qt.Equals, uint64(12))
+	c.Assert(result.EthBlockNum, qt.Equals, uint64(55))
+
+	// while a result from an older block is ignored
+	err = sqlite.StoreResult(processID, receiptsRoot, 6, 10, 50)
+	c.Assert(err, qt.IsNil)
+	result, err = sqlite.ReadResultByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert([]byte(result.ReceiptsRoot), qt.DeepEquals, receiptsRoot2)
+	c.Assert(result.EthBlockNum, qt.Equals, uint64(55))
+}
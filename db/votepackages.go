@@ -1,16 +1,27 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
+	"time"
 
 	"github.com/aragon/ovote-node/types"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/vocdoni/arbo"
 )
 
-// StoreVotePackage stores the given types.VotePackage for the given CensusRoot
-func (r *SQLite) StoreVotePackage(processID uint64, vote types.VotePackage) error {
-	// TODO check that processID exists
-	sqlQuery := `
+var (
+	// ErrVoteNotInDB is used to indicate when the vote does not exist in the db
+	ErrVoteNotInDB = errors.New("Vote does not exist in db")
+	// ErrVoteAlreadyStored is used to indicate that a vote of the same
+	// PublicKey or census index is already stored
+	ErrVoteAlreadyStored = errors.New("Vote already stored")
+)
+
+const insertVotePackageQuery = `
 	INSERT INTO votepackages(
 		indx,
 		publicKey,
@@ -18,17 +29,58 @@ func (r *SQLite) StoreVotePackage(processID uint64, vote types.VotePackage) erro
 		merkleproof,
 		signature,
 		vote,
+		hash,
 		insertedDatetime,
 		processID
-	) values(?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+	) values(?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
 	`
 
-	stmt, err := r.db.Prepare(sqlQuery)
+// StoreVotePackage stores the given types.VotePackage for the given CensusRoot,
+// together with its hash.
+func (r *SQLite) StoreVotePackage(processID uint64, vote types.VotePackage) error {
+	// TODO check that processID exists
+	stmt, err := r.db.Prepare(insertVotePackageQuery)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close() //nolint:errcheck
 
+	return storeVotePackage(stmt, processID, vote)
+}
+
+// StoreVotePackages stores the given types.VotePackages for the given
+// CensusRoot in a single transaction. The votes that can not be stored are
+// skipped, and their errors are returned at the position of each vote.
+func (r *SQLite) StoreVotePackages(processID uint64,
+	votes []types.VotePackage) ([]error, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(insertVotePackageQuery)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	defer stmt.Close() //nolint:errcheck
+
+	// a failed insert only reverts its own statement, so the rest of the
+	// votes are stored when the transaction is committed
+	errs := make([]error, len(votes))
+	for i := 0; i < len(votes); i++ {
+		errs[i] = storeVotePackage(stmt, processID, votes[i])
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func storeVotePackage(stmt *sql.Stmt, processID uint64, vote types.VotePackage) error {
+	hash, err := vote.Hash()
+	if err != nil {
+		return err
+	}
 	if vote.CensusProof.Weight == nil {
 		// no weight defined, use 0
 		vote.CensusProof.Weight = big.NewInt(0)
@@ -36,11 +88,14 @@ func (r *SQLite) StoreVotePackage(processID uint64, vote types.VotePackage) erro
 
 	_, err = stmt.Exec(vote.CensusProof.Index, vote.CensusProof.PublicKey,
 		vote.CensusProof.Weight.Bytes(), vote.CensusProof.MerkleProof,
-		vote.Signature[:], vote.Vote, processID)
+		vote.Signature[:], vote.Vote, hash, processID)
 	if err != nil {
 		if err.Error() == "FOREIGN KEY constraint failed" {
 			return fmt.Errorf("Can not store VotePackage, ProcessID=%d does not exist", processID)
 		}
+		if strings.HasPrefix(err.Error(), "UNIQUE constraint failed") {
+			return fmt.Errorf("%w, %s", ErrVoteAlreadyStored, err)
+		}
 		return err
 	}
 	return nil
@@ -80,3 +135,100 @@ func (r *SQLite) ReadVotePackagesByProcessID(processID uint64) ([]types.VotePack
 	}
 	return votes, nil
 }
+
+// ReadVotePackageByPublicKey reads the stored types.VotePackage for the given
+// ProcessID casted by the given PublicKey
+func (r *SQLite) ReadVotePackageByPublicKey(processID uint64,
+	pubK *babyjub.PublicKey) (*types.VotePackage, error) {
+	sqlQuery := `
+	SELECT signature, indx, publicKey, weight, merkleproof, vote FROM votepackages
+	WHERE processID = ? AND publicKey = ?
+	`
+
+	row := r.db.QueryRow(sqlQuery, processID, pubK)
+
+	vote := types.VotePackage{}
+	var sigBytes []byte
+	var weightBytes []byte
+	err := row.Scan(&sigBytes, &vote.CensusProof.Index,
+		&vote.CensusProof.PublicKey, &weightBytes,
+		&vote.CensusProof.MerkleProof, &vote.Vote)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w, ProcessID: %d", ErrVoteNotInDB, processID)
+		}
+		return nil, err
+	}
+	vote.CensusProof.Weight = new(big.Int).SetBytes(weightBytes)
+	copy(vote.Signature[:], sigBytes)
+	return &vote, nil
+}
+
+// ReadVoteStatusByPublicKey returns the vote, the hash of the VotePackage and
+// the datetime in which it was stored, for the vote of the given PublicKey in
+// the given ProcessID
+func (r *SQLite) ReadVoteStatusByPublicKey(processID uint64,
+	pubK *babyjub.PublicKey) ([]byte, []byte, time.Time, error) {
+	row := r.db.QueryRow(`
+	SELECT vote, hash, insertedDatetime FROM votepackages
+	WHERE processID = ? AND publicKey = ?
+	`, processID, pubK)
+
+	var vote, hash []byte
+	var insertedDatetime time.Time
+	err := row.Scan(&vote, &hash, &insertedDatetime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, time.Time{},
+				fmt.Errorf("%w, ProcessID: %d", ErrVoteNotInDB, processID)
+		}
+		return nil, nil, time.Time{}, err
+	}
+	return vote, hash, insertedDatetime, nil
+}
+
+// HasVotePackage returns true if the VotePackage with the given hash is stored
+// for the given ProcessID
+func (r *SQLite) HasVotePackage(processID uint64, hash []byte) (bool, error) {
+	row := r.db.QueryRow(`
+	SELECT COUNT(*) FROM votepackages WHERE processID = ? AND hash = ?
+	`, processID, hash)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetVotesTally returns the number of votes stored for the given ProcessID,
+// together with the sum of their weights and the sum of their weighted vote
+// values (the result). As the weights may not fit in the SQLite integers, the
+// sums are computed from the stored votes & weights with big.Int.
+func (r *SQLite) GetVotesTally(processID uint64) (uint64, *big.Int, *big.Int, error) {
+	rows, err := r.db.Query(`
+	SELECT vote, weight FROM votepackages WHERE processID = ?
+	`, processID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	nVotes := uint64(0)
+	weight := big.NewInt(0)
+	result := big.NewInt(0)
+	for rows.Next() {
+		var vote, voteWeight []byte
+		if err := rows.Scan(&vote, &voteWeight); err != nil {
+			return 0, nil, nil, err
+		}
+		w := new(big.Int).SetBytes(voteWeight)
+		nVotes++
+		weight.Add(weight, w)
+		result.Add(result, new(big.Int).Mul(arbo.BytesToBigInt(vote), w))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, nil, err
+	}
+	return nVotes, weight, result, nil
+}
@@ -2,10 +2,12 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"math/big"
 	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aragon/ovote-node/test"
 	"github.com/aragon/ovote-node/types"
@@ -91,11 +93,112 @@ func TestStoreAndReadVotes(t *testing.T) {
 
 	// try to store a vote with already stored index
 	err = sqlite.StoreVotePackage(processID, votesAdded[0])
-	c.Assert(err, qt.Not(qt.IsNil))
-	c.Assert(err.Error(), qt.Equals, "UNIQUE constraint failed: votepackages.indx")
+	c.Assert(errors.Is(err, ErrVoteAlreadyStored), qt.IsTrue)
+	c.Assert(err.Error(), qt.Equals,
+		"Vote already stored, UNIQUE constraint failed: votepackages.indx")
 
 	// read the stored votes
 	votes, err := sqlite.ReadVotePackagesByProcessID(processID)
 	c.Assert(err, qt.IsNil)
 	c.Assert(len(votes), qt.Equals, nVotes)
+
+	// read a single vote by its PublicKey
+	votePackage2, err := sqlite.ReadVotePackageByPublicKey(processID,
+		votesAdded[3].CensusProof.PublicKey)
+	c.Assert(err, qt.IsNil)
+	c.Assert(votePackage2.CensusProof.Index, qt.Equals, uint64(3))
+	c.Assert(votePackage2.Signature, qt.DeepEquals, votesAdded[3].Signature)
+
+	_, err = sqlite.ReadVotePackageByPublicKey(processID, &keys.PublicKeys[0])
+	c.Assert(err.Error(), qt.Equals, ErrVoteNotInDB.Error()+", ProcessID: 123")
+
+	// read the vote status by PublicKey
+	voteBytes, hash, insertedDatetime, err := sqlite.ReadVoteStatusByPublicKey(
+		processID, votesAdded[3].CensusProof.PublicKey)
+	c.Assert(err, qt.IsNil)
+	c.Assert(voteBytes, qt.DeepEquals, []byte(votesAdded[3].Vote))
+	expectedHash, err := votesAdded[3].Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash, qt.DeepEquals, expectedHash)
+	c.Assert(insertedDatetime, qt.Not(qt.Equals), time.Time{})
+
+	_, _, _, err = sqlite.ReadVoteStatusByPublicKey(processID, &keys.PublicKeys[0])
+	c.Assert(errors.Is(err, ErrVoteNotInDB), qt.IsTrue)
+
+	// check the stored VotePackages by hash
+	stored, err := sqlite.HasVotePackage(processID, expectedHash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsTrue)
+	stored, err = sqlite.HasVotePackage(processID+1, expectedHash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.IsFalse)
+
+	// get the tally of the stored votes
+	nVotesInDB, weight, result, err := sqlite.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotesInDB, qt.Equals, uint64(nVotes))
+	c.Assert(weight.Int64(), qt.Equals, int64(nVotes))
+	voteValue := arbo.BytesToBigInt([]byte("test")).Int64()
+	c.Assert(result.Int64(), qt.Equals, int64(nVotes)*voteValue)
+
+	// tally of a process without votes
+	nVotesInDB, weight, result, err = sqlite.GetVotesTally(processID + 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotesInDB, qt.Equals, uint64(0))
+	c.Assert(weight.Int64(), qt.Equals, int64(0))
+	c.Assert(result.Int64(), qt.Equals, int64(0))
+}
+
+func TestStoreVotePackages(t *testing.T) {
+	c := qt.New(t)
+
+	db, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
+	c.Assert(err, qt.IsNil)
+	sqlite := NewSQLite(db)
+	err = sqlite.Migrate()
+	c.Assert(err, qt.IsNil)
+
+	processID := uint64(123)
+	err = sqlite.StoreProcess(processID, []byte("censusRoot"), 100, 10, 20,
+		20, 60, 20, 1)
+	c.Assert(err, qt.IsNil)
+
+	nVotes := 5
+	keys := test.GenUserKeys(nVotes)
+	var votes []types.VotePackage
+	for i := 0; i < nVotes; i++ {
+		votes = append(votes, types.VotePackage{
+			CensusProof: types.CensusProof{
+				Index:       uint64(i),
+				PublicKey:   &keys.PublicKeys[i],
+				Weight:      big.NewInt(1),
+				MerkleProof: []byte("test" + strconv.Itoa(i)),
+			},
+			Vote: []byte{1},
+		})
+	}
+	// a different vote for an already used index
+	repeatedIndex := votes[1]
+	repeatedIndex.Vote = []byte{0}
+	// a weight that does not fit in an int64
+	bigWeight, ok := new(big.Int).SetString("100000000000000000000", 10)
+	c.Assert(ok, qt.IsTrue)
+	votes[0].CensusProof.Weight = bigWeight
+	batch := append(votes, repeatedIndex)
+
+	errs, err := sqlite.StoreVotePackages(processID, batch)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(errs), qt.Equals, len(batch))
+	for i := 0; i < nVotes; i++ {
+		c.Assert(errs[i], qt.IsNil)
+	}
+	c.Assert(errors.Is(errs[nVotes], ErrVoteAlreadyStored), qt.IsTrue)
+
+	// the valid votes are stored, and the tally does not overflow
+	nVotesInDB, weight, result, err := sqlite.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotesInDB, qt.Equals, uint64(nVotes))
+	expected := new(big.Int).Add(bigWeight, big.NewInt(int64(nVotes-1)))
+	c.Assert(weight.String(), qt.Equals, expected.String())
+	c.Assert(result.String(), qt.Equals, expected.String())
 }
@@ -241,6 +241,14 @@ func (c *Client) processEventLog(eventLog types.Log) error {
 		}
 		log.Debugf("Event: (blocknum: %d) %s",
 			eventLog.BlockNumber, e)
+		// store the result in the db, so that the receipts can be
+		// checked against the published ReceiptsRoot
+		err = c.db.StoreResult(e.ProcessID, e.ReceiptsRoot[:], e.Result,
+			e.NVotes, eventLog.BlockNumber)
+		if err != nil {
+			return fmt.Errorf("error storing result: %x, err: %s",
+				eventLog.Data, err)
+		}
 	case eventProcessClosedLen:
 		e, err := parseEventProcessClosed(eventLog.Data)
 		if err != nil {
@@ -250,6 +258,13 @@ func (c *Client) processEventLog(eventLog types.Log) error {
 		}
 		log.Debugf("Event: (blocknum: %d) %s",
 			eventLog.BlockNumber, e)
+		// the proof of the process is no longer needed, the pending
+		// proof generations are cancelled by the VotesAggregator
+		err = c.db.CloseProcess(e.ProcessID)
+		if err != nil {
+			return fmt.Errorf("error closing process: %x, err: %s",
+				eventLog.Data, err)
+		}
 	default:
 		fmt.Printf("LOG in block %d:\n %x \n", eventLog.BlockNumber, eventLog.Data)
 		return fmt.Errorf("unrecognized event log with length %d", l)
@@ -10,6 +10,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/mitchellh/mapstructure v1.4.1
 	github.com/spf13/pflag v1.0.5
+	github.com/ugorji/go/codec v1.1.7
 	github.com/vocdoni/arbo v0.0.0-20220204101222-688a2e814db0
 	go.vocdoni.io/dvote v1.0.4-0.20211025120558-83c64f440044
 )
@@ -49,7 +50,6 @@ require (
 	github.com/shirou/gopsutil v3.21.8+incompatible // indirect
 	github.com/tklauser/go-sysconf v0.3.5 // indirect
 	github.com/tklauser/numcpus v0.2.2 // indirect
-	github.com/ugorji/go/codec v1.1.7 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.18.1 // indirect
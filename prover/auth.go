@@ -0,0 +1,101 @@
+package prover
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// AuthClientHeader is the http header that contains the ID of the
+	// client that signs the request
+	AuthClientHeader = "X-Client-ID"
+	// AuthTimestampHeader is the http header that contains the unix time at
+	// which the request was signed
+	AuthTimestampHeader = "X-Timestamp"
+	// AuthNonceHeader is the http header that contains the random nonce of
+	// the signed request, used by the server to reject replayed requests
+	AuthNonceHeader = "X-Nonce"
+	// AuthSignatureHeader is the http header that contains the signature of
+	// the request
+	AuthSignatureHeader = "X-Signature"
+	// AuthMaxClockSkew is the maximum difference between the timestamp of a
+	// signed request and the time at which it is verified
+	AuthMaxClockSkew = 5 * time.Minute
+	// nonceLen is the number of random bytes of the request nonces
+	nonceLen = 16
+)
+
+var (
+	// ErrInvalidRequestSignature is returned when the signature of a request
+	// does not match
+	ErrInvalidRequestSignature = errors.New("invalid request signature")
+	// ErrRequestExpired is returned when the timestamp of a signed request
+	// is out of the AuthMaxClockSkew
+	ErrRequestExpired = errors.New("request timestamp out of range")
+	// ErrRequestReplayed is returned when the nonce of a signed request has
+	// already been used
+	ErrRequestReplayed = errors.New("request nonce already used")
+)
+
+// requestMessage returns the message signed for a request, which binds the
+// method, the uri (path & query), the timestamp, the nonce and the body
+func requestMessage(method, uri, timestamp, nonce string, body []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// SignRequest sets the authentication headers of the given request, with the
+// hex encoded HMAC-SHA256 of the request with the given secret. Each request
+// is signed with a new random nonce.
+func SignRequest(req *http.Request, clientID string, secret, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	var nonceBytes [nonceLen]byte
+	if _, err := rand.Read(nonceBytes[:]); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes[:])
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(requestMessage(req.Method, req.URL.RequestURI(),
+		timestamp, nonce, body))
+	req.Header.Set(AuthClientHeader, clientID)
+	req.Header.Set(AuthTimestampHeader, timestamp)
+	req.Header.Set(AuthNonceHeader, nonce)
+	req.Header.Set(AuthSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// VerifyRequest checks that the given signature is the HMAC-SHA256 of the
+// request with the given secret, and that its timestamp is in the
+// AuthMaxClockSkew. The nonce is required, but it is up to the caller to
+// reject the nonces already used in the last 2*AuthMaxClockSkew, the window in
+// which a signed request is accepted.
+func VerifyRequest(secret []byte, method, uri, timestamp, nonce string,
+	body []byte, signature string) error {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrRequestExpired
+	}
+	skew := time.Since(time.Unix(t, 0))
+	if skew > AuthMaxClockSkew || skew < -AuthMaxClockSkew {
+		return ErrRequestExpired
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || nonce == "" {
+		return ErrInvalidRequestSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(requestMessage(method, uri, timestamp, nonce, body))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidRequestSignature
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package prover
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRequestSignature(t *testing.T) {
+	c := qt.New(t)
+
+	secret := []byte("secret")
+	body := []byte(`{"id": 1}`)
+	req, err := http.NewRequest(http.MethodPost,
+		"http://127.0.0.1:9000/proof?callback=x", nil)
+	c.Assert(err, qt.IsNil)
+	err = SignRequest(req, "node0", secret, body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(req.Header.Get(AuthClientHeader), qt.Equals, "node0")
+
+	timestamp := req.Header.Get(AuthTimestampHeader)
+	nonce := req.Header.Get(AuthNonceHeader)
+	c.Assert(nonce, qt.HasLen, 2*nonceLen)
+	sig := req.Header.Get(AuthSignatureHeader)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		timestamp, nonce, body, sig)
+	c.Assert(err, qt.IsNil)
+
+	// any change in the request invalidates the signature
+	err = VerifyRequest([]byte("other"), http.MethodPost, "/proof?callback=x",
+		timestamp, nonce, body, sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodDelete, "/proof?callback=x",
+		timestamp, nonce, body, sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=y",
+		timestamp, nonce, body, sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		timestamp, nonce, []byte(`{"id": 2}`), sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		timestamp, nonce, body, "not hex")
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		timestamp, "other", body, sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		timestamp, "", body, sig)
+	c.Assert(err, qt.Equals, ErrInvalidRequestSignature)
+
+	// each request is signed with a different nonce
+	err = SignRequest(req, "node0", secret, body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(req.Header.Get(AuthNonceHeader), qt.Not(qt.Equals), nonce)
+
+	// the timestamp has to be in the allowed clock skew
+	old := strconv.FormatInt(time.Now().Add(-2*AuthMaxClockSkew).Unix(), 10)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		old, nonce, body, sig)
+	c.Assert(err, qt.Equals, ErrRequestExpired)
+	err = VerifyRequest(secret, http.MethodPost, "/proof?callback=x",
+		"", nonce, body, sig)
+	c.Assert(err, qt.Equals, ErrRequestExpired)
+}
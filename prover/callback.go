@@ -0,0 +1,55 @@
+package prover
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// CallbackSignatureHeader is the http header that contains the signature of
+// the proof completion callbacks
+const CallbackSignatureHeader = "X-Signature"
+
+// Callback is the body of the request sent by the prover-server to the node
+// when a proof has been generated. As the whole body is signed, the
+// signature binds the proof to the process, the prover and the proof attempt.
+type Callback struct {
+	ProcessID uint64 `json:"processID"`
+	// Prover is the ID of the prover in the node, given by the node when
+	// requesting the proof
+	Prover string `json:"prover"`
+	ID     uint64 `json:"id"`
+	// Timestamp is the unix time at which the callback was signed
+	Timestamp    int64           `json:"timestamp"`
+	Proof        json.RawMessage `json:"proof"`
+	PublicInputs json.RawMessage `json:"publicInputs"`
+}
+
+// Expired returns true if the Timestamp of the callback is out of the
+// AuthMaxClockSkew
+func (cb *Callback) Expired() bool {
+	skew := time.Since(time.Unix(cb.Timestamp, 0))
+	return skew > AuthMaxClockSkew || skew < -AuthMaxClockSkew
+}
+
+// SignCallback returns the hex encoded HMAC-SHA256 of the given callback body
+// with the given secret
+func SignCallback(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback returns true if the given signature is the HMAC-SHA256 of the
+// callback body with the given secret
+func VerifyCallback(secret, body []byte, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,32 @@
+package prover
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCallbackSignature(t *testing.T) {
+	c := qt.New(t)
+
+	secret := []byte("secret")
+	body := []byte(`{"id": 1}`)
+	sig := SignCallback(secret, body)
+	c.Assert(VerifyCallback(secret, body, sig), qt.IsTrue)
+	c.Assert(VerifyCallback([]byte("other"), body, sig), qt.IsFalse)
+	c.Assert(VerifyCallback(secret, []byte(`{"id": 2}`), sig), qt.IsFalse)
+	c.Assert(VerifyCallback(secret, body, "not hex"), qt.IsFalse)
+	c.Assert(VerifyCallback(secret, body, ""), qt.IsFalse)
+}
+
+func TestCallbackExpired(t *testing.T) {
+	c := qt.New(t)
+
+	cb := Callback{Timestamp: time.Now().Unix()}
+	c.Assert(cb.Expired(), qt.IsFalse)
+	cb.Timestamp = time.Now().Add(-AuthMaxClockSkew - time.Minute).Unix()
+	c.Assert(cb.Expired(), qt.IsTrue)
+	cb.Timestamp = time.Now().Add(AuthMaxClockSkew + time.Minute).Unix()
+	c.Assert(cb.Expired(), qt.IsTrue)
+}
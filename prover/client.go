@@ -4,35 +4,127 @@ package prover
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/aragon/ovote-node/types"
 )
 
+const (
+	// requestTimeout is the deadline of the requests to the prover-server,
+	// which include the upload of the ZKInputs
+	requestTimeout = time.Minute
+)
+
+// statusTimeout is the deadline of the status requests, which are sent to all
+// the provers before each proof generation
+var statusTimeout = 5 * time.Second
+
 // Client implements the prover http client, used to make requests to the
 // prover server
 type Client struct {
 	url string
 	c   *http.Client
+	// callbacks determines if the prover-server is requested to send the
+	// generated proofs to the callback url configured for this client
+	callbacks bool
+	// clientID & secret are used to sign the requests, if the secret is
+	// empty the requests are not signed
+	clientID string
+	secret   []byte
 }
 
 // NewClient returns a new Client for the given proverURL
 func NewClient(proverURL string) *Client {
-	httpClient := &http.Client{}
+	httpClient := &http.Client{Timeout: requestTimeout}
 	return &Client{
 		url: proverURL,
 		c:   httpClient,
 	}
 }
 
+// ID returns the url of the prover-server, which identifies the Client
+func (c *Client) ID() string {
+	return c.url
+}
+
+// EnableCallbacks requests the prover-server to send the generated proofs to
+// the callback url configured for this client, signed with its secret
+func (c *Client) EnableCallbacks() {
+	c.callbacks = true
+}
+
+// SetAuth sets the clientID & secret registered in the prover-server, used to
+// sign the requests
+func (c *Client) SetAuth(clientID string, secret []byte) {
+	c.clientID = clientID
+	c.secret = secret
+}
+
 type errorMsg struct {
 	Message string `json:"message"`
 }
 
+// statusError is the error returned by the prover-server with a status code
+// that identifies it, it keeps the message of the prover-server and unwraps
+// to the matching sentinel error
+type statusError struct {
+	msg string
+	err error
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+func (e *statusError) Unwrap() error { return e.err }
+
+// statusErrors maps the status codes of the prover-server responses to the
+// sentinel errors
+var statusErrors = map[int]error{
+	http.StatusConflict:           ErrProofNotReady,
+	http.StatusServiceUnavailable: ErrProverUnavailable,
+}
+
+// Status contains the status of the prover-server workers and queue
+type Status struct {
+	Status      string `json:"status"`
+	Workers     int    `json:"workers"`
+	BusyWorkers int    `json:"busyWorkers"`
+	Queued      int    `json:"queued"`
+	// EstimatedWait is the estimated number of seconds until a new proof
+	// generation would start
+	EstimatedWait uint64 `json:"estimatedWait"`
+}
+
+// HasCapacity returns true if a new proof generation would be started without
+// waiting for the other jobs
+func (s *Status) HasCapacity() bool {
+	return s.BusyWorkers+s.Queued < s.Workers
+}
+
+// Status returns the current Status of the prover-server
+func (c *Client) Status() (*Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	body, err := c.doCtx(ctx, http.MethodGet, "/status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var status Status
+	if err = json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
 // GenProof sends the given ZKInputs to the prover-server to trigger the
 // zkProof generation
 func (c *Client) GenProof(processID uint64, zki *types.ZKInputs) (uint64, error) {
@@ -40,26 +132,18 @@ func (c *Client) GenProof(processID uint64, zki *types.ZKInputs) (uint64, error)
 	if err != nil {
 		return 0, err
 	}
-	resp, err := c.c.Post(
-		c.url+"/proof", "application/json", bytes.NewBuffer(jsonZKI))
-	if err != nil {
-		return 0, err
+	path := "/proof"
+	if c.callbacks {
+		// the processID & prover are included in the signed callback
+		path += fmt.Sprintf("?callback=true&processid=%d&prover=%s",
+			processID, url.QueryEscape(c.url))
 	}
-
-	// resp.body.id contains the id to use to retrieve the proof later
-	body, err := ioutil.ReadAll(resp.Body)
+	// body.id contains the id to use to retrieve the proof later
+	body, err := c.do(http.MethodPost, path, jsonZKI)
 	if err != nil {
 		return 0, err
 	}
 
-	if resp.StatusCode == http.StatusBadRequest {
-		var errMsg errorMsg
-		if err = json.Unmarshal(body, &errMsg); err != nil {
-			return 0, err
-		}
-		return 0, errors.New(errMsg.Message)
-	}
-
 	var m map[string]uint64
 	err = json.Unmarshal(body, &m)
 	if err != nil {
@@ -70,15 +154,24 @@ func (c *Client) GenProof(processID uint64, zki *types.ZKInputs) (uint64, error)
 }
 
 // GetProof retrieves the genereted proof and publicInputs (if already
-// generated) from the prover-server for the given proofID
+// generated) from the prover-server for the given proofID. If the proof
+// generation has failed, ErrProofFailed is returned.
 func (c *Client) GetProof(proofID uint64) ([]byte, []byte, error) {
 	// request proof
-	proof, err := c.getProof(proofID)
+	proof, err := c.do(http.MethodGet,
+		"/proof/"+strconv.FormatUint(proofID, 10), nil)
 	if err != nil {
+		if !errors.Is(err, ErrProofNotReady) &&
+			!errors.Is(err, ErrProverUnavailable) {
+			if errFailed := c.proofFailed(proofID); errFailed != nil {
+				return nil, nil, errFailed
+			}
+		}
 		return nil, nil, err
 	}
 	// request publicInputs
-	publicInputs, err := c.getPublicInputs(proofID)
+	publicInputs, err := c.do(http.MethodGet,
+		"/proof/"+strconv.FormatUint(proofID, 10)+"/public", nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -86,46 +179,94 @@ func (c *Client) GetProof(proofID uint64) ([]byte, []byte, error) {
 	return proof, publicInputs, nil
 }
 
-func (c *Client) getProof(proofID uint64) ([]byte, error) {
-	resp, err := c.c.Get(
-		c.url + "/proof/" + strconv.Itoa(int(proofID)))
+// jobStatus is the status of a proof generation in the prover-server
+type jobStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// proofFailed returns ErrProofFailed if the status of the given proofID in the
+// prover-server is failed or cancelled, and nil otherwise
+func (c *Client) proofFailed(proofID uint64) error {
+	body, err := c.do(http.MethodGet,
+		"/proof/"+strconv.FormatUint(proofID, 10)+"/status", nil)
 	if err != nil {
-		return nil, err
+		return nil
+	}
+	var status jobStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil
 	}
+	if status.Status != "failed" && status.Status != "cancelled" {
+		return nil
+	}
+	return fmt.Errorf("%w, id: %d, status: %s, error: %s", ErrProofFailed,
+		proofID, status.Status, status.Error)
+}
+
+// Cancel requests the prover-server to stop the generation of the given
+// proofID
+func (c *Client) Cancel(proofID uint64) error {
+	_, err := c.do(http.MethodDelete,
+		"/proof/"+strconv.FormatUint(proofID, 10), nil)
+	return err
+}
+
+// Release confirms to the prover-server the retrieval of the given proofID,
+// which is removed depending on the prover-server retention policy
+func (c *Client) Release(proofID uint64) error {
+	// the prover-server releases the finished jobs on DELETE
+	return c.Cancel(proofID)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// do sends a request with the given body (nil if none) to the given path of
+// the prover-server, signed if the Client has a secret, and returns the
+// response body. The responses with an error status are returned as errors.
+func (c *Client) do(method, path string, body []byte) ([]byte, error) {
+	return c.doCtx(context.Background(), method, path, body)
+}
+
+// doCtx is do with the given context
+func (c *Client) doCtx(ctx context.Context, method, path string,
+	body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reqBody)
 	if err != nil {
 		return nil, err
 	}
-
-	if resp.StatusCode == http.StatusBadRequest {
-		var errMsg errorMsg
-		if err = json.Unmarshal(body, &errMsg); err != nil {
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.secret) > 0 {
+		if err := SignRequest(req, c.clientID, c.secret, body); err != nil {
 			return nil, err
 		}
-		return nil, errors.New(errMsg.Message)
 	}
-	return body, nil
-}
-
-func (c *Client) getPublicInputs(proofID uint64) ([]byte, error) {
-	resp, err := c.c.Get(
-		c.url + "/proof/" + strconv.Itoa(int(proofID)) + "/public")
+	resp, err := c.c.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrProverUnavailable, err)
 	}
+	defer resp.Body.Close() //nolint:errcheck
 
-	body, err := ioutil.ReadAll(resp.Body)
+	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusBadRequest {
+	if resp.StatusCode != http.StatusOK {
+		msg := fmt.Sprintf("unexpected status code %d", resp.StatusCode)
 		var errMsg errorMsg
-		if err = json.Unmarshal(body, &errMsg); err != nil {
-			return nil, err
+		if err = json.Unmarshal(respBody, &errMsg); err == nil &&
+			errMsg.Message != "" {
+			msg = errMsg.Message
+		}
+		if sentinel, ok := statusErrors[resp.StatusCode]; ok {
+			return nil, &statusError{msg: msg, err: sentinel}
 		}
-		return nil, errors.New(errMsg.Message)
+		return nil, errors.New(msg)
 	}
-	return body, nil
+	return respBody, nil
 }
@@ -1,9 +1,11 @@
 package prover
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 
@@ -27,6 +29,24 @@ func TestGenProof(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 	c.Assert(pID, qt.Equals, uint64(42))
 
+	// with callback, the process & prover of the proof are sent to the
+	// prover
+	var query url.Values
+	r = gin.Default()
+	r.POST("/proof", func(ctx *gin.Context) {
+		query = ctx.Request.URL.Query()
+		mockGenProof(ctx)
+	})
+	ts = httptest.NewServer(r)
+	defer ts.Close()
+
+	p = NewClient(ts.URL)
+	p.EnableCallbacks()
+	_, err = p.GenProof(1, zki)
+	c.Assert(err, qt.IsNil)
+	c.Assert(query, qt.DeepEquals, url.Values{"callback": {"true"},
+		"processid": {"1"}, "prover": {ts.URL}})
+
 	// now with handler that returns error
 	r = gin.Default()
 	r.POST("/proof", mockGetErr)
@@ -73,6 +93,113 @@ func TestGetProof(t *testing.T) {
 	_, _, err = p.GetProof(1)
 	c.Assert(err, qt.Not(qt.IsNil))
 	c.Assert(err.Error(), qt.Equals, "expected error msg")
+
+	// the proofs not ready are identified by the status code
+	r = gin.Default()
+	r.GET("/proof/:proofID", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusConflict, errorMsg{
+			Message: "proof not ready, id: 1, status: proving",
+		})
+	})
+	ts = httptest.NewServer(r)
+	defer ts.Close()
+
+	p = NewClient(ts.URL)
+	_, _, err = p.GetProof(1)
+	c.Assert(errors.Is(err, ErrProofNotReady), qt.IsTrue)
+	c.Assert(err.Error(), qt.Equals, "proof not ready, id: 1, status: proving")
+
+	// the failed proofs are identified by the status of the job
+	r = gin.Default()
+	r.GET("/proof/:proofID", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusBadRequest, errorMsg{
+			Message: "proof generation failed, id: 1, error: exit status 1",
+		})
+	})
+	r.GET("/proof/:proofID/status", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"id": 1, "status": "failed",
+			"error": "exit status 1"})
+	})
+	tsFailed := httptest.NewServer(r)
+	defer tsFailed.Close()
+
+	_, _, err = NewClient(tsFailed.URL).GetProof(1)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+	c.Assert(err, qt.ErrorMatches, "proof generation failed, id: 1, status: failed,"+
+		" error: exit status 1")
+
+	// and the unreachable prover-servers as unavailable
+	ts.Close()
+	_, _, err = p.GetProof(1)
+	c.Assert(errors.Is(err, ErrProverUnavailable), qt.IsTrue)
+}
+
+func TestStatus(t *testing.T) {
+	c := qt.New(t)
+
+	r := gin.Default()
+	r.GET("/status", mockGetStatus)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	p := NewClient(ts.URL)
+	status, err := p.Status()
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Status, qt.Equals, "busy")
+	c.Assert(status.Workers, qt.Equals, 2)
+	c.Assert(status.BusyWorkers, qt.Equals, 2)
+	c.Assert(status.Queued, qt.Equals, 1)
+	c.Assert(status.EstimatedWait, qt.Equals, uint64(60))
+	c.Assert(status.HasCapacity(), qt.IsFalse)
+
+	// now with handler that returns error
+	r = gin.Default()
+	r.GET("/status", mockGetErr)
+	ts = httptest.NewServer(r)
+	defer ts.Close()
+
+	p = NewClient(ts.URL)
+	_, err = p.Status()
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.Error(), qt.Equals, "expected error msg")
+}
+
+func TestCancel(t *testing.T) {
+	c := qt.New(t)
+
+	r := gin.Default()
+	r.DELETE("/proof/:proofID", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, "cancelled")
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var p Prover = NewClient(ts.URL)
+	err := p.Cancel(1)
+	c.Assert(err, qt.IsNil)
+	err = p.Release(1)
+	c.Assert(err, qt.IsNil)
+
+	// now with handler that returns error
+	r = gin.Default()
+	r.DELETE("/proof/:proofID", mockGetErr)
+	ts = httptest.NewServer(r)
+	defer ts.Close()
+
+	p = NewClient(ts.URL)
+	err = p.Cancel(1)
+	c.Assert(err, qt.ErrorMatches, "expected error msg")
+}
+
+func mockGetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "busy",
+		"workers":       2,
+		"busyWorkers":   2,
+		"queued":        1,
+		"estimatedWait": 60,
+	})
 }
 
 func mockGenProof(c *gin.Context) {
@@ -94,3 +221,43 @@ func mockGetProof(c *gin.Context) {
 func mockGetPublicInputs(c *gin.Context) {
 	c.File("publicinputsTest.json")
 }
+
+func TestClientAuth(t *testing.T) {
+	c := qt.New(t)
+
+	secret := []byte("secret")
+	r := gin.Default()
+	r.Use(func(ctx *gin.Context) {
+		body, err := ioutil.ReadAll(ctx.Request.Body)
+		c.Assert(err, qt.IsNil)
+		err = VerifyRequest(secret, ctx.Request.Method,
+			ctx.Request.URL.RequestURI(),
+			ctx.GetHeader(AuthTimestampHeader),
+			ctx.GetHeader(AuthNonceHeader), body,
+			ctx.GetHeader(AuthSignatureHeader))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized,
+				errorMsg{Message: err.Error()})
+		}
+	})
+	r.GET("/status", mockGetStatus)
+	r.POST("/proof", mockGenProof)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// unsigned requests are rejected
+	p := NewClient(ts.URL)
+	_, err := p.Status()
+	c.Assert(err, qt.ErrorMatches, ErrRequestExpired.Error())
+
+	p.SetAuth("node0", []byte("other"))
+	_, err = p.Status()
+	c.Assert(err, qt.ErrorMatches, ErrInvalidRequestSignature.Error())
+
+	p.SetAuth("node0", secret)
+	_, err = p.Status()
+	c.Assert(err, qt.IsNil)
+	proofID, err := p.GenProof(1, types.NewZKInputs(1, 1))
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofID, qt.Equals, uint64(42))
+}
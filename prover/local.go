@@ -0,0 +1,313 @@
+package prover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/aragon/ovote-node/types"
+	"go.vocdoni.io/dvote/log"
+)
+
+const (
+	localStatusQueued  = "queued"
+	localStatusWitness = "witness"
+	localStatusProving = "proving"
+	localStatusFailed  = "failed"
+)
+
+// ErrProofCancelled is the error recorded for the proof attempts cancelled as
+// they are no longer needed
+var ErrProofCancelled = errors.New("proof generation cancelled")
+
+// LocalOptions contains the paths used by Local to generate the proofs
+type LocalOptions struct {
+	// Dir is the directory where the files of each proof are stored
+	Dir string `json:"dir"`
+	// NodeBin is the path to the node.js binary, used to generate the
+	// witness. If empty, defaults to "node"
+	NodeBin string `json:"nodeBin"`
+	// ProverBin is the path to the prover binary
+	ProverBin string `json:"proverBin"`
+	// Wasm is the path to the circuit wasm
+	Wasm string `json:"wasm"`
+	// WitnessGenerator is the path to the generate_witness.js of the
+	// circuit
+	WitnessGenerator string `json:"witnessGenerator"`
+	// Zkey is the path to the proving key
+	Zkey string `json:"zkey"`
+	// Workers is the number of proofs generated concurrently. If zero,
+	// defaults to 1
+	Workers int `json:"workers"`
+}
+
+// LoadLocalOptions reads the LocalOptions from the given json file
+func LoadLocalOptions(path string) (*LocalOptions, error) {
+	b, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var opts LocalOptions
+	if err := json.Unmarshal(b, &opts); err != nil {
+		return nil, fmt.Errorf("can not parse local prover config: %w", err)
+	}
+	return &opts, nil
+}
+
+type localJob struct {
+	status string
+	err    string
+	cancel context.CancelFunc
+}
+
+// Local is a Prover that runs the witness generator and the prover binary
+// directly from the current process, without a prover-server. The pending
+// proofs are not resumed after a restart, but the generated ones are kept in
+// the Dir.
+type Local struct {
+	opts LocalOptions
+
+	mu     sync.Mutex
+	lastID uint64
+	jobs   map[uint64]*localJob
+	// workers limits the number of proofs generated concurrently
+	workers chan struct{}
+}
+
+// NewLocal returns a new Local Prover with the given LocalOptions
+func NewLocal(opts LocalOptions) (*Local, error) {
+	if opts.Dir == "" || opts.ProverBin == "" || opts.Wasm == "" ||
+		opts.WitnessGenerator == "" || opts.Zkey == "" {
+		return nil, fmt.Errorf("local prover: missing paths")
+	}
+	if opts.NodeBin == "" {
+		opts.NodeBin = "node"
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if err := os.MkdirAll(opts.Dir, 0750); err != nil { //nolint:gomnd
+		return nil, err
+	}
+
+	// continue the ids after the proofs stored in the Dir, so that they
+	// are not reused after a restart
+	entries, err := ioutil.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var lastID uint64
+	for _, e := range entries {
+		id, err := strconv.ParseUint(e.Name(), 10, 64)
+		if err == nil && e.IsDir() && id > lastID {
+			lastID = id
+		}
+	}
+
+	return &Local{
+		opts:    opts,
+		lastID:  lastID,
+		jobs:    make(map[uint64]*localJob),
+		workers: make(chan struct{}, opts.Workers),
+	}, nil
+}
+
+// ID returns the identifier of the Local Prover, determined by its Dir
+func (l *Local) ID() string {
+	return "local:" + l.opts.Dir
+}
+
+func (l *Local) proofDir(proofID uint64) string {
+	return filepath.Join(l.opts.Dir, strconv.FormatUint(proofID, 10))
+}
+
+// GenProof stores the given ZKInputs and starts the proof generation in the
+// background
+func (l *Local) GenProof(processID uint64, zki *types.ZKInputs) (uint64, error) {
+	jsonZKI, err := json.Marshal(zki)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	l.lastID++
+	id := l.lastID
+	ctx, cancel := context.WithCancel(context.Background())
+	l.jobs[id] = &localJob{status: localStatusQueued, cancel: cancel}
+	l.mu.Unlock()
+
+	dir := l.proofDir(id)
+	err = os.MkdirAll(dir, 0750) //nolint:gomnd
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "zkinputs.json"), jsonZKI,
+			0600) //nolint:gomnd
+	}
+	if err != nil {
+		l.setStatus(id, localStatusFailed, err.Error())
+		cancel()
+		return 0, err
+	}
+
+	log.Debugw("local proof generation queued", "processID", processID,
+		"proofID", id)
+	go l.run(ctx, cancel, id)
+	return id, nil
+}
+
+func (l *Local) setStatus(proofID uint64, status, errMsg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	j, ok := l.jobs[proofID]
+	if !ok {
+		return
+	}
+	if j.status == localStatusFailed {
+		return
+	}
+	j.status = status
+	j.err = errMsg
+}
+
+// run generates the witness and the proof of the given proofID, once a worker
+// is available
+func (l *Local) run(ctx context.Context, cancel context.CancelFunc,
+	proofID uint64) {
+	defer cancel()
+	select {
+	case l.workers <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-l.workers }()
+
+	dir := l.proofDir(proofID)
+	l.setStatus(proofID, localStatusWitness, "")
+	// node generate_witness.js circuit.wasm zkinputs.json witness.wtns
+	cmd := exec.CommandContext(ctx, l.opts.NodeBin, //nolint:gosec
+		l.opts.WitnessGenerator, l.opts.Wasm,
+		filepath.Join(dir, "zkinputs.json"), filepath.Join(dir, "witness.wtns"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Errorw("local genWitness failed", "proofID", proofID, "err", err,
+			"output", string(out))
+		l.setStatus(proofID, localStatusFailed, err.Error())
+		return
+	}
+
+	l.setStatus(proofID, localStatusProving, "")
+	// prover circuit.zkey witness.wtns proof.json public.json
+	cmd = exec.CommandContext(ctx, l.opts.ProverBin, l.opts.Zkey, //nolint:gosec
+		filepath.Join(dir, "witness.wtns"), filepath.Join(dir, "proof.json"),
+		filepath.Join(dir, "public.json"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Errorw("local genProof failed", "proofID", proofID, "err", err,
+			"output", string(out))
+		l.setStatus(proofID, localStatusFailed, err.Error())
+		return
+	}
+
+	// once generated, the proof is served from the Dir
+	l.mu.Lock()
+	delete(l.jobs, proofID)
+	l.mu.Unlock()
+}
+
+// GetProof returns the proof and publicInputs of the given proofID, if already
+// generated. The failed proofs, which are forgotten once reported, and the
+// proofs not found, such as the ones pending before a restart, return
+// ErrProofFailed.
+func (l *Local) GetProof(proofID uint64) ([]byte, []byte, error) {
+	l.mu.Lock()
+	j, ok := l.jobs[proofID]
+	var status, errMsg string
+	if ok {
+		status, errMsg = j.status, j.err
+		if status == localStatusFailed {
+			delete(l.jobs, proofID)
+		}
+	}
+	l.mu.Unlock()
+	if ok && status == localStatusFailed {
+		return nil, nil, fmt.Errorf("%w, id: %d, error: %s", ErrProofFailed,
+			proofID, errMsg)
+	}
+	if ok {
+		return nil, nil, fmt.Errorf("%w, id: %d, status: %s",
+			ErrProofNotReady, proofID, status)
+	}
+
+	dir := l.proofDir(proofID)
+	proof, err := ioutil.ReadFile(filepath.Join(dir, "proof.json")) //nolint:gosec
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, proof not found, id: %d",
+			ErrProofFailed, proofID)
+	}
+	publicInputs, err := ioutil.ReadFile(filepath.Join(dir, "public.json")) //nolint:gosec
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, proof not found, id: %d",
+			ErrProofFailed, proofID)
+	}
+	return proof, publicInputs, nil
+}
+
+// Status returns the number of proofs being generated and queued
+func (l *Local) Status() (*Status, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	busy, queued := 0, 0
+	for _, j := range l.jobs {
+		switch j.status {
+		case localStatusQueued:
+			queued++
+		case localStatusWitness, localStatusProving:
+			busy++
+		}
+	}
+	status := "ok"
+	if busy+queued >= l.opts.Workers {
+		status = "busy"
+	}
+	return &Status{
+		Status:      status,
+		Workers:     l.opts.Workers,
+		BusyWorkers: busy,
+		Queued:      queued,
+	}, nil
+}
+
+// Cancel stops the generation of the given proofID, killing its running
+// process, and forgets it
+func (l *Local) Cancel(proofID uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	j, ok := l.jobs[proofID]
+	if !ok {
+		return fmt.Errorf("proof %d is not being generated", proofID)
+	}
+	if j.status == localStatusFailed {
+		return fmt.Errorf("proof %d generation already finished", proofID)
+	}
+	j.cancel()
+	delete(l.jobs, proofID)
+	return nil
+}
+
+// Release removes the files of the given proofID, once generated or failed,
+// and forgets it
+func (l *Local) Release(proofID uint64) error {
+	l.mu.Lock()
+	j, ok := l.jobs[proofID]
+	if ok && j.status != localStatusFailed {
+		l.mu.Unlock()
+		return fmt.Errorf("proof %d is still being generated", proofID)
+	}
+	delete(l.jobs, proofID)
+	l.mu.Unlock()
+	return os.RemoveAll(l.proofDir(proofID))
+}
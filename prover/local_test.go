@@ -0,0 +1,145 @@
+package prover
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/types"
+	qt "github.com/frankban/quicktest"
+)
+
+// writeScript writes an executable shell script with the given body
+func writeScript(c *qt.C, dir, name, body string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0700) //nolint:gosec
+	c.Assert(err, qt.IsNil)
+	return path
+}
+
+func testLocal(c *qt.C, proverBody string) *Local {
+	binDir := c.TempDir()
+	// node generate_witness.js circuit.wasm zkinputs.json witness.wtns
+	nodeBin := writeScript(c, binDir, "node", `cp "$3" "$4"`)
+	// prover circuit.zkey witness.wtns proof.json public.json
+	proverBin := writeScript(c, binDir, "prover", proverBody)
+	l, err := NewLocal(LocalOptions{
+		Dir:              c.TempDir(),
+		NodeBin:          nodeBin,
+		ProverBin:        proverBin,
+		Wasm:             "circuit.wasm",
+		WitnessGenerator: "generate_witness.js",
+		Zkey:             "circuit.zkey",
+	})
+	c.Assert(err, qt.IsNil)
+	return l
+}
+
+// waitProof waits until the given proof is not pending
+func waitProof(c *qt.C, l *Local, proofID uint64) ([]byte, []byte, error) {
+	for i := 0; i < 100; i++ {
+		proof, public, err := l.GetProof(proofID)
+		if err == nil || err.Error()[:15] != "proof not ready" {
+			return proof, public, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Fatal("timeout waiting the proof")
+	return nil, nil, nil
+}
+
+func TestLocal(t *testing.T) {
+	c := qt.New(t)
+
+	l := testLocal(c, `echo "proof" > "$3"; echo "public" > "$4"`)
+	var _ Prover = l
+
+	zki := types.NewZKInputs(2, 2)
+	proofID, err := l.GenProof(1, zki)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofID, qt.Equals, uint64(1))
+	proof, public, err := waitProof(c, l, proofID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(proof), qt.Equals, "proof\n")
+	c.Assert(string(public), qt.Equals, "public\n")
+	status, err := l.Status()
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.HasCapacity(), qt.IsTrue)
+
+	// after a restart, the generated proofs are kept and the ids are not
+	// reused
+	l2, err := NewLocal(l.opts)
+	c.Assert(err, qt.IsNil)
+	_, _, err = l2.GetProof(proofID)
+	c.Assert(err, qt.IsNil)
+	proofID, err = l2.GenProof(1, zki)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofID, qt.Equals, uint64(2))
+
+	// the proofs not found, as the pending ones before a restart, are
+	// failed
+	_, _, err = l.GetProof(42)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+	c.Assert(err, qt.ErrorMatches, "proof generation failed, proof not found, id: 42")
+
+	// once released, the proof files are removed
+	err = l2.Release(1)
+	c.Assert(err, qt.IsNil)
+	_, _, err = l2.GetProof(1)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+}
+
+func TestLocalFailure(t *testing.T) {
+	c := qt.New(t)
+
+	l := testLocal(c, `exit 1`)
+	proofID, err := l.GenProof(1, types.NewZKInputs(2, 2))
+	c.Assert(err, qt.IsNil)
+	_, _, err = waitProof(c, l, proofID)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+	c.Assert(err, qt.ErrorMatches, "proof generation failed, id: 1, error: exit status 1")
+	// the failed job is forgotten once reported
+	l.mu.Lock()
+	c.Assert(l.jobs, qt.HasLen, 0)
+	l.mu.Unlock()
+	_, _, err = l.GetProof(proofID)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+}
+
+func TestLocalCancel(t *testing.T) {
+	c := qt.New(t)
+
+	l := testLocal(c, `sleep 10`)
+	proofID, err := l.GenProof(1, types.NewZKInputs(2, 2))
+	c.Assert(err, qt.IsNil)
+
+	// the second proof waits for the worker
+	proofID2, err := l.GenProof(1, types.NewZKInputs(2, 2))
+	c.Assert(err, qt.IsNil)
+	status, err := l.Status()
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Queued+status.BusyWorkers, qt.Equals, 2)
+	c.Assert(status.HasCapacity(), qt.IsFalse)
+
+	err = l.Cancel(proofID2)
+	c.Assert(err, qt.IsNil)
+	err = l.Cancel(proofID)
+	c.Assert(err, qt.IsNil)
+	// the cancelled jobs are forgotten
+	l.mu.Lock()
+	c.Assert(l.jobs, qt.HasLen, 0)
+	l.mu.Unlock()
+	_, _, err = l.GetProof(proofID)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+	_, _, err = l.GetProof(proofID2)
+	c.Assert(errors.Is(err, ErrProofFailed), qt.IsTrue)
+	err = l.Cancel(proofID)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// the worker is released
+	status, err = l.Status()
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.HasCapacity(), qt.IsTrue)
+}
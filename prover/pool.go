@@ -0,0 +1,152 @@
+package prover
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aragon/ovote-node/types"
+	"go.vocdoni.io/dvote/log"
+)
+
+// ErrNoProverAvailable is returned when none of the provers of the Pool can
+// be reached
+var ErrNoProverAvailable = errors.New("no prover available")
+
+// Pool balances the proof generations between several Provers. Each proof is
+// identified by the ID of the Prover that generates it together with the
+// proofID, so that the proof is retrieved from the same Prover.
+type Pool struct {
+	provers []Prover
+}
+
+// NewPool returns a new Pool with the given Provers
+func NewPool(provers ...Prover) *Pool {
+	return &Pool{provers: provers}
+}
+
+// Prover returns the Prover of the Pool with the given ID. The proofs stored
+// before the provers were balanced have an empty ID, and were generated by
+// the only prover then configured, which is the first one of the Pool.
+func (p *Pool) Prover(proverID string) (Prover, error) {
+	if proverID == "" && len(p.provers) > 0 {
+		return p.provers[0], nil
+	}
+	for i := 0; i < len(p.provers); i++ {
+		if p.provers[i].ID() == proverID {
+			return p.provers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("prover %s not in the pool", proverID)
+}
+
+type candidate struct {
+	prover Prover
+	status *Status
+}
+
+// load returns the pending jobs per worker of the prover
+func (c *candidate) load() float64 {
+	if c.status.Workers == 0 {
+		return float64(c.status.BusyWorkers + c.status.Queued)
+	}
+	return float64(c.status.BusyWorkers+c.status.Queued) /
+		float64(c.status.Workers)
+}
+
+// candidates returns the reachable provers, sorted from the least loaded.
+// The prover with the given avoidID is placed at the end. The provers are
+// queried concurrently, so that an unresponsive prover does not delay the
+// rest.
+func (p *Pool) candidates(avoidID string) []candidate {
+	statuses := make([]*Status, len(p.provers))
+	var wg sync.WaitGroup
+	for i := 0; i < len(p.provers); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			status, err := p.provers[i].Status()
+			if err != nil {
+				log.Warnw("prover unreachable", "prover", p.provers[i].ID(),
+					"err", err)
+				return
+			}
+			statuses[i] = status
+		}(i)
+	}
+	wg.Wait()
+
+	var cs []candidate
+	for i := 0; i < len(p.provers); i++ {
+		if statuses[i] != nil {
+			cs = append(cs, candidate{prover: p.provers[i], status: statuses[i]})
+		}
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		avoidI := cs[i].prover.ID() == avoidID
+		avoidJ := cs[j].prover.ID() == avoidID
+		if avoidI != avoidJ {
+			return avoidJ
+		}
+		return cs[i].load() < cs[j].load()
+	})
+	return cs
+}
+
+// HasCapacity returns true if any of the provers can start a new proof
+// generation without waiting
+func (p *Pool) HasCapacity() bool {
+	cs := p.candidates("")
+	return len(cs) > 0 && cs[0].status.HasCapacity()
+}
+
+// GenProof sends the given ZKInputs to the least loaded reachable prover,
+// failing over to the next ones if the request fails. The prover with the
+// given avoidID (eg. the one that failed the previous attempt) is only used
+// if no other prover is reachable. Returns the ID of the prover that is
+// generating the proof, together with the proofID.
+func (p *Pool) GenProof(processID uint64, zki *types.ZKInputs,
+	avoidID string) (string, uint64, error) {
+	cs := p.candidates(avoidID)
+	for i := 0; i < len(cs); i++ {
+		proofID, err := cs[i].prover.GenProof(processID, zki)
+		if err != nil {
+			log.Warnw("prover GenProof failed", "prover", cs[i].prover.ID(),
+				"err", err)
+			continue
+		}
+		return cs[i].prover.ID(), proofID, nil
+	}
+	return "", 0, ErrNoProverAvailable
+}
+
+// GetProof retrieves the proof and publicInputs for the given proofID from
+// the prover with the given ID
+func (p *Pool) GetProof(proverID string, proofID uint64) ([]byte, []byte, error) {
+	pr, err := p.Prover(proverID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pr.GetProof(proofID)
+}
+
+// Cancel stops the generation of the given proofID in the prover with the
+// given ID
+func (p *Pool) Cancel(proverID string, proofID uint64) error {
+	pr, err := p.Prover(proverID)
+	if err != nil {
+		return err
+	}
+	return pr.Cancel(proofID)
+}
+
+// Release confirms the retrieval of the given proofID to the prover with the
+// given ID
+func (p *Pool) Release(proverID string, proofID uint64) error {
+	pr, err := p.Prover(proverID)
+	if err != nil {
+		return err
+	}
+	return pr.Release(proofID)
+}
@@ -0,0 +1,122 @@
+package prover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/types"
+	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
+)
+
+// mockPoolProver returns a mock of the prover-server with the given number of
+// busy workers, which assigns the given proofID to any proof generation
+func mockPoolProver(busyWorkers int, proofID uint64) *httptest.Server {
+	r := gin.Default()
+	r.GET("/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, Status{Status: "ok", Workers: 2,
+			BusyWorkers: busyWorkers})
+	})
+	r.POST("/proof", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": proofID})
+	})
+	r.GET("/proof/:proofID", func(c *gin.Context) {
+		c.String(http.StatusOK, "proof"+strconv.Itoa(int(proofID)))
+	})
+	r.GET("/proof/:proofID/public", func(c *gin.Context) {
+		c.String(http.StatusOK, "public"+strconv.Itoa(int(proofID)))
+	})
+	return httptest.NewServer(r)
+}
+
+func TestPool(t *testing.T) {
+	c := qt.New(t)
+
+	busy := mockPoolProver(2, 1)
+	defer busy.Close()
+	idle := mockPoolProver(0, 2)
+	defer idle.Close()
+	down := mockPoolProver(0, 3)
+	down.Close()
+
+	zki := types.NewZKInputs(2, 2)
+
+	// the least loaded reachable prover is used
+	p := NewPool(NewClient(down.URL), NewClient(busy.URL), NewClient(idle.URL))
+	c.Assert(p.HasCapacity(), qt.IsTrue)
+	proverURL, proofID, err := p.GenProof(1, zki, "")
+	c.Assert(err, qt.IsNil)
+	c.Assert(proverURL, qt.Equals, idle.URL)
+	c.Assert(proofID, qt.Equals, uint64(2))
+
+	// the avoided prover is only used if there is no other one
+	proverURL, proofID, err = p.GenProof(1, zki, idle.URL)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proverURL, qt.Equals, busy.URL)
+	c.Assert(proofID, qt.Equals, uint64(1))
+
+	// the proof is retrieved from the prover that generated it
+	proof, public, err := p.GetProof(busy.URL, 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(proof), qt.Equals, "proof1")
+	c.Assert(string(public), qt.Equals, "public1")
+	_, _, err = p.GetProof(down.URL+"0", 1)
+	c.Assert(err, qt.ErrorMatches, ".*not in the pool")
+
+	// without capacity, and without reachable provers
+	p = NewPool(NewClient(down.URL), NewClient(busy.URL))
+	c.Assert(p.HasCapacity(), qt.IsFalse)
+	p = NewPool(NewClient(down.URL))
+	c.Assert(p.HasCapacity(), qt.IsFalse)
+	_, _, err = p.GenProof(1, zki, "")
+	c.Assert(err, qt.Equals, ErrNoProverAvailable)
+}
+
+func TestPoolUnresponsiveProver(t *testing.T) {
+	c := qt.New(t)
+
+	// a prover that accepts the connections but never answers
+	stop := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-stop
+		}))
+	defer hanging.Close()
+	defer close(stop)
+	idle := mockPoolProver(0, 2)
+	defer idle.Close()
+
+	defaultStatusTimeout := statusTimeout
+	statusTimeout = 200 * time.Millisecond
+	defer func() { statusTimeout = defaultStatusTimeout }()
+
+	p := NewPool(NewClient(hanging.URL), NewClient(hanging.URL+"/"),
+		NewClient(idle.URL))
+	start := time.Now()
+	proverURL, _, err := p.GenProof(1, types.NewZKInputs(2, 2), "")
+	c.Assert(err, qt.IsNil)
+	c.Assert(proverURL, qt.Equals, idle.URL)
+	// the provers are queried concurrently
+	c.Assert(time.Since(start) < 2*statusTimeout, qt.IsTrue)
+}
+
+func TestPoolLegacyProver(t *testing.T) {
+	c := qt.New(t)
+
+	first := mockPoolProver(0, 1)
+	defer first.Close()
+	second := mockPoolProver(0, 2)
+	defer second.Close()
+
+	// the proofs stored without prover are retrieved from the first one
+	p := NewPool(NewClient(first.URL), NewClient(second.URL))
+	proof, _, err := p.GetProof("", 1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(proof), qt.Equals, "proof1")
+
+	_, _, err = NewPool().GetProof("", 1)
+	c.Assert(err, qt.ErrorMatches, ".*not in the pool")
+}
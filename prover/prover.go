@@ -0,0 +1,39 @@
+package prover
+
+import (
+	"errors"
+
+	"github.com/aragon/ovote-node/types"
+)
+
+var (
+	// ErrProofNotReady is returned when retrieving a proof that is still
+	// being generated
+	ErrProofNotReady = errors.New("proof not ready")
+	// ErrProverUnavailable is returned when the Prover can not be reached
+	ErrProverUnavailable = errors.New("prover unavailable")
+	// ErrProofFailed is returned when retrieving a proof whose generation
+	// has failed or has been cancelled, so it will not be generated
+	ErrProofFailed = errors.New("proof generation failed")
+)
+
+// Prover is implemented by the proving backends used to generate the zkProofs
+// of the processes
+type Prover interface {
+	// ID identifies the Prover, it is stored together with the proofIDs so
+	// that each proof is retrieved from the Prover that generated it
+	ID() string
+	// GenProof triggers the zkProof generation for the given ZKInputs,
+	// returning the proofID used to retrieve it
+	GenProof(processID uint64, zki *types.ZKInputs) (uint64, error)
+	// GetProof returns the proof and publicInputs of the given proofID, if
+	// already generated
+	GetProof(proofID uint64) ([]byte, []byte, error)
+	// Status returns the current load of the Prover
+	Status() (*Status, error)
+	// Cancel stops the generation of the given proofID
+	Cancel(proofID uint64) error
+	// Release confirms the retrieval of the given proofID, so that the
+	// Prover can remove its files
+	Release(proofID uint64) error
+}
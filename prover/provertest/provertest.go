@@ -0,0 +1,434 @@
+// Package provertest provides a mock of the prover-server, to test the
+// proof generation flow without circuits.
+package provertest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
+	bn256 "github.com/ethereum/go-ethereum/crypto/bn256/cloudflare"
+	qt "github.com/frankban/quicktest"
+	"github.com/gin-gonic/gin"
+)
+
+// MockProver is an in-process implementation of the prover-server HTTP API.
+// Instead of computing the witness & running the circuit, it returns valid
+// Groth16 proofs computed from a trapdoor derived from the circuit
+// configuration, so the proofs pass the verification with its
+// VerificationKey.
+type MockProver struct {
+	// VerificationKey in the snarkjs json format, which verifies the
+	// generated proofs
+	VerificationKey []byte
+
+	server             *httptest.Server
+	nMaxVotes, nLevels int
+	trapdoor           *test.Trapdoor
+
+	mu             sync.Mutex
+	jobs           map[uint64]*mockJob
+	lastID         uint64
+	latency        time.Duration
+	failures       int
+	unavailable    bool
+	callbackURL    string
+	callbackSecret []byte
+}
+
+type mockJob struct {
+	ID        uint64    `json:"id"`
+	Circuit   string    `json:"circuit"`
+	Callback  string    `json:"callback,omitempty"`
+	ProcessID uint64    `json:"processID,omitempty"`
+	Prover    string    `json:"prover,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Released  bool      `json:"removed,omitempty"`
+
+	proof, publicInputs []byte
+}
+
+// NewMockProver starts a MockProver for the circuit of the given nMaxVotes &
+// nLevels, which is closed at the end of the test
+func NewMockProver(c *qt.C, nMaxVotes, nLevels int) *MockProver {
+	m := &MockProver{
+		nMaxVotes: nMaxVotes,
+		nLevels:   nLevels,
+		jobs:      make(map[uint64]*mockJob),
+	}
+	var i uint64
+	seed := fmt.Sprintf("mockprover-%d-%d", nMaxVotes, nLevels)
+	m.trapdoor = test.NewTrapdoor(7, func() *big.Int { //nolint:gomnd
+		i++
+		return hashScalar([]byte(seed), i)
+	})
+	var err error
+	m.VerificationKey, err = m.trapdoor.VerificationKey()
+	c.Assert(err, qt.IsNil)
+
+	r := gin.New()
+	r.Use(m.checkAvailable)
+	r.GET("/status", m.getStatus)
+	r.GET("/circuits", m.getCircuits)
+	r.POST("/proof", m.postProof)
+	r.GET("/proof/:id", m.getProof)
+	r.GET("/proof/:id/status", m.getProofStatus)
+	r.GET("/proof/:id/public", m.getPublicInputs)
+	r.DELETE("/proof/:id", m.deleteProof)
+	m.server = httptest.NewServer(r)
+	c.Cleanup(m.server.Close)
+	return m
+}
+
+// hashScalar returns a deterministic field element for the given seed and
+// index
+func hashScalar(seed []byte, i uint64) *big.Int {
+	var iBytes [8]byte
+	binary.BigEndian.PutUint64(iBytes[:], i)
+	h := sha256.Sum256(append(append([]byte{}, seed...), iBytes[:]...))
+	k := new(big.Int).SetBytes(h[:])
+	k.Mod(k, bn256.Order)
+	if k.Sign() == 0 {
+		k.SetInt64(1)
+	}
+	return k
+}
+
+// URL returns the url of the MockProver
+func (m *MockProver) URL() string {
+	return m.server.URL
+}
+
+// SetLatency sets the time that each proof generation takes
+func (m *MockProver) SetLatency(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = latency
+}
+
+// FailNext makes the next n proof generations fail
+func (m *MockProver) FailNext(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = n
+}
+
+// SetUnavailable makes all the requests to the MockProver fail with a 503
+// status, simulating an unreachable prover
+func (m *MockProver) SetUnavailable(unavailable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unavailable = unavailable
+}
+
+// SetCallback enables the proof completion callbacks, sent to the given
+// callbackURL of the client and signed with the given secret, as configured
+// in the clients of the prover-server
+func (m *MockProver) SetCallback(callbackURL string, secret []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbackURL = strings.TrimSuffix(callbackURL, "/")
+	m.callbackSecret = secret
+}
+
+type mockErrorMsg struct {
+	Message string `json:"message"`
+}
+
+func mockReturnErr(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, mockErrorMsg{Message: err.Error()})
+}
+
+func (m *MockProver) checkAvailable(c *gin.Context) {
+	m.mu.Lock()
+	unavailable := m.unavailable
+	m.mu.Unlock()
+	if unavailable {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+	}
+}
+
+func (m *MockProver) getStatus(c *gin.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := 0
+	for _, j := range m.jobs {
+		if j.Status == "proving" {
+			pending++
+		}
+	}
+	busyWorkers := pending
+	if busyWorkers > 1 {
+		busyWorkers = 1
+	}
+	status := "ok"
+	if pending > 0 {
+		status = "busy"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":        status,
+		"workers":       1,
+		"busyWorkers":   busyWorkers,
+		"queued":        pending - busyWorkers,
+		"estimatedWait": uint64(time.Duration(pending) * m.latency / time.Second),
+	})
+}
+
+func (m *MockProver) getCircuits(c *gin.Context) {
+	c.JSON(http.StatusOK, []gin.H{{
+		"name":      "mock",
+		"nMaxVotes": m.nMaxVotes,
+		"nLevels":   m.nLevels,
+	}})
+}
+
+// publicInputs checks that the given zkInputs are valid for the circuit, and
+// returns its public inputs
+func (m *MockProver) publicInputs(zki *types.ZKInputs) ([]*big.Int, error) {
+	if err := zki.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid zkInputs: %w", err)
+	}
+	if zki.Meta.NMaxVotes != m.nMaxVotes || zki.Meta.NLevels != m.nLevels {
+		return nil, fmt.Errorf("zkInputs (nMaxVotes: %d, nLevels: %d) do not"+
+			" match the circuit (nMaxVotes: %d, nLevels: %d)",
+			zki.Meta.NMaxVotes, zki.Meta.NLevels, m.nMaxVotes, m.nLevels)
+	}
+	return zki.PublicInputs(), nil
+}
+
+func (m *MockProver) postProof(c *gin.Context) {
+	var zki types.ZKInputs
+	if err := c.ShouldBindJSON(&zki); err != nil {
+		mockReturnErr(c, err)
+		return
+	}
+	publicInputs, err := m.publicInputs(&zki)
+	if err != nil {
+		mockReturnErr(c, err)
+		return
+	}
+	if circuit := c.Query("circuit"); circuit != "" && circuit != "mock" {
+		mockReturnErr(c, fmt.Errorf("circuit %s not found", circuit))
+		return
+	}
+
+	// the proof is determined by the public inputs
+	seed := []byte{}
+	for i := 0; i < len(publicInputs); i++ {
+		seed = append(seed, publicInputs[i].Bytes()...)
+	}
+	proof, public, err := m.trapdoor.Prove(publicInputs,
+		hashScalar(seed, 0), hashScalar(seed, 1))
+	if err != nil {
+		mockReturnErr(c, err)
+		return
+	}
+
+	var processID uint64
+	if c.Query("callback") == "true" {
+		processID, err = strconv.ParseUint(c.Query("processid"), 10, 64)
+		if err != nil {
+			mockReturnErr(c, fmt.Errorf("invalid processid: %w", err))
+			return
+		}
+		if c.Query("prover") == "" {
+			mockReturnErr(c, fmt.Errorf("prover is required with callback"))
+			return
+		}
+	}
+
+	m.mu.Lock()
+	callback := ""
+	if c.Query("callback") == "true" {
+		if m.callbackURL == "" {
+			m.mu.Unlock()
+			mockReturnErr(c, fmt.Errorf("callbacks are not enabled"))
+			return
+		}
+		callback = fmt.Sprintf("%s/proof/%d/callback", m.callbackURL, processID)
+	}
+	m.lastID++
+	now := time.Now()
+	j := &mockJob{
+		ID:        m.lastID,
+		Circuit:   "mock",
+		Callback:  callback,
+		ProcessID: processID,
+		Prover:    c.Query("prover"),
+		Status:    "proving",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.jobs[j.ID] = j
+	fail := m.failures > 0
+	if fail {
+		m.failures--
+	}
+	latency := m.latency
+	m.mu.Unlock()
+
+	finish := func() {
+		m.finishJob(j, fail, proof, public)
+	}
+	if latency == 0 {
+		finish()
+	} else {
+		time.AfterFunc(latency, finish)
+	}
+	c.JSON(http.StatusOK, gin.H{"id": j.ID})
+}
+
+// finishJob sets the result of the given job, and sends its callback
+func (m *MockProver) finishJob(j *mockJob, fail bool, proof, public []byte) {
+	m.mu.Lock()
+	if j.Status == "cancelled" {
+		m.mu.Unlock()
+		return
+	}
+	j.UpdatedAt = time.Now()
+	if fail {
+		j.Status = "failed"
+		j.Error = "mock proof generation failure"
+		m.mu.Unlock()
+		return
+	}
+	j.Status = "done"
+	j.proof = proof
+	j.publicInputs = public
+	secret := m.callbackSecret
+	m.mu.Unlock()
+
+	if j.Callback == "" {
+		return
+	}
+	body, err := json.Marshal(prover.Callback{
+		ProcessID:    j.ProcessID,
+		Prover:       j.Prover,
+		ID:           j.ID,
+		Timestamp:    time.Now().Unix(),
+		Proof:        proof,
+		PublicInputs: public,
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, j.Callback, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(prover.CallbackSignatureHeader, prover.SignCallback(secret, body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+// getJob returns a copy of the job of the id param, writing the error
+// response if it does not exist
+func (m *MockProver) getJob(c *gin.Context) *mockJob {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64) //nolint:gomnd
+	if err != nil {
+		mockReturnErr(c, err)
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		c.JSON(http.StatusNotFound, mockErrorMsg{
+			Message: fmt.Sprintf("job not found, id: %d", id),
+		})
+		return nil
+	}
+	jCopy := *j
+	return &jCopy
+}
+
+// getDoneJob returns the job of the id param if its proof has been generated
+func (m *MockProver) getDoneJob(c *gin.Context) *mockJob {
+	j := m.getJob(c)
+	if j == nil {
+		return nil
+	}
+	switch j.Status {
+	case "done":
+		if j.Released {
+			mockReturnErr(c, fmt.Errorf("proof files removed, id: %d", j.ID))
+			return nil
+		}
+		return j
+	case "failed":
+		mockReturnErr(c, fmt.Errorf("proof generation failed, id: %d,"+
+			" error: %s", j.ID, j.Error))
+	default:
+		c.JSON(http.StatusConflict, mockErrorMsg{
+			Message: fmt.Sprintf("proof not ready, id: %d, status: %s",
+				j.ID, j.Status),
+		})
+	}
+	return nil
+}
+
+func (m *MockProver) getProofStatus(c *gin.Context) {
+	j := m.getJob(c)
+	if j == nil {
+		return
+	}
+	c.JSON(http.StatusOK, j)
+}
+
+func (m *MockProver) getProof(c *gin.Context) {
+	j := m.getDoneJob(c)
+	if j == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", j.proof)
+}
+
+func (m *MockProver) getPublicInputs(c *gin.Context) {
+	j := m.getDoneJob(c)
+	if j == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", j.publicInputs)
+}
+
+func (m *MockProver) deleteProof(c *gin.Context) {
+	jCopy := m.getJob(c)
+	if jCopy == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.jobs[jCopy.ID]
+	if j.Status == "done" || j.Status == "failed" {
+		j.Released = true
+		c.JSON(http.StatusOK, fmt.Sprintf("proof released, id: %d", j.ID))
+		return
+	}
+	if j.Status != "proving" {
+		mockReturnErr(c, fmt.Errorf("job can not be cancelled, id: %d,"+
+			" status: %s", j.ID, j.Status))
+		return
+	}
+	j.Status = "cancelled"
+	j.UpdatedAt = time.Now()
+	c.JSON(http.StatusOK, fmt.Sprintf("proof generation cancelled, id: %d", j.ID))
+}
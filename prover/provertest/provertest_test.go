@@ -0,0 +1,63 @@
+package provertest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/types"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMockProverCallback(t *testing.T) {
+	c := qt.New(t)
+
+	secret := []byte("secret")
+	callbacks := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	node := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			c.Check(err, qt.IsNil)
+			callbacks <- r
+			bodies <- body
+		}))
+	defer node.Close()
+
+	m := NewMockProver(c, 16, 4)
+	m.SetCallback(node.URL, secret)
+	client := prover.NewClient(m.URL())
+	client.EnableCallbacks()
+
+	zki := types.NewZKInputs(16, 4)
+	proofID, err := client.GenProof(123, zki)
+	c.Assert(err, qt.IsNil)
+
+	// the callback follows the prover-server contract
+	var req *http.Request
+	select {
+	case req = <-callbacks:
+	case <-time.After(5 * time.Second):
+		c.Fatal("callback not received")
+	}
+	body := <-bodies
+	c.Assert(req.URL.Path, qt.Equals, "/proof/123/callback")
+	c.Assert(prover.VerifyCallback(secret, body,
+		req.Header.Get(prover.CallbackSignatureHeader)), qt.IsTrue)
+	var cb prover.Callback
+	err = json.Unmarshal(body, &cb)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cb.ProcessID, qt.Equals, uint64(123))
+	c.Assert(cb.Prover, qt.Equals, client.ID())
+	c.Assert(cb.ID, qt.Equals, proofID)
+	c.Assert(cb.Expired(), qt.IsFalse)
+
+	// the proof is verified by the VerificationKey of the mock
+	vk, err := prover.ParseVerificationKey(m.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	c.Assert(vk.VerifyBytes(cb.Proof, cb.PublicInputs), qt.IsNil)
+}
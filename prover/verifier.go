@@ -0,0 +1,221 @@
+package prover
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/aragon/ovote-node/types"
+	bn256 "github.com/ethereum/go-ethereum/crypto/bn256/cloudflare"
+)
+
+// ErrInvalidProof is returned when a proof does not pass the Groth16
+// verification
+var ErrInvalidProof = errors.New("invalid proof")
+
+// VerificationKey is a Groth16 verification key over the BN254 curve
+type VerificationKey struct {
+	Alpha *bn256.G1
+	Beta  *bn256.G2
+	Gamma *bn256.G2
+	Delta *bn256.G2
+	IC    []*bn256.G1
+}
+
+type verificationKeyJSON struct {
+	Protocol string     `json:"protocol"`
+	NPublic  int        `json:"nPublic"`
+	Alpha    []string   `json:"vk_alpha_1"`
+	Beta     [][]string `json:"vk_beta_2"`
+	Gamma    [][]string `json:"vk_gamma_2"`
+	Delta    [][]string `json:"vk_delta_2"`
+	IC       [][]string `json:"IC"`
+}
+
+// LoadVerificationKey reads the verification key from the given file path
+func LoadVerificationKey(path string) (*VerificationKey, error) {
+	b, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	return ParseVerificationKey(b)
+}
+
+// ParseVerificationKey parses the given verification key in the snarkjs json
+// format
+func ParseVerificationKey(b []byte) (*VerificationKey, error) {
+	var vkJSON verificationKeyJSON
+	if err := json.Unmarshal(b, &vkJSON); err != nil {
+		return nil, fmt.Errorf("can not parse verification key: %w", err)
+	}
+	if vkJSON.Protocol != "groth16" {
+		return nil, fmt.Errorf("unexpected verification key protocol: %q",
+			vkJSON.Protocol)
+	}
+	if vkJSON.NPublic != len(vkJSON.IC)-1 {
+		return nil, fmt.Errorf("verification key nPublic (%d) does not"+
+			" match the IC length (%d)", vkJSON.NPublic, len(vkJSON.IC))
+	}
+
+	var vk VerificationKey
+	var err error
+	if vk.Alpha, err = g1FromStrings(vkJSON.Alpha); err != nil {
+		return nil, fmt.Errorf("vk_alpha_1: %w", err)
+	}
+	if vk.Beta, err = g2FromStrings(vkJSON.Beta); err != nil {
+		return nil, fmt.Errorf("vk_beta_2: %w", err)
+	}
+	if vk.Gamma, err = g2FromStrings(vkJSON.Gamma); err != nil {
+		return nil, fmt.Errorf("vk_gamma_2: %w", err)
+	}
+	if vk.Delta, err = g2FromStrings(vkJSON.Delta); err != nil {
+		return nil, fmt.Errorf("vk_delta_2: %w", err)
+	}
+	for i := 0; i < len(vkJSON.IC); i++ {
+		ic, err := g1FromStrings(vkJSON.IC[i])
+		if err != nil {
+			return nil, fmt.Errorf("IC[%d]: %w", i, err)
+		}
+		vk.IC = append(vk.IC, ic)
+	}
+	return &vk, nil
+}
+
+// Verify checks the given Groth16 proof for the given public inputs
+func (vk *VerificationKey) Verify(proof *types.Proof, publicInputs []*big.Int) error {
+	if len(publicInputs)+1 != len(vk.IC) {
+		return fmt.Errorf("%w: expected %d public inputs, got %d",
+			ErrInvalidProof, len(vk.IC)-1, len(publicInputs))
+	}
+	a, err := g1FromBigInts(proof.A[0], proof.A[1])
+	if err != nil {
+		return fmt.Errorf("%w: pi_a: %s", ErrInvalidProof, err)
+	}
+	b, err := g2FromBigInts(proof.B[0], proof.B[1])
+	if err != nil {
+		return fmt.Errorf("%w: pi_b: %s", ErrInvalidProof, err)
+	}
+	c, err := g1FromBigInts(proof.C[0], proof.C[1])
+	if err != nil {
+		return fmt.Errorf("%w: pi_c: %s", ErrInvalidProof, err)
+	}
+
+	// vkX = IC[0] + sum(publicInputs[i] * IC[i+1])
+	vkX := new(bn256.G1).Set(vk.IC[0])
+	for i := 0; i < len(publicInputs); i++ {
+		if publicInputs[i].Sign() < 0 || publicInputs[i].Cmp(bn256.Order) >= 0 {
+			return fmt.Errorf("%w: public input %d out of the field",
+				ErrInvalidProof, i)
+		}
+		vkX.Add(vkX, new(bn256.G1).ScalarMult(vk.IC[i+1], publicInputs[i]))
+	}
+
+	// e(-A, B) * e(alpha, beta) * e(vkX, gamma) * e(C, delta) == 1
+	ok := bn256.PairingCheck(
+		[]*bn256.G1{new(bn256.G1).Neg(a), vk.Alpha, vkX, c},
+		[]*bn256.G2{b, vk.Beta, vk.Gamma, vk.Delta})
+	if !ok {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyBytes parses the given proof & public inputs in the snarkjs json
+// format, and verifies them
+func (vk *VerificationKey) VerifyBytes(proofBytes, publicInputsBytes []byte) error {
+	proof, err := types.ParseProof(proofBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	publicInputs, err := types.ParsePublicInputs(publicInputsBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err)
+	}
+	return vk.Verify(proof, publicInputs)
+}
+
+func fillBytes(b []byte, n *big.Int) error {
+	if n.Sign() < 0 || n.BitLen() > len(b)*8 {
+		return fmt.Errorf("coordinate out of range")
+	}
+	n.FillBytes(b)
+	return nil
+}
+
+// g1FromBigInts returns the G1 point for the given affine coordinates
+func g1FromBigInts(x, y *big.Int) (*bn256.G1, error) {
+	b := make([]byte, 64) //nolint:gomnd
+	if err := fillBytes(b[:32], x); err != nil {
+		return nil, err
+	}
+	if err := fillBytes(b[32:], y); err != nil {
+		return nil, err
+	}
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// g2FromBigInts returns the G2 point for the given affine coordinates, each
+// one in the snarkjs order [real, imaginary]
+func g2FromBigInts(x, y [2]*big.Int) (*bn256.G2, error) {
+	// bn256 expects the imaginary part first
+	b := make([]byte, 128) //nolint:gomnd
+	coords := []*big.Int{x[1], x[0], y[1], y[0]}
+	for i := 0; i < len(coords); i++ {
+		if err := fillBytes(b[i*32:(i+1)*32], coords[i]); err != nil {
+			return nil, err
+		}
+	}
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	// as the cofactor of G2 is not 1, the points of the curve out of the
+	// r-torsion subgroup are rejected, the pairing check is only sound for
+	// the points of the subgroup
+	if !bytes.Equal(new(bn256.G2).ScalarMult(p, bn256.Order).Marshal(),
+		make([]byte, 128)) { //nolint:gomnd
+		return nil, fmt.Errorf("point not in the G2 subgroup")
+	}
+	return p, nil
+}
+
+func g1FromStrings(s []string) (*bn256.G1, error) {
+	if len(s) != 3 { //nolint:gomnd
+		return nil, fmt.Errorf("expected 3 coordinates, got %d", len(s))
+	}
+	x, err := types.StringToBigInt(s[0])
+	if err != nil {
+		return nil, err
+	}
+	y, err := types.StringToBigInt(s[1])
+	if err != nil {
+		return nil, err
+	}
+	return g1FromBigInts(x, y)
+}
+
+func g2FromStrings(s [][]string) (*bn256.G2, error) {
+	if len(s) != 3 { //nolint:gomnd
+		return nil, fmt.Errorf("expected 3 coordinates, got %d", len(s))
+	}
+	var coords [2][2]*big.Int
+	for i := 0; i < 2; i++ {
+		if len(s[i]) != 2 {
+			return nil, fmt.Errorf("expected 2 elements, got %d", len(s[i]))
+		}
+		for j := 0; j < 2; j++ {
+			var err error
+			if coords[i][j], err = types.StringToBigInt(s[i][j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g2FromBigInts(coords[0], coords[1])
+}
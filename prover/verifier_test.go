@@ -0,0 +1,172 @@
+package prover
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"testing"
+
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
+	bn256 "github.com/ethereum/go-ethereum/crypto/bn256/cloudflare"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestVerify(t *testing.T) {
+	c := qt.New(t)
+
+	publicInputs := []*big.Int{big.NewInt(3), big.NewInt(123),
+		big.NewInt(456), big.NewInt(789), big.NewInt(10), big.NewInt(6),
+		big.NewInt(1)}
+	g := test.GenGroth16(c, publicInputs)
+
+	vk, err := ParseVerificationKey(g.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(vk.IC), qt.Equals, len(publicInputs)+1)
+
+	err = vk.VerifyBytes(g.Proof, g.PublicInputs)
+	c.Assert(err, qt.IsNil)
+
+	proof, err := types.ParseProof(g.Proof)
+	c.Assert(err, qt.IsNil)
+	err = vk.Verify(proof, publicInputs)
+	c.Assert(err, qt.IsNil)
+
+	// modified public inputs
+	publicInputs[5] = big.NewInt(7)
+	err = vk.Verify(proof, publicInputs)
+	c.Assert(err, qt.Equals, ErrInvalidProof)
+
+	// wrong number of public inputs
+	err = vk.Verify(proof, publicInputs[:6])
+	c.Assert(errors.Is(err, ErrInvalidProof), qt.IsTrue)
+
+	// proof of another verification key
+	g2 := test.GenGroth16(c, publicInputs)
+	err = vk.VerifyBytes(g2.Proof, g2.PublicInputs)
+	c.Assert(err, qt.Equals, ErrInvalidProof)
+
+	// not a proof, eg. an html error page
+	err = vk.VerifyBytes([]byte("<html>404 page not found</html>"), g.PublicInputs)
+	c.Assert(errors.Is(err, ErrInvalidProof), qt.IsTrue)
+}
+
+// TestVerifyHandmadeFixture verifies a hand-written proof in the json format
+// of snarkjs, which has not been generated by snarkjs nor by any circuit. Its
+// G2 points are the BN254 generator, written with the coordinates published
+// for it (as in the vk_gamma_2 of snarkjs), so that the [real, imaginary]
+// order is checked independently of the encoding used by test.GenGroth16. The
+// G1 points are chosen so that the pairing equation holds.
+func TestVerifyHandmadeFixture(t *testing.T) {
+	c := qt.New(t)
+
+	vk, err := LoadVerificationKey("testdata/handmade_verification_key.json")
+	c.Assert(err, qt.IsNil)
+	generator := new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+	c.Assert(vk.Gamma.Marshal(), qt.DeepEquals, generator.Marshal())
+
+	proof, err := ioutil.ReadFile("testdata/handmade_proof.json")
+	c.Assert(err, qt.IsNil)
+	public, err := ioutil.ReadFile("testdata/handmade_public.json")
+	c.Assert(err, qt.IsNil)
+	err = vk.VerifyBytes(proof, public)
+	c.Assert(err, qt.IsNil)
+
+	err = vk.VerifyBytes(proof, []byte(`["3", "5"]`))
+	c.Assert(err, qt.Equals, ErrInvalidProof)
+
+	// the coordinates in the bn256 order are not a point of the curve
+	p, err := types.ParseProof(proof)
+	c.Assert(err, qt.IsNil)
+	p.B[0][0], p.B[0][1] = p.B[0][1], p.B[0][0]
+	p.B[1][0], p.B[1][1] = p.B[1][1], p.B[1][0]
+	err = vk.Verify(p, []*big.Int{big.NewInt(3), big.NewInt(4)})
+	c.Assert(errors.Is(err, ErrInvalidProof), qt.IsTrue)
+}
+
+// fp2Mul multiplies the given elements of Fp2, in the [real, imaginary] order
+func fp2Mul(a, b [2]*big.Int) [2]*big.Int {
+	p := bn256.P
+	r := new(big.Int).Sub(new(big.Int).Mul(a[0], b[0]), new(big.Int).Mul(a[1], b[1]))
+	i := new(big.Int).Add(new(big.Int).Mul(a[0], b[1]), new(big.Int).Mul(a[1], b[0]))
+	return [2]*big.Int{r.Mod(r, p), i.Mod(i, p)}
+}
+
+// fpSqrt returns the square root of v in Fp, or nil if v is not a square
+func fpSqrt(v *big.Int) *big.Int {
+	p := bn256.P
+	// p = 3 mod 4
+	e := new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2)
+	r := new(big.Int).Exp(v, e, p)
+	if new(big.Int).Exp(r, big.NewInt(2), p).Cmp(new(big.Int).Mod(v, p)) != 0 {
+		return nil
+	}
+	return r
+}
+
+// fp2Sqrt returns a square root of a in Fp2, or false if a is not a square
+func fp2Sqrt(a [2]*big.Int) ([2]*big.Int, bool) {
+	p := bn256.P
+	norm := new(big.Int).Add(new(big.Int).Mul(a[0], a[0]), new(big.Int).Mul(a[1], a[1]))
+	s := fpSqrt(norm.Mod(norm, p))
+	if s == nil {
+		return [2]*big.Int{}, false
+	}
+	inv2 := new(big.Int).ModInverse(big.NewInt(2), p)
+	for _, sign := range []*big.Int{s, new(big.Int).Neg(s)} {
+		t := new(big.Int).Add(a[0], sign)
+		t.Mul(t, inv2).Mod(t, p)
+		x0 := fpSqrt(t)
+		if x0 == nil || x0.Sign() == 0 {
+			continue
+		}
+		x1 := new(big.Int).ModInverse(new(big.Int).Lsh(x0, 1), p)
+		x1.Mul(x1, a[1]).Mod(x1, p)
+		x := [2]*big.Int{x0, x1}
+		sq := fp2Mul(x, x)
+		if sq[0].Cmp(a[0]) == 0 && sq[1].Cmp(a[1]) == 0 {
+			return x, true
+		}
+	}
+	return [2]*big.Int{}, false
+}
+
+func TestVerifyG2Subgroup(t *testing.T) {
+	c := qt.New(t)
+
+	// b of the twist curve y^2 = x^3 + 3/(9+i), in the [real, imaginary]
+	// order: 3/(9+i) = (27 - 3i)/82
+	p := bn256.P
+	inv82 := new(big.Int).ModInverse(big.NewInt(82), p)
+	twistB := [2]*big.Int{
+		new(big.Int).Mod(new(big.Int).Mul(big.NewInt(27), inv82), p),
+		new(big.Int).Mod(new(big.Int).Mul(big.NewInt(-3), inv82), p),
+	}
+
+	// find a point of the twist curve with a small x, which is not in the
+	// r-torsion subgroup
+	var x, y [2]*big.Int
+	found := false
+	for i := int64(1); i < 100 && !found; i++ {
+		x = [2]*big.Int{big.NewInt(i), big.NewInt(0)}
+		rhs := fp2Mul(fp2Mul(x, x), x)
+		rhs[0].Add(rhs[0], twistB[0]).Mod(rhs[0], p)
+		rhs[1].Add(rhs[1], twistB[1]).Mod(rhs[1], p)
+		y, found = fp2Sqrt(rhs)
+	}
+	c.Assert(found, qt.IsTrue)
+
+	_, err := g2FromBigInts(x, y)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// a proof with that point as pi_b is rejected before the pairing check
+	g := test.GenGroth16(c, []*big.Int{big.NewInt(1)})
+	vk, err := ParseVerificationKey(g.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	proof, err := types.ParseProof(g.Proof)
+	c.Assert(err, qt.IsNil)
+	proof.B[0], proof.B[1] = x, y
+	err = vk.Verify(proof, []*big.Int{big.NewInt(1)})
+	c.Assert(errors.Is(err, ErrInvalidProof), qt.IsTrue)
+	c.Assert(err, qt.ErrorMatches, "invalid proof: pi_b: .*")
+}
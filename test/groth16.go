@@ -0,0 +1,140 @@
+package test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+
+	bn256 "github.com/ethereum/go-ethereum/crypto/bn256/cloudflare"
+	qt "github.com/frankban/quicktest"
+)
+
+// Groth16 contains a verification key, proof & public inputs in the snarkjs
+// json format
+type Groth16 struct {
+	VerificationKey []byte
+	Proof           []byte
+	PublicInputs    []byte
+}
+
+func randScalar(c *qt.C) *big.Int {
+	k, err := rand.Int(rand.Reader, bn256.Order)
+	c.Assert(err, qt.IsNil)
+	return k
+}
+
+func g1Strings(p *bn256.G1) []string {
+	b := p.Marshal()
+	return []string{
+		new(big.Int).SetBytes(b[:32]).String(),
+		new(big.Int).SetBytes(b[32:]).String(),
+		"1",
+	}
+}
+
+func g2Strings(p *bn256.G2) [][]string {
+	// bn256 marshals the imaginary part first, snarkjs uses the real part
+	// first
+	b := p.Marshal()
+	return [][]string{
+		{new(big.Int).SetBytes(b[32:64]).String(), new(big.Int).SetBytes(b[:32]).String()},
+		{new(big.Int).SetBytes(b[96:]).String(), new(big.Int).SetBytes(b[64:96]).String()},
+		{"1", "0"},
+	}
+}
+
+// Trapdoor contains the toxic waste of a Groth16 setup, which allows to
+// compute valid proofs directly from the verification equation, without any
+// circuit
+type Trapdoor struct {
+	alpha, beta, gamma, delta *big.Int
+	ic                        []*big.Int
+}
+
+// NewTrapdoor returns a Trapdoor for the given number of public inputs, with
+// the scalars obtained from the given scalar function
+func NewTrapdoor(nPublic int, scalar func() *big.Int) *Trapdoor {
+	t := &Trapdoor{
+		alpha: scalar(),
+		beta:  scalar(),
+		gamma: scalar(),
+		delta: scalar(),
+		ic:    make([]*big.Int, nPublic+1),
+	}
+	for i := 0; i < len(t.ic); i++ {
+		t.ic[i] = scalar()
+	}
+	return t
+}
+
+// VerificationKey returns the verification key in the snarkjs json format
+func (t *Trapdoor) VerificationKey() ([]byte, error) {
+	icStrings := make([][]string, len(t.ic))
+	for i := 0; i < len(t.ic); i++ {
+		icStrings[i] = g1Strings(new(bn256.G1).ScalarBaseMult(t.ic[i]))
+	}
+	return json.Marshal(map[string]interface{}{
+		"protocol":   "groth16",
+		"curve":      "bn128",
+		"nPublic":    len(t.ic) - 1,
+		"vk_alpha_1": g1Strings(new(bn256.G1).ScalarBaseMult(t.alpha)),
+		"vk_beta_2":  g2Strings(new(bn256.G2).ScalarBaseMult(t.beta)),
+		"vk_gamma_2": g2Strings(new(bn256.G2).ScalarBaseMult(t.gamma)),
+		"vk_delta_2": g2Strings(new(bn256.G2).ScalarBaseMult(t.delta)),
+		"IC":         icStrings,
+	})
+}
+
+// Prove returns the proof & public inputs in the snarkjs json format for the
+// given public inputs, using the given a & b scalars
+func (t *Trapdoor) Prove(publicInputs []*big.Int, a, b *big.Int) ([]byte, []byte, error) {
+	r := bn256.Order
+	// vkX = ic[0] + sum(publicInputs[i] * ic[i+1])
+	vkX := new(big.Int).Set(t.ic[0])
+	for i := 0; i < len(publicInputs); i++ {
+		vkX.Add(vkX, new(big.Int).Mul(publicInputs[i], t.ic[i+1]))
+	}
+	// a*b = alpha*beta + vkX*gamma + c*delta
+	cScalar := new(big.Int).Mul(a, b)
+	cScalar.Sub(cScalar, new(big.Int).Mul(t.alpha, t.beta))
+	cScalar.Sub(cScalar, new(big.Int).Mul(vkX, t.gamma))
+	cScalar.Mul(cScalar, new(big.Int).ModInverse(t.delta, r))
+	cScalar.Mod(cScalar, r)
+
+	proof, err := json.Marshal(map[string]interface{}{
+		"pi_a":     g1Strings(new(bn256.G1).ScalarBaseMult(a)),
+		"pi_b":     g2Strings(new(bn256.G2).ScalarBaseMult(b)),
+		"pi_c":     g1Strings(new(bn256.G1).ScalarBaseMult(cScalar)),
+		"protocol": "groth16",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicStrings := make([]string, len(publicInputs))
+	for i := 0; i < len(publicInputs); i++ {
+		publicStrings[i] = publicInputs[i].String()
+	}
+	public, err := json.Marshal(publicStrings)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, public, nil
+}
+
+// GenGroth16 generates a random verification key together with a valid proof
+// for the given public inputs. As the toxic waste is known, the proof is
+// computed directly from the verification equation, without any circuit.
+func GenGroth16(c *qt.C, publicInputs []*big.Int) Groth16 {
+	t := NewTrapdoor(len(publicInputs), func() *big.Int { return randScalar(c) })
+	vk, err := t.VerificationKey()
+	c.Assert(err, qt.IsNil)
+	proof, public, err := t.Prove(publicInputs, randScalar(c), randScalar(c))
+	c.Assert(err, qt.IsNil)
+
+	return Groth16{
+		VerificationKey: vk,
+		Proof:           proof,
+		PublicInputs:    public,
+	}
+}
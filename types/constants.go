@@ -20,3 +20,18 @@ var (
 	// function output length used in the Census MerkleTree
 	EmptyRoot = make([]byte, arbo.HashFunctionPoseidon.Len())
 )
+
+// MaxNLeafsForLevels returns the maximum number of leaves that fit in a Census
+// MerkleTree of the given number of levels
+func MaxNLeafsForLevels(nLevels int) uint64 {
+	if nLevels >= MaxLevels {
+		return MaxNLeafs
+	}
+	return uint64(1) << uint(nLevels)
+}
+
+// IndexLen returns the length of the leaf index (key) for a MerkleTree of the
+// given number of levels
+func IndexLen(nLevels int) int {
+	return int(math.Ceil(float64(nLevels) / float64(8))) //nolint:gomnd
+}
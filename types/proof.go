@@ -1,8 +1,14 @@
 package types
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // ProofInDB contains the proof data from an entry in the db
@@ -13,6 +19,11 @@ type ProofInDB struct {
 	InsertedDatetime   time.Time
 	ProofAddedDatetime time.Time
 	ProcessID          uint64
+	// Error contains the reason why the proof was rejected, empty if the
+	// proof is valid or not yet retrieved
+	Error string
+	// Prover is the url of the prover-server that generates the proof
+	Prover string
 }
 
 // Proof represents a Groth16 zkSNARK proof
@@ -22,3 +33,178 @@ type Proof struct {
 	C        [3]*big.Int    `json:"pi_c"`
 	Protocol string         `json:"protocol"`
 }
+
+type proofJSON struct {
+	A        []string   `json:"pi_a"`
+	B        [][]string `json:"pi_b"`
+	C        []string   `json:"pi_c"`
+	Protocol string     `json:"protocol"`
+}
+
+// StringToBigInt parses the given decimal string into a *big.Int
+func StringToBigInt(s string) (*big.Int, error) {
+	b, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("can not parse %q as a decimal number", s)
+	}
+	return b, nil
+}
+
+func stringsToBigInts(s []string, n int) ([]*big.Int, error) {
+	if len(s) != n {
+		return nil, fmt.Errorf("expected %d elements, got %d", n, len(s))
+	}
+	b := make([]*big.Int, n)
+	for i := 0; i < n; i++ {
+		var err error
+		if b[i], err = StringToBigInt(s[i]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// ParseProof parses the given Groth16 proof in the snarkjs json format
+func ParseProof(b []byte) (*Proof, error) {
+	var pJSON proofJSON
+	if err := json.Unmarshal(b, &pJSON); err != nil {
+		return nil, fmt.Errorf("can not parse proof: %w", err)
+	}
+	if pJSON.Protocol != "groth16" {
+		return nil, fmt.Errorf("unexpected proof protocol: %q", pJSON.Protocol)
+	}
+
+	var p Proof
+	p.Protocol = pJSON.Protocol
+	a, err := stringsToBigInts(pJSON.A, 3) //nolint:gomnd
+	if err != nil {
+		return nil, fmt.Errorf("can not parse proof pi_a: %w", err)
+	}
+	copy(p.A[:], a)
+	c, err := stringsToBigInts(pJSON.C, 3) //nolint:gomnd
+	if err != nil {
+		return nil, fmt.Errorf("can not parse proof pi_c: %w", err)
+	}
+	copy(p.C[:], c)
+	if len(pJSON.B) != 3 { //nolint:gomnd
+		return nil, fmt.Errorf("can not parse proof pi_b: expected 3"+
+			" elements, got %d", len(pJSON.B))
+	}
+	for i := 0; i < 3; i++ {
+		bi, err := stringsToBigInts(pJSON.B[i], 2)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse proof pi_b: %w", err)
+		}
+		copy(p.B[i][:], bi)
+	}
+	return &p, nil
+}
+
+// MarshalJSON implements the json marshaler for Proof, in the snarkjs json
+// format
+func (p Proof) MarshalJSON() ([]byte, error) {
+	pJSON := proofJSON{
+		A:        bigIntsToDecimals(p.A[:]),
+		C:        bigIntsToDecimals(p.C[:]),
+		Protocol: p.Protocol,
+	}
+	for i := 0; i < len(p.B); i++ {
+		pJSON.B = append(pJSON.B, bigIntsToDecimals(p.B[i][:]))
+	}
+	return json.Marshal(pJSON)
+}
+
+// UnmarshalJSON implements the json unmarshaler for Proof, in the snarkjs json
+// format
+func (p *Proof) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseProof(b)
+	if err != nil {
+		return err
+	}
+	*p = *parsed
+	return nil
+}
+
+func bigIntsToDecimals(b []*big.Int) []string {
+	s := make([]string, len(b))
+	for i := 0; i < len(b); i++ {
+		s[i] = b[i].String()
+	}
+	return s
+}
+
+// PublishResultMethod is the signature of the method of the OVOTE contract
+// that publishes the result of a process, verifying its proof. The contract
+// ABI is not part of this repository, so the signature is not verified
+// against it: it must be kept in sync by hand with the deployed contract.
+const PublishResultMethod = "publishResult(uint256,uint256,uint64,uint64," +
+	"uint256[2],uint256[2][2],uint256[2])"
+
+// ResultCalldata contains the arguments of the PublishResultMethod, with the
+// proof points as hex strings
+type ResultCalldata struct {
+	ProcessID    uint64       `json:"processID"`
+	ReceiptsRoot string       `json:"receiptsRoot"`
+	Result       uint64       `json:"result"`
+	NVotes       uint64       `json:"nVotes"`
+	A            [2]string    `json:"a"`
+	B            [2][2]string `json:"b"`
+	C            [2]string    `json:"c"`
+	// Calldata is the ABI encoded call to the PublishResultMethod, ready to
+	// be sent to the OVOTE contract
+	Calldata string `json:"calldata"`
+}
+
+// ResultCalldata returns the calldata of the OVOTE contract call that
+// publishes the result proven by the Proof. The processID, receiptsRoot,
+// result & nVotes are taken from the given public inputs, in the order of
+// ZKInputs.PublicInputs. The coordinates of the G2 point (pi_b) are swapped,
+// as the Solidity verifier expects them.
+func (p *Proof) ResultCalldata(publicInputs []*big.Int) (*ResultCalldata, error) {
+	if len(publicInputs) != len((&ZKInputs{}).PublicInputs()) {
+		return nil, fmt.Errorf("expected %d public inputs, got %d",
+			len((&ZKInputs{}).PublicInputs()), len(publicInputs))
+	}
+	processID, receiptsRoot := publicInputs[1], publicInputs[3]
+	nVotes, result := publicInputs[4], publicInputs[5]
+	if !processID.IsUint64() || !result.IsUint64() || !nVotes.IsUint64() {
+		return nil, fmt.Errorf("processID, result or nVotes does not fit in uint64")
+	}
+
+	// the verifier expects the G2 coordinates as (c1, c0)
+	words := []*big.Int{processID, receiptsRoot, result, nVotes,
+		p.A[0], p.A[1],
+		p.B[0][1], p.B[0][0], p.B[1][1], p.B[1][0],
+		p.C[0], p.C[1]}
+	hexWords := make([]string, len(words))
+	for i := 0; i < len(words); i++ {
+		hexWords[i] = fmt.Sprintf("0x%064x", words[i])
+	}
+	cd := &ResultCalldata{
+		ProcessID:    processID.Uint64(),
+		ReceiptsRoot: hexWords[1],
+		Result:       result.Uint64(),
+		NVotes:       nVotes.Uint64(),
+		A:            [2]string{hexWords[4], hexWords[5]},
+		B:            [2][2]string{{hexWords[6], hexWords[7]}, {hexWords[8], hexWords[9]}},
+		C:            [2]string{hexWords[10], hexWords[11]},
+	}
+
+	// all the arguments are static, so they are encoded in place
+	calldata := crypto.Keccak256([]byte(PublishResultMethod))[:4]
+	for i := 0; i < len(words); i++ {
+		calldata = append(calldata, common.LeftPadBytes(words[i].Bytes(), 32)...) //nolint:gomnd
+	}
+	cd.Calldata = hexutil.Encode(calldata)
+	return cd, nil
+}
+
+// ParsePublicInputs parses the given public inputs, in the snarkjs json
+// format (array of decimal strings)
+func ParsePublicInputs(b []byte) ([]*big.Int, error) {
+	var s []string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("can not parse public inputs: %w", err)
+	}
+	return stringsToBigInts(s, len(s))
+}
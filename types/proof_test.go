@@ -0,0 +1,68 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var testProofJSON = `{"pi_a":["1","2","1"],"pi_b":[["3","4"],["5","6"],["1","0"]],` +
+	`"pi_c":["7","8","1"],"protocol":"groth16"}`
+
+func TestProofJSON(t *testing.T) {
+	c := qt.New(t)
+
+	var p Proof
+	err := json.Unmarshal([]byte(testProofJSON), &p)
+	c.Assert(err, qt.IsNil)
+	c.Assert(p.B[1][0].Int64(), qt.Equals, int64(5))
+
+	b, err := json.Marshal(p)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(b), qt.Equals, testProofJSON)
+
+	err = json.Unmarshal([]byte(`{"pi_a":["1"],"protocol":"groth16"}`), &p)
+	c.Assert(err, qt.ErrorMatches, "can not parse proof pi_a: expected 3 elements, got 1")
+}
+
+func TestProofResultCalldata(t *testing.T) {
+	c := qt.New(t)
+
+	p, err := ParseProof([]byte(testProofJSON))
+	c.Assert(err, qt.IsNil)
+	// chainID, processID, censusRoot, receiptsRoot, nVotes, result,
+	// withReceipts
+	publicInputs := []*big.Int{big.NewInt(3), big.NewInt(123), big.NewInt(11),
+		big.NewInt(12), big.NewInt(20), big.NewInt(15), big.NewInt(1)}
+	cd, err := p.ResultCalldata(publicInputs)
+	c.Assert(err, qt.IsNil)
+
+	word := func(v int) string {
+		return fmt.Sprintf("0x%064x", v)
+	}
+	c.Assert(cd.ProcessID, qt.Equals, uint64(123))
+	c.Assert(cd.ReceiptsRoot, qt.Equals, word(12))
+	c.Assert(cd.Result, qt.Equals, uint64(15))
+	c.Assert(cd.NVotes, qt.Equals, uint64(20))
+	c.Assert(cd.A, qt.DeepEquals, [2]string{word(1), word(2)})
+	// the G2 coordinates are swapped
+	c.Assert(cd.B, qt.DeepEquals, [2][2]string{{word(4), word(3)}, {word(6), word(5)}})
+	c.Assert(cd.C, qt.DeepEquals, [2]string{word(7), word(8)})
+
+	// keccak256("publishResult(uint256,uint256,uint64,uint64,uint256[2],
+	// uint256[2][2],uint256[2])")
+	encoded := "0x1d597efa"
+	for _, v := range []int{123, 12, 15, 20, 1, 2, 4, 3, 6, 5, 7, 8} {
+		encoded += word(v)[2:]
+	}
+	c.Assert(cd.Calldata, qt.Equals, encoded)
+
+	_, err = p.ResultCalldata(publicInputs[:2])
+	c.Assert(err, qt.ErrorMatches, "expected 7 public inputs, got 2")
+	publicInputs[5] = new(big.Int).Lsh(big.NewInt(1), 64)
+	_, err = p.ResultCalldata(publicInputs)
+	c.Assert(err, qt.ErrorMatches, ".*does not fit in uint64")
+}
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/vocdoni/arbo"
+)
+
+// ProcessResult contains the result of a Process published in the
+// SmartContract
+type ProcessResult struct {
+	ProcessID uint64 `json:"processID"`
+	// ReceiptsRoot is the root of the receipts tree, which contains a
+	// leaf for each one of the votes counted in the Result
+	ReceiptsRoot ByteArray `json:"receiptsRoot"`
+	Result       uint64    `json:"result"`
+	NVotes       uint64    `json:"nVotes"`
+	// EthBlockNum indicates at which Ethereum block number the result has
+	// been published
+	EthBlockNum      uint64    `json:"ethBlockNum"`
+	InsertedDatetime time.Time `json:"insertedDatetime"`
+}
+
+// ReceiptProof contains the proof of inclusion of the receipt of a vote in the
+// receipts tree, which allows the voter to check that its vote was counted
+type ReceiptProof struct {
+	Index        uint64             `json:"index"`
+	PublicKey    *babyjub.PublicKey `json:"publicKey"`
+	Weight       *big.Int           `json:"weight"`
+	ReceiptsRoot ByteArray          `json:"receiptsRoot"`
+	MerkleProof  ByteArray          `json:"merkleProof"`
+}
+
+// ReceiptKey returns the key of the receipt of the given census index in the
+// receipts tree of the given number of levels
+func ReceiptKey(index uint64, nLevels int) []byte {
+	return Uint64ToIndex(index)[:IndexLen(nLevels)]
+}
+
+// Verify checks the ReceiptProof against the given receiptsRoot, which should
+// be the ReceiptsRoot published in the SmartContract
+func (rp *ReceiptProof) Verify(receiptsRoot []byte) error {
+	if rp.PublicKey == nil {
+		return fmt.Errorf("receipt without PublicKey")
+	}
+	receiptValue, err := HashPubKBytes(rp.PublicKey, rp.Weight)
+	if err != nil {
+		return err
+	}
+	v, err := arbo.CheckProof(arbo.HashFunctionPoseidon,
+		Uint64ToIndex(rp.Index), receiptValue, receiptsRoot, rp.MerkleProof)
+	if err != nil {
+		return err
+	}
+	if !v {
+		return fmt.Errorf("receipt verification failed")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -32,6 +33,33 @@ var (
 	// ProcessStatusProofGenerated indicates that the process is finished,
 	// and the zkProof is already generated
 	ProcessStatusProofGenerated ProcessStatus = 3
+	// ProcessStatusQuorumNotReached indicates that the process is finished
+	// without reaching the MinParticipation or the MinPositiveVotes
+	// thresholds, so the zkProof is not generated
+	ProcessStatusQuorumNotReached ProcessStatus = 4
+	// ProcessStatusProofFailed indicates that the zkProof generation of
+	// the process has failed after the maximum number of attempts
+	ProcessStatusProofFailed ProcessStatus = 5
+	// ProcessStatusClosed indicates that the process has been closed in the
+	// SmartContract before its zkProof was generated, so the pending proof
+	// generations are cancelled
+	ProcessStatusClosed ProcessStatus = 6
+)
+
+var (
+	// ErrInvalidSignature is returned when the signature of a vote does not
+	// match its PublicKey
+	ErrInvalidSignature = errors.New("signature verification failed")
+	// ErrInvalidVoteStatusSignature is returned when the signature of a vote
+	// status request does not match the PublicKey of the vote
+	ErrInvalidVoteStatusSignature = errors.New("vote status request signature" +
+		" verification failed")
+	// ErrMalformedSignature is returned when a request signature can not be
+	// decompressed
+	ErrMalformedSignature = errors.New("malformed signature")
+	// ErrInvalidMerkleProof is returned when the census MerkleProof of a
+	// vote does not match the CensusRoot
+	ErrInvalidMerkleProof = errors.New("merkleproof verification failed")
 )
 
 // ByteArray is a type alias over []byte to implement custom json marshalers in
@@ -113,6 +141,53 @@ type Process struct {
 	Status ProcessStatus
 }
 
+// MinParticipationReached returns true if the given number of votes reaches
+// the MinParticipation threshold of the Process (% over CensusSize)
+func (p *Process) MinParticipationReached(nVotes uint64) bool {
+	return nVotes*100 >= p.CensusSize*uint64(p.MinParticipation)
+}
+
+// MinPositiveVotesReached returns true if the given result reaches the
+// MinPositiveVotes threshold of the Process (% over nVotes). The result is the
+// weighted sum of the votes while nVotes is not weighted, as these are the
+// only values of the tally published to the SmartContract (see
+// PublishResultMethod), so the threshold is evaluated over them and not over
+// the total weight of the votes.
+func (p *Process) MinPositiveVotesReached(nVotes uint64, result *big.Int) bool {
+	r := new(big.Int).Mul(result, big.NewInt(100)) //nolint:gomnd
+	t := new(big.Int).Mul(new(big.Int).SetUint64(nVotes),
+		big.NewInt(int64(p.MinPositiveVotes)))
+	return r.Cmp(t) >= 0
+}
+
+// QuorumReached returns true if the given number of votes and result reach
+// both the MinParticipation and the MinPositiveVotes thresholds of the Process
+func (p *Process) QuorumReached(nVotes uint64, result *big.Int) bool {
+	return p.MinParticipationReached(nVotes) &&
+		p.MinPositiveVotesReached(nVotes, result)
+}
+
+// ProcessInfo contains the Process together with the current count of the
+// votes stored for it
+type ProcessInfo struct {
+	Process
+	// NVotes is the number of votes stored for the Process
+	NVotes uint64
+	// Weight is the sum of the weights of the stored votes
+	Weight *big.Int
+	// Participation is the percentage of NVotes over the CensusSize
+	Participation float64
+	// MinParticipationReached indicates if NVotes reaches the
+	// MinParticipation threshold
+	MinParticipationReached bool
+	// Result is the sum of the weighted vote values. It is nil when the
+	// tally is hidden until the process is frozen
+	Result *big.Int `json:",omitempty"`
+	// MinPositiveVotesReached indicates if the Result reaches the
+	// MinPositiveVotes threshold. It is nil when the tally is hidden
+	MinPositiveVotesReached *bool `json:",omitempty"`
+}
+
 // HashVote computes the vote hash following the circuit approach
 func HashVote(chainID, processID uint64, vote []byte) (*big.Int, error) {
 	voteBI := arbo.BytesToBigInt(vote)
@@ -127,6 +202,90 @@ func HashVote(chainID, processID uint64, vote []byte) (*big.Int, error) {
 	return signedMsg, nil
 }
 
+// VoteStatus contains the status of the vote of a PublicKey in a Process. The
+// vote value is not included, only its hash, which the voter can compare with
+// the hash of the vote that it sent.
+type VoteStatus struct {
+	// Stored indicates if the vote is stored in the VotesAggregator
+	Stored bool `json:"stored"`
+	// InsertedDatetime contains the datetime of when the vote was stored
+	InsertedDatetime *time.Time `json:"insertedDatetime,omitempty"`
+	// VoteHash contains the hash of the vote computed with HashVote
+	VoteHash *big.Int `json:"voteHash,omitempty"`
+	// VotePackageHash contains the hash of the stored VotePackage, computed
+	// with VotePackage.Hash
+	VotePackageHash ByteArray `json:"votePackageHash,omitempty"`
+}
+
+// VoteErrorCode identifies the reason why a vote was rejected
+type VoteErrorCode string
+
+const (
+	// VoteErrInvalidPackage indicates that the VotePackage is malformed
+	VoteErrInvalidPackage VoteErrorCode = "invalidPackage"
+	// VoteErrMerkleProofTooDeep indicates that the MerkleProof of the vote
+	// does not fit in the circuit
+	VoteErrMerkleProofTooDeep VoteErrorCode = "merkleProofTooDeep"
+	// VoteErrInvalidSignature indicates that the signature of the vote does
+	// not match its PublicKey
+	VoteErrInvalidSignature VoteErrorCode = "invalidSignature"
+	// VoteErrInvalidMerkleProof indicates that the MerkleProof of the vote
+	// does not match the CensusRoot of the process
+	VoteErrInvalidMerkleProof VoteErrorCode = "invalidMerkleProof"
+	// VoteErrAlreadyStored indicates that a different vote of the same
+	// PublicKey or census index is already stored
+	VoteErrAlreadyStored VoteErrorCode = "alreadyStored"
+	// VoteErrStorage indicates that the vote could not be stored
+	VoteErrStorage VoteErrorCode = "storageError"
+)
+
+// VoteResult contains the result of adding a vote of a batch
+type VoteResult struct {
+	// VotePackageHash contains the hash of the VotePackage, computed with
+	// VotePackage.Hash
+	VotePackageHash ByteArray `json:"votePackageHash,omitempty"`
+	// Stored indicates if the vote is stored, by this or by a previous
+	// submission
+	Stored bool `json:"stored"`
+	// Code & Error contain the reason why the vote was rejected
+	Code  VoteErrorCode `json:"code,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// HashVoteStatusRequest computes the message that the voter signs to request
+// the status of its vote in the given process, at the given unix timestamp, so
+// that the signature expires. It uses a different number of inputs than
+// HashVote, so the signature can not be reused as a vote.
+func HashVoteStatusRequest(chainID, processID uint64, pubK *babyjub.PublicKey,
+	timestamp uint64) (*big.Int, error) {
+	return poseidon.Hash([]*big.Int{
+		big.NewInt(int64(chainID)),
+		big.NewInt(int64(processID)),
+		pubK.X,
+		pubK.Y,
+		new(big.Int).SetUint64(timestamp),
+	})
+}
+
+// VerifyVoteStatusRequest checks the signature of the request of the status of
+// the vote of the given PublicKey in the given process, at the given unix
+// timestamp. The freshness of the timestamp is checked by the caller.
+func VerifyVoteStatusRequest(chainID, processID uint64, pubK *babyjub.PublicKey,
+	timestamp uint64, sig babyjub.SignatureComp) error {
+	msg, err := HashVoteStatusRequest(chainID, processID, pubK, timestamp)
+	if err != nil {
+		return err
+	}
+	sigUncompressed, err := sig.Decompress()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedSignature, err)
+	}
+	if !pubK.VerifyPoseidon(msg, sigUncompressed) {
+		return ErrInvalidVoteStatusSignature
+	}
+	return nil
+}
+
 func (vp *VotePackage) verifySignature(chainID, processID uint64) error {
 	msgToSign, err := HashVote(chainID, processID, vp.Vote)
 	if err != nil {
@@ -135,15 +294,16 @@ func (vp *VotePackage) verifySignature(chainID, processID uint64) error {
 
 	sigUncompressed, err := vp.Signature.Decompress()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
 	}
 	v := vp.CensusProof.PublicKey.VerifyPoseidon(
 		msgToSign, sigUncompressed)
 	if !v {
-		return fmt.Errorf("signature verification failed")
+		return ErrInvalidSignature
 	}
 	return nil
 }
+
 func (vp *VotePackage) verifyMerkleProof(root []byte) error {
 	indexBytes := Uint64ToIndex(vp.CensusProof.Index)
 	pubKHashBytes, err := HashPubKBytes(vp.CensusProof.PublicKey,
@@ -154,10 +314,10 @@ func (vp *VotePackage) verifyMerkleProof(root []byte) error {
 	v, err := arbo.CheckProof(arbo.HashFunctionPoseidon, indexBytes,
 		pubKHashBytes, root, vp.CensusProof.MerkleProof)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %s", ErrInvalidMerkleProof, err)
 	}
 	if !v {
-		return fmt.Errorf("merkleproof verification failed")
+		return ErrInvalidMerkleProof
 	}
 	return nil
 }
@@ -203,3 +203,22 @@ func TestIndexAndWeightParser(t *testing.T) {
 	c.Assert(i2, qt.Equals, index)
 	c.Assert(weight.String(), qt.Equals, w2.String())
 }
+
+func TestProcessThresholds(t *testing.T) {
+	c := qt.New(t)
+
+	process := Process{CensusSize: 10, MinParticipation: 20, MinPositiveVotes: 60}
+
+	c.Assert(process.MinParticipationReached(1), qt.IsFalse)
+	c.Assert(process.MinParticipationReached(2), qt.IsTrue)
+	c.Assert(process.MinPositiveVotesReached(5, big.NewInt(2)), qt.IsFalse)
+	c.Assert(process.MinPositiveVotesReached(5, big.NewInt(3)), qt.IsTrue)
+	// the weighted result does not need to fit in an uint64
+	bigResult, ok := new(big.Int).SetString("100000000000000000000", 10)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(process.MinPositiveVotesReached(5, bigResult), qt.IsTrue)
+
+	c.Assert(process.QuorumReached(1, big.NewInt(1)), qt.IsFalse)
+	c.Assert(process.QuorumReached(5, big.NewInt(2)), qt.IsFalse)
+	c.Assert(process.QuorumReached(5, big.NewInt(3)), qt.IsTrue)
+}
@@ -0,0 +1,142 @@
+package types
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/ugorji/go/codec"
+)
+
+// VotePackageCBORContentType is the content type of the VotePackages encoded
+// in CBOR
+const VotePackageCBORContentType = "application/cbor"
+
+// cborHandle encodes the maps with sorted keys and the integers with their
+// smallest representation, as required by the canonical serialization
+var cborHandle = &codec.CborHandle{BasicHandle: codec.BasicHandle{
+	EncodeOptions: codec.EncodeOptions{Canonical: true},
+}}
+
+// votePackageCBOR is the CBOR representation of a VotePackage, encoded as an
+// array of 6 items: [signature, index, publicKey, weight, merkleProof, vote].
+// The signature and the publicKey are in their compressed form (64 and 32
+// bytes), and the weight in big-endian bytes, or null if it is not defined.
+type votePackageCBOR struct {
+	_struct     struct{} `codec:",toarray"` //nolint:unused,structcheck
+	Signature   []byte
+	Index       uint64
+	PublicKey   []byte
+	Weight      []byte
+	MerkleProof []byte
+	Vote        []byte
+}
+
+// MarshalCBOR returns the canonical CBOR serialization of the VotePackage
+func (vp *VotePackage) MarshalCBOR() ([]byte, error) {
+	if vp.CensusProof.PublicKey == nil {
+		return nil, fmt.Errorf("VotePackage without PublicKey")
+	}
+	pubKComp := vp.CensusProof.PublicKey.Compress()
+	v := votePackageCBOR{
+		Signature:   vp.Signature[:],
+		Index:       vp.CensusProof.Index,
+		PublicKey:   pubKComp[:],
+		MerkleProof: nonNil(vp.CensusProof.MerkleProof),
+		Vote:        nonNil(vp.Vote),
+	}
+	if vp.CensusProof.Weight != nil {
+		if vp.CensusProof.Weight.Sign() < 0 {
+			return nil, fmt.Errorf("VotePackage with negative weight")
+		}
+		v.Weight = vp.CensusProof.Weight.Bytes()
+	}
+
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, cborHandle).Encode(v); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UnmarshalCBOR decodes the given CBOR serialization of a VotePackage. Only
+// the canonical serialization is accepted, so each VotePackage has a unique
+// encoding.
+func (vp *VotePackage) UnmarshalCBOR(b []byte) error {
+	var v votePackageCBOR
+	if err := codec.NewDecoderBytes(b, cborHandle).Decode(&v); err != nil {
+		return fmt.Errorf("can not decode VotePackage: %w", err)
+	}
+	if len(v.Signature) != len(babyjub.SignatureComp{}) {
+		return fmt.Errorf("invalid signature length: %d", len(v.Signature))
+	}
+	var pubKComp babyjub.PublicKeyComp
+	if len(v.PublicKey) != len(pubKComp) {
+		return fmt.Errorf("invalid publicKey length: %d", len(v.PublicKey))
+	}
+	copy(pubKComp[:], v.PublicKey)
+	pubK, err := pubKComp.Decompress()
+	if err != nil {
+		return fmt.Errorf("invalid publicKey: %w", err)
+	}
+
+	var decoded VotePackage
+	copy(decoded.Signature[:], v.Signature)
+	decoded.CensusProof = CensusProof{
+		Index:       v.Index,
+		PublicKey:   pubK,
+		MerkleProof: v.MerkleProof,
+	}
+	if v.Weight != nil {
+		decoded.CensusProof.Weight = new(big.Int).SetBytes(v.Weight)
+	}
+	decoded.Vote = v.Vote
+
+	canonical, err := decoded.MarshalCBOR()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(canonical, b) {
+		return fmt.Errorf("VotePackage is not in canonical CBOR encoding")
+	}
+	*vp = decoded
+	return nil
+}
+
+// UnmarshalVotePackagesCBOR decodes the given CBOR array of VotePackages, each
+// one in its canonical serialization
+func UnmarshalVotePackagesCBOR(b []byte) ([]VotePackage, error) {
+	var items []codec.Raw
+	if err := codec.NewDecoderBytes(b, cborHandle).Decode(&items); err != nil {
+		return nil, fmt.Errorf("can not decode VotePackages: %w", err)
+	}
+	votes := make([]VotePackage, len(items))
+	for i := 0; i < len(items); i++ {
+		if err := votes[i].UnmarshalCBOR(items[i]); err != nil {
+			return nil, fmt.Errorf("VotePackage %d: %w", i, err)
+		}
+	}
+	return votes, nil
+}
+
+// Hash returns the keccak256 hash of the canonical CBOR serialization of the
+// VotePackage, which identifies it independently of the encoding used to
+// send it
+func (vp *VotePackage) Hash() ([]byte, error) {
+	b, err := vp.MarshalCBOR()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(b), nil
+}
+
+// nonNil returns an empty byte array instead of nil, so that the empty and the
+// undefined values have the same encoding
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
@@ -0,0 +1,145 @@
+package types
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/vocdoni/arbo"
+)
+
+func testVotePackage() VotePackage {
+	// deterministic key
+	var sk babyjub.PrivateKey
+	vote := []byte{1}
+	sig := sk.SignPoseidon(arbo.BytesToBigInt(vote))
+	return VotePackage{
+		Signature: sig.Compress(),
+		CensusProof: CensusProof{
+			Index:       1,
+			PublicKey:   sk.Public(),
+			Weight:      big.NewInt(300),
+			MerkleProof: []byte{4, 0, 0, 0},
+		},
+		Vote: vote,
+	}
+}
+
+func TestVotePackageCBOR(t *testing.T) {
+	c := qt.New(t)
+
+	vp := testVotePackage()
+	b, err := vp.MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hex.EncodeToString(b), qt.Equals,
+		"865840"+hex.EncodeToString(vp.Signature[:])+"01"+
+			"5820"+"91f1095ac019b50610b5cb56e5db3889177fee8b6422fca3dac04ee1932431a9"+
+			"42012c"+"4404000000"+"4101")
+
+	var vp2 VotePackage
+	err = vp2.UnmarshalCBOR(b)
+	c.Assert(err, qt.IsNil)
+	c.Assert(vp2.Signature, qt.Equals, vp.Signature)
+	c.Assert(vp2.CensusProof.Index, qt.Equals, vp.CensusProof.Index)
+	c.Assert(vp2.CensusProof.PublicKey.String(), qt.Equals,
+		vp.CensusProof.PublicKey.String())
+	c.Assert(vp2.CensusProof.Weight.String(), qt.Equals, "300")
+	c.Assert(vp2.CensusProof.MerkleProof, qt.DeepEquals, vp.CensusProof.MerkleProof)
+	c.Assert(vp2.Vote, qt.DeepEquals, vp.Vote)
+
+	// the binary encoding is smaller than the json one
+	j, err := json.Marshal(vp)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(b) < len(j)/2, qt.IsTrue)
+
+	// undefined weight is encoded as null
+	vp.CensusProof.Weight = nil
+	b, err = vp.MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+	err = vp2.UnmarshalCBOR(b)
+	c.Assert(err, qt.IsNil)
+	c.Assert(vp2.CensusProof.Weight, qt.IsNil)
+
+	// only the canonical encoding is accepted
+	err = vp2.UnmarshalCBOR(append(b, 0))
+	c.Assert(err, qt.ErrorMatches, ".*not in canonical CBOR encoding")
+	vp.CensusProof.Weight = big.NewInt(1)
+	b, err = vp.MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+	nonCanonical := append([]byte{}, b[:len(b)-9]...)
+	nonCanonical = append(nonCanonical, 0x42, 0x00, 0x01) // weight: 0x0001
+	nonCanonical = append(nonCanonical, b[len(b)-7:]...)
+	err = vp2.UnmarshalCBOR(nonCanonical)
+	c.Assert(err, qt.ErrorMatches, ".*not in canonical CBOR encoding")
+
+	// invalid lengths
+	err = vp2.UnmarshalCBOR(b[1:])
+	c.Assert(err, qt.Not(qt.IsNil))
+	invalidSig := append([]byte{0x86, 0x41, 0x00}, b[67:]...)
+	err = vp2.UnmarshalCBOR(invalidSig)
+	c.Assert(err, qt.ErrorMatches, "invalid signature length: 1")
+}
+
+func TestVotePackageHash(t *testing.T) {
+	c := qt.New(t)
+
+	vp := testVotePackage()
+	hash, err := vp.Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(hash), qt.Equals, 32)
+
+	// the hash does not depend on the encoding used to send the VotePackage
+	j, err := json.Marshal(vp)
+	c.Assert(err, qt.IsNil)
+	var vpJSON VotePackage
+	err = json.Unmarshal(j, &vpJSON)
+	c.Assert(err, qt.IsNil)
+	hashJSON, err := vpJSON.Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hashJSON, qt.DeepEquals, hash)
+
+	b, err := vp.MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+	var vpCBOR VotePackage
+	err = vpCBOR.UnmarshalCBOR(b)
+	c.Assert(err, qt.IsNil)
+	hashCBOR, err := vpCBOR.Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hashCBOR, qt.DeepEquals, hash)
+
+	// any change in the VotePackage changes the hash
+	vp.Vote = []byte{0}
+	hash2, err := vp.Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hash2, qt.Not(qt.DeepEquals), hash)
+
+	vp.CensusProof.PublicKey = nil
+	_, err = vp.Hash()
+	c.Assert(err, qt.ErrorMatches, "VotePackage without PublicKey")
+}
+
+func TestUnmarshalVotePackagesCBOR(t *testing.T) {
+	c := qt.New(t)
+
+	vp := testVotePackage()
+	b, err := vp.MarshalCBOR()
+	c.Assert(err, qt.IsNil)
+
+	// array of 2 VotePackages
+	batch := append([]byte{0x82}, b...)
+	batch = append(batch, b...)
+	votes, err := UnmarshalVotePackagesCBOR(batch)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(votes), qt.Equals, 2)
+	c.Assert(votes[1].Signature, qt.Equals, vp.Signature)
+
+	// the VotePackages must be in canonical encoding (weight: 0x00012c)
+	batch = append([]byte{0x81}, b[:len(b)-10]...)
+	batch = append(batch, 0x43, 0x00, 0x01, 0x2c)
+	batch = append(batch, b[len(b)-7:]...)
+	_, err = UnmarshalVotePackagesCBOR(batch)
+	c.Assert(err, qt.ErrorMatches, "VotePackage 0: .*not in canonical CBOR encoding")
+}
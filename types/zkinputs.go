@@ -3,14 +3,12 @@ package types
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"os"
 
+	"github.com/iden3/go-iden3-crypto/constants"
 	"github.com/mitchellh/mapstructure"
 	"github.com/vocdoni/arbo"
 	kvdb "go.vocdoni.io/dvote/db"
-	"go.vocdoni.io/dvote/db/pebbledb"
 	"go.vocdoni.io/dvote/log"
 )
 
@@ -138,6 +136,235 @@ func (z ZKInputs) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// zkInputsJSON is used to decode the ZKInputs, whose big integers are encoded
+// as decimal strings
+type zkInputsJSON struct {
+	ChainID          string     `json:"chainID"`
+	ProcessID        string     `json:"processID"`
+	CensusRoot       string     `json:"censusRoot"`
+	ReceiptsRoot     string     `json:"receiptsRoot"`
+	NVotes           string     `json:"nVotes"`
+	Result           string     `json:"result"`
+	WithReceipts     string     `json:"withReceipts"`
+	Vote             []string   `json:"vote"`
+	Index            []string   `json:"index"`
+	PkX              []string   `json:"pkX"`
+	PkY              []string   `json:"pkY"`
+	Weight           []string   `json:"weight"`
+	S                []string   `json:"s"`
+	R8x              []string   `json:"r8x"`
+	R8y              []string   `json:"r8y"`
+	Siblings         [][]string `json:"siblings"`
+	ReceiptsSiblings [][]string `json:"receiptsSiblings"`
+}
+
+func parseBigInt(name, s string) (*big.Int, error) {
+	b, ok := new(big.Int).SetString(s, 10) //nolint:gomnd
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid number %q", name, s)
+	}
+	return b, nil
+}
+
+func parseBigInts(name string, s []string) ([]*big.Int, error) {
+	b := make([]*big.Int, len(s))
+	for i := 0; i < len(s); i++ {
+		var err error
+		b[i], err = parseBigInt(fmt.Sprintf("%s[%d]", name, i), s[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalJSON implements the json unmarshaler for ZKInputs. The Meta is
+// determined by the length of the decoded slices.
+func (z *ZKInputs) UnmarshalJSON(b []byte) error {
+	var zj zkInputsJSON
+	if err := json.Unmarshal(b, &zj); err != nil {
+		return err
+	}
+	var err error
+	public := []struct {
+		name string
+		s    string
+		v    **big.Int
+	}{
+		{"chainID", zj.ChainID, &z.ChainID},
+		{"processID", zj.ProcessID, &z.ProcessID},
+		{"censusRoot", zj.CensusRoot, &z.CensusRoot},
+		{"receiptsRoot", zj.ReceiptsRoot, &z.ReceiptsRoot},
+		{"nVotes", zj.NVotes, &z.NVotes},
+		{"result", zj.Result, &z.Result},
+		{"withReceipts", zj.WithReceipts, &z.WithReceipts},
+	}
+	for _, p := range public {
+		if *p.v, err = parseBigInt(p.name, p.s); err != nil {
+			return err
+		}
+	}
+	perVote := []struct {
+		name string
+		s    []string
+		v    *[]*big.Int
+	}{
+		{"vote", zj.Vote, &z.Vote},
+		{"index", zj.Index, &z.Index},
+		{"pkX", zj.PkX, &z.PkX},
+		{"pkY", zj.PkY, &z.PkY},
+		{"weight", zj.Weight, &z.Weight},
+		{"s", zj.S, &z.S},
+		{"r8x", zj.R8x, &z.R8x},
+		{"r8y", zj.R8y, &z.R8y},
+	}
+	for _, p := range perVote {
+		if *p.v, err = parseBigInts(p.name, p.s); err != nil {
+			return err
+		}
+	}
+	z.Siblings = make([][]*big.Int, len(zj.Siblings))
+	for i := 0; i < len(zj.Siblings); i++ {
+		z.Siblings[i], err = parseBigInts(fmt.Sprintf("siblings[%d]", i),
+			zj.Siblings[i])
+		if err != nil {
+			return err
+		}
+	}
+	z.ReceiptsSiblings = make([][]*big.Int, len(zj.ReceiptsSiblings))
+	for i := 0; i < len(zj.ReceiptsSiblings); i++ {
+		z.ReceiptsSiblings[i], err = parseBigInts(
+			fmt.Sprintf("receiptsSiblings[%d]", i), zj.ReceiptsSiblings[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	z.Meta.NMaxVotes = len(z.Vote)
+	z.Meta.NLevels = 0
+	if len(z.Siblings) > 0 {
+		// the circuit siblings contain an extra element
+		z.Meta.NLevels = len(z.Siblings[0]) - 1
+	}
+	return nil
+}
+
+// inField returns true if the given value is an element of the BN254 scalar
+// field, used by the circuit
+func inField(v *big.Int) bool {
+	return v != nil && v.Sign() >= 0 && v.Cmp(constants.Q) < 0
+}
+
+// Validate checks that the ZKInputs match its Meta (number of votes & levels),
+// that all the values are inside the BN254 scalar field, that NVotes matches
+// the number of non-empty slots, and that Result matches the sum of the votes
+// weighted
+func (z *ZKInputs) Validate() error {
+	public := []string{"chainID", "processID", "censusRoot", "receiptsRoot",
+		"nVotes", "result", "withReceipts"}
+	for i, v := range z.PublicInputs() {
+		if !inField(v) {
+			return fmt.Errorf("%s: not in the field", public[i])
+		}
+	}
+
+	perVote := []struct {
+		name string
+		v    []*big.Int
+	}{
+		{"vote", z.Vote}, {"index", z.Index}, {"pkX", z.PkX}, {"pkY", z.PkY},
+		{"weight", z.Weight}, {"s", z.S}, {"r8x", z.R8x}, {"r8y", z.R8y},
+	}
+	for _, p := range perVote {
+		if len(p.v) != z.Meta.NMaxVotes {
+			return fmt.Errorf("%s: expected %d elements, got %d", p.name,
+				z.Meta.NMaxVotes, len(p.v))
+		}
+		for i := 0; i < len(p.v); i++ {
+			if !inField(p.v[i]) {
+				return fmt.Errorf("%s[%d]: not in the field", p.name, i)
+			}
+		}
+	}
+	siblings := []struct {
+		name string
+		v    [][]*big.Int
+	}{
+		{"siblings", z.Siblings}, {"receiptsSiblings", z.ReceiptsSiblings},
+	}
+	for _, p := range siblings {
+		if len(p.v) != z.Meta.NMaxVotes {
+			return fmt.Errorf("%s: expected %d elements, got %d", p.name,
+				z.Meta.NMaxVotes, len(p.v))
+		}
+		for i := 0; i < len(p.v); i++ {
+			// the circuit siblings contain an extra element
+			if len(p.v[i]) != z.Meta.NLevels+1 {
+				return fmt.Errorf("%s[%d]: expected %d elements, got %d",
+					p.name, i, z.Meta.NLevels+1, len(p.v[i]))
+			}
+			for j := 0; j < len(p.v[i]); j++ {
+				if !inField(p.v[i][j]) {
+					return fmt.Errorf("%s[%d][%d]: not in the field",
+						p.name, i, j)
+				}
+			}
+		}
+	}
+
+	// the empty slots have no public key
+	nVotes := 0
+	result := big.NewInt(0)
+	for i := 0; i < z.Meta.NMaxVotes; i++ {
+		if z.PkX[i].Sign() != 0 || z.PkY[i].Sign() != 0 {
+			nVotes++
+		}
+		result.Add(result, new(big.Int).Mul(z.Vote[i], z.Weight[i]))
+	}
+	if z.NVotes.Cmp(big.NewInt(int64(nVotes))) != 0 {
+		return fmt.Errorf("nVotes mismatch, expected: %d, got: %s", nVotes,
+			z.NVotes)
+	}
+	if z.Result.Cmp(result) != 0 {
+		return fmt.Errorf("result mismatch, expected: %s, got: %s", result,
+			z.Result)
+	}
+	return nil
+}
+
+// PublicInputs returns the public inputs of the ZKInputs, in the order of the
+// circuit public signals
+func (z *ZKInputs) PublicInputs() []*big.Int {
+	return []*big.Int{z.ChainID, z.ProcessID, z.CensusRoot, z.ReceiptsRoot,
+		z.NVotes, z.Result, z.WithReceipts}
+}
+
+// CheckPublicInputs checks that the given public inputs of a proof match the
+// chainID, processID, censusRoot, nVotes & result of the ZKInputs
+func (z *ZKInputs) CheckPublicInputs(publicInputs []*big.Int) error {
+	if len(publicInputs) != len(z.PublicInputs()) {
+		return fmt.Errorf("expected %d public inputs, got %d",
+			len(z.PublicInputs()), len(publicInputs))
+	}
+	checks := []struct {
+		name          string
+		expected, got *big.Int
+	}{
+		{"chainID", z.ChainID, publicInputs[0]},
+		{"processID", z.ProcessID, publicInputs[1]},
+		{"censusRoot", z.CensusRoot, publicInputs[2]},
+		{"nVotes", z.NVotes, publicInputs[4]},
+		{"result", z.Result, publicInputs[5]},
+	}
+	for _, check := range checks {
+		if check.got.Cmp(check.expected) != 0 {
+			return fmt.Errorf("public input %s mismatch, expected: %s, got: %s",
+				check.name, check.expected, check.got)
+		}
+	}
+	return nil
+}
+
 // MerkleProofToZKInputsFormat prepares the given MerkleProof into the
 // ZKInputs.Siblings format for the circuit
 func (z *ZKInputs) MerkleProofToZKInputsFormat(p []byte) ([]*big.Int, error) {
@@ -160,32 +387,20 @@ func (z *ZKInputs) MerkleProofToZKInputsFormat(p []byte) ([]*big.Int, error) {
 	return b, nil
 }
 
-// ComputeReceipts builds a temp MerkleTree with all the given index &
-// publicKeys (receiptsKeys & receiptsValues), to then compute the siblings of
-// each recipt, adding the siblings & root of the receipts tree to
-// ZKInputs.ReceiptsRoot & ZKInputs.ReceiptsSiblings.
-func (z *ZKInputs) ComputeReceipts(processID uint64, receiptsKeys, receiptsValues [][]byte) error {
-	// prepare receiptsTree
-	dir, err := ioutil.TempDir("/tmp", "prefix") // TODO use processID as prefix/name
-	if err != nil {
-		return err
-	}
-	defer os.Remove(dir) //nolint:errcheck
-	dbPebble, err := pebbledb.New(kvdb.Options{Path: dir})
-	if err != nil {
-		return err
-	}
-	// TODO
-	// prefix := make([]byte, 8)
-	// binary.LittleEndian.PutUint64(prefix, processID)
-	// dbPebble := prefixeddb.NewPrefixedDatabase(originDB, prefix)
-
+// ComputeReceipts builds in the given database a MerkleTree with all the
+// given index & publicKeys (receiptsKeys & receiptsValues), to then compute
+// the siblings of each recipt, adding the siblings & root of the receipts tree
+// to ZKInputs.ReceiptsRoot & ZKInputs.ReceiptsSiblings. The given database is
+// expected to be empty, and the receipts tree is kept in it, so that later
+// proofs of inclusion of the receipts can be generated.
+func (z *ZKInputs) ComputeReceipts(database kvdb.Database, receiptsKeys,
+	receiptsValues [][]byte) error {
 	receiptsTreeConfig := arbo.Config{
-		Database:     dbPebble,
+		Database:     database,
 		MaxLevels:    z.Meta.NLevels,
 		HashFunction: arbo.HashFunctionPoseidon,
 	}
-	wTx := dbPebble.WriteTx()
+	wTx := database.WriteTx()
 	defer wTx.Discard()
 
 	receiptsTree, err := arbo.NewTreeWithTx(wTx, receiptsTreeConfig)
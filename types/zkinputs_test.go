@@ -0,0 +1,85 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/iden3/go-iden3-crypto/constants"
+)
+
+func testZKInputs() *ZKInputs {
+	z := NewZKInputs(4, 3)
+	z.ChainID = big.NewInt(3)
+	z.ProcessID = big.NewInt(123)
+	z.CensusRoot = big.NewInt(42)
+	z.WithReceipts = big.NewInt(1)
+	// two votes, one positive with weight 10 and one negative
+	for i := 0; i < 2; i++ {
+		z.Index[i] = big.NewInt(int64(i))
+		z.PkX[i] = big.NewInt(int64(100 + i))
+		z.PkY[i] = big.NewInt(int64(200 + i))
+		z.Weight[i] = big.NewInt(10)
+		z.S[i] = big.NewInt(300)
+		z.Siblings[i][0] = big.NewInt(400)
+	}
+	z.Vote[0] = big.NewInt(1)
+	z.NVotes = big.NewInt(2)
+	z.Result = big.NewInt(10)
+	return z
+}
+
+func TestZKInputsJSON(t *testing.T) {
+	c := qt.New(t)
+
+	z := testZKInputs()
+	c.Assert(z.Validate(), qt.IsNil)
+
+	b, err := json.Marshal(z)
+	c.Assert(err, qt.IsNil)
+	var z2 ZKInputs
+	err = json.Unmarshal(b, &z2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(z2.Meta, qt.Equals, z.Meta)
+	c.Assert(z2.Validate(), qt.IsNil)
+	b2, err := json.Marshal(z2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(b2), qt.Equals, string(b))
+
+	err = json.Unmarshal([]byte(`{"chainID": "3x"}`), &z2)
+	c.Assert(err, qt.ErrorMatches, `chainID: invalid number "3x"`)
+	err = json.Unmarshal([]byte(`{"chainID": "3", "processID": "1",
+		"censusRoot": "1", "receiptsRoot": "1", "nVotes": "1", "result": "1",
+		"withReceipts": "1", "vote": ["1", ""]}`), &z2)
+	c.Assert(err, qt.ErrorMatches, `vote\[1\]: invalid number ""`)
+}
+
+func TestZKInputsValidate(t *testing.T) {
+	c := qt.New(t)
+
+	z := testZKInputs()
+	z.Weight = z.Weight[:3]
+	c.Assert(z.Validate(), qt.ErrorMatches, "weight: expected 4 elements, got 3")
+
+	z = testZKInputs()
+	z.ReceiptsSiblings[2] = z.ReceiptsSiblings[2][:3]
+	c.Assert(z.Validate(), qt.ErrorMatches,
+		`receiptsSiblings\[2\]: expected 4 elements, got 3`)
+
+	z = testZKInputs()
+	z.Siblings[1][3] = new(big.Int).Set(constants.Q)
+	c.Assert(z.Validate(), qt.ErrorMatches, `siblings\[1\]\[3\]: not in the field`)
+
+	z = testZKInputs()
+	z.CensusRoot = big.NewInt(-1)
+	c.Assert(z.Validate(), qt.ErrorMatches, "censusRoot: not in the field")
+
+	z = testZKInputs()
+	z.NVotes = big.NewInt(3)
+	c.Assert(z.Validate(), qt.ErrorMatches, "nVotes mismatch, expected: 2, got: 3")
+
+	z = testZKInputs()
+	z.Vote[1] = big.NewInt(1)
+	c.Assert(z.Validate(), qt.ErrorMatches, "result mismatch, expected: 20, got: 10")
+}
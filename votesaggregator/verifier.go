@@ -0,0 +1,143 @@
+package votesaggregator
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/aragon/ovote-node/types"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+)
+
+// ErrVerifierBusy is returned when the queue of votes pending to be verified is
+// full, so the vote should be sent again later
+var ErrVerifierBusy = errors.New("vote verification queue is full, retry later")
+
+// verifyKey identifies the verification of a VotePackage in a process. The
+// VotePackage hash commits to the signature, the MerkleProof and the vote, so
+// a VotePackage that differs in any of them is verified again.
+type verifyKey struct {
+	processID uint64
+	pubK      babyjub.PublicKeyComp
+	hash      [32]byte
+}
+
+type verifyResult struct {
+	code types.VoteErrorCode
+	err  error
+}
+
+type verifyTask struct {
+	process *types.Process
+	vote    *types.VotePackage
+	key     verifyKey
+	result  *verifyResult
+	wg      *sync.WaitGroup
+}
+
+// verifier verifies the votes in a pool of workers, fed by a bounded queue,
+// and caches the results so that the votes sent again are not verified twice
+type verifier struct {
+	verify func(*types.Process, *types.VotePackage) (types.VoteErrorCode, error)
+	tasks  chan verifyTask
+
+	// mu protects cache, order & next
+	mu    sync.Mutex
+	cache map[verifyKey]verifyResult
+	// order contains the cached keys in insertion order, as a ring, to
+	// evict the oldest one once the cache is full
+	order []verifyKey
+	next  int
+}
+
+// newVerifier starts nWorkers goroutines that verify the queued votes with the
+// given verify function
+func newVerifier(nWorkers, queueSize, cacheSize int,
+	verify func(*types.Process, *types.VotePackage) (types.VoteErrorCode, error)) *verifier {
+	v := &verifier{
+		verify: verify,
+		tasks:  make(chan verifyTask, queueSize),
+		cache:  make(map[verifyKey]verifyResult, cacheSize),
+		order:  make([]verifyKey, cacheSize),
+	}
+	for i := 0; i < nWorkers; i++ {
+		go v.worker()
+	}
+	return v
+}
+
+func (v *verifier) worker() {
+	for t := range v.tasks {
+		code, err := v.verify(t.process, t.vote)
+		*t.result = verifyResult{code: code, err: err}
+		v.add(t.key, *t.result)
+		t.wg.Done()
+	}
+}
+
+func newVerifyKey(processID uint64, vote *types.VotePackage, hash []byte) verifyKey {
+	k := verifyKey{
+		processID: processID,
+		pubK:      vote.CensusProof.PublicKey.Compress(),
+	}
+	copy(k.hash[:], hash)
+	return k
+}
+
+func (v *verifier) get(k verifyKey) (verifyResult, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	r, ok := v.cache[k]
+	return r, ok
+}
+
+func (v *verifier) add(k verifyKey, r verifyResult) {
+	if len(v.order) == 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.cache[k]; ok {
+		return
+	}
+	if len(v.cache) == len(v.order) {
+		delete(v.cache, v.order[v.next])
+	}
+	v.cache[k] = r
+	v.order[v.next] = k
+	v.next = (v.next + 1) % len(v.order)
+}
+
+// verifyVotes verifies the given votes of the given process, whose
+// VotePackage hashes are given, and returns the result of each vote. The
+// cached results are reused, and the rest of the votes are queued. If the
+// queue is full when the votes arrive, ErrVerifierBusy is returned; once the
+// first vote is queued, the rest wait until there is space in the queue.
+func (v *verifier) verifyVotes(process *types.Process, votes []*types.VotePackage,
+	hashes [][]byte) ([]verifyResult, error) {
+	results := make([]verifyResult, len(votes))
+	var wg sync.WaitGroup
+	queued := 0
+	for i := 0; i < len(votes); i++ {
+		k := newVerifyKey(process.ID, votes[i], hashes[i])
+		if r, ok := v.get(k); ok {
+			results[i] = r
+			continue
+		}
+		wg.Add(1)
+		t := verifyTask{process: process, vote: votes[i], key: k,
+			result: &results[i], wg: &wg}
+		if queued > 0 {
+			v.tasks <- t
+			queued++
+			continue
+		}
+		select {
+		case v.tasks <- t:
+			queued++
+		default:
+			return nil, ErrVerifierBusy
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -0,0 +1,169 @@
+package votesaggregator
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aragon/ovote-node/test"
+	"github.com/aragon/ovote-node/types"
+	qt "github.com/frankban/quicktest"
+)
+
+func testVerifierVotes(c *qt.C, n int) ([]*types.VotePackage, [][]byte) {
+	keys := test.GenUserKeys(n)
+	var votes []*types.VotePackage
+	var hashes [][]byte
+	for i := 0; i < n; i++ {
+		vote := &types.VotePackage{
+			CensusProof: types.CensusProof{
+				Index:     uint64(i),
+				PublicKey: &keys.PublicKeys[i],
+			},
+			Vote: []byte{1},
+		}
+		hash, err := vote.Hash()
+		c.Assert(err, qt.IsNil)
+		votes = append(votes, vote)
+		hashes = append(hashes, hash)
+	}
+	return votes, hashes
+}
+
+func TestVerifierCache(t *testing.T) {
+	c := qt.New(t)
+
+	var calls int32
+	v := newVerifier(2, 10, 3, func(_ *types.Process,
+		vote *types.VotePackage) (types.VoteErrorCode, error) {
+		atomic.AddInt32(&calls, 1)
+		if vote.CensusProof.Index%2 == 1 {
+			return types.VoteErrInvalidSignature, types.ErrInvalidSignature
+		}
+		return "", nil
+	})
+	process := &types.Process{ID: 123}
+	votes, hashes := testVerifierVotes(c, 4)
+
+	results, err := v.verifyVotes(process, votes[:3], hashes[:3])
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(3))
+	c.Assert(results[0].err, qt.IsNil)
+	c.Assert(results[1].code, qt.Equals, types.VoteErrInvalidSignature)
+	c.Assert(results[1].err, qt.Equals, types.ErrInvalidSignature)
+	c.Assert(results[2].err, qt.IsNil)
+
+	// the cached results are reused
+	results, err = v.verifyVotes(process, votes[:3], hashes[:3])
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(3))
+	c.Assert(results[1].code, qt.Equals, types.VoteErrInvalidSignature)
+
+	// but not for other processes
+	_, err = v.verifyVotes(&types.Process{ID: 124}, votes[:1], hashes[:1])
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(4))
+
+	// once the cache is full, the oldest results are evicted: the result of
+	// the first vote has been replaced by the one of the other process
+	_, err = v.verifyVotes(process, votes[:2], hashes[:2])
+	c.Assert(err, qt.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), qt.Equals, int32(5))
+	c.Assert(len(v.cache), qt.Equals, 3)
+}
+
+func TestVerifierBusy(t *testing.T) {
+	c := qt.New(t)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	v := newVerifier(1, 1, 10, func(_ *types.Process,
+		_ *types.VotePackage) (types.VoteErrorCode, error) {
+		started <- struct{}{}
+		<-release
+		return "", nil
+	})
+	process := &types.Process{ID: 123}
+	votes, hashes := testVerifierVotes(c, 3)
+
+	// the first vote keeps the worker busy, and the second one fills the
+	// queue
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := v.verifyVotes(process, votes[:1], hashes[:1])
+		c.Check(err, qt.IsNil)
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		_, err := v.verifyVotes(process, votes[1:2], hashes[1:2])
+		c.Check(err, qt.IsNil)
+	}()
+	for len(v.tasks) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := v.verifyVotes(process, votes[2:], hashes[2:])
+	c.Assert(err, qt.Equals, ErrVerifierBusy)
+
+	close(release)
+	<-started
+	wg.Wait()
+
+	// once there is space in the queue, the votes are verified again
+	go func() { <-started }()
+	_, err = v.verifyVotes(process, votes[2:], hashes[2:])
+	c.Assert(err, qt.IsNil)
+}
+
+func benchmarkVerifier(b *testing.B, nWorkers, cacheSize int, retries bool) {
+	c := qt.New(b)
+	nVotes := 64
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, 3, processID, nVotes, 60)
+	process, err := va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+	v := newVerifier(nWorkers, nVotes, cacheSize, va.verifyVote)
+
+	votePtrs := make([]*types.VotePackage, nVotes)
+	hashes := make([][]byte, nVotes)
+	for i := 0; i < nVotes; i++ {
+		votePtrs[i] = &votes[i]
+		hashes[i], err = votes[i].Hash()
+		c.Assert(err, qt.IsNil)
+	}
+	if retries {
+		_, err = v.verifyVotes(process, votePtrs, hashes)
+		c.Assert(err, qt.IsNil)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		results, err := v.verifyVotes(process, votePtrs, hashes)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if results[0].err != nil {
+			b.Fatal(results[0].err)
+		}
+	}
+}
+
+// BenchmarkVerifyVotes measures the verification of a batch of 64 votes, with
+// a single worker, with a worker per cpu, and with the results already cached
+func BenchmarkVerifyVotes(b *testing.B) {
+	b.Run("1worker", func(b *testing.B) {
+		benchmarkVerifier(b, 1, 0, false)
+	})
+	b.Run(fmt.Sprintf("%dcpus", runtime.NumCPU()), func(b *testing.B) {
+		benchmarkVerifier(b, runtime.NumCPU(), 0, false)
+	})
+	b.Run("cached", func(b *testing.B) {
+		benchmarkVerifier(b, runtime.NumCPU(), 64, true)
+	})
+}
@@ -2,36 +2,273 @@ package votesaggregator
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"math/big"
-	"strings"
+	"runtime"
 	"time"
 
 	"github.com/aragon/ovote-node/db"
 	"github.com/aragon/ovote-node/prover"
 	"github.com/aragon/ovote-node/types"
+	"github.com/iden3/go-iden3-crypto/babyjub"
 	"github.com/vocdoni/arbo"
+	kvdb "go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/prefixeddb"
 	"go.vocdoni.io/dvote/log"
 )
 
-const syncSleepTime = 6
+const (
+	syncSleepTime = 6
+
+	defaultProofTimeout     = 30 * time.Minute
+	defaultMaxProofAttempts = 3
+	defaultRetryBackoff     = time.Minute
+
+	defaultVoteStatusRequestTTL = 5 * time.Minute
+
+	defaultVerifyQueueSize = 1024
+	defaultVerifyCacheSize = 10000
+)
+
+var (
+	// ErrQuorumNotReached is returned when the votes of a Process do not
+	// reach the MinParticipation or the MinPositiveVotes thresholds
+	ErrQuorumNotReached = errors.New("quorum not reached")
+	// ErrProofTimeout is used to reject the proof attempts that have not
+	// been completed before the ProofTimeout
+	ErrProofTimeout = errors.New("proof generation timeout")
+	// ErrMaxProofAttempts is returned when the proof generation of a
+	// Process has failed MaxProofAttempts times
+	ErrMaxProofAttempts = errors.New("max proof attempts reached")
+	// ErrProofRetryBackoff is returned when the last proof attempt failed
+	// and the backoff time until the next attempt has not passed yet
+	ErrProofRetryBackoff = errors.New("waiting to retry the proof generation")
+	// ErrCallbacksDisabled is returned when a proof completion callback is
+	// received but no CallbackSecret has been configured
+	ErrCallbacksDisabled = errors.New("proof callbacks are not enabled")
+	// ErrInvalidCallbackSignature is returned when the signature of a proof
+	// completion callback does not match the CallbackSecret
+	ErrInvalidCallbackSignature = errors.New("invalid proof callback signature")
+	// ErrInvalidCallback is returned when a signed proof completion callback
+	// is expired, or was not sent for the proof attempt it is received for
+	ErrInvalidCallback = errors.New("invalid proof callback")
+	// ErrVotingClosed is returned when a vote is received once the
+	// ResPubStartBlock of the Process has been reached
+	ErrVotingClosed = errors.New("votes can not be added")
+	// ErrCircuitCapacity is returned when the CensusSize of a Process does
+	// not fit in the circuit used by the VotesAggregator
+	ErrCircuitCapacity = errors.New("exceeds the circuit capacity")
+	// ErrInvalidVotePackage is returned when a VotePackage can not be
+	// verified, as its MerkleProof or signature are malformed
+	ErrInvalidVotePackage = errors.New("invalid VotePackage")
+	// ErrMerkleProofTooDeep is returned when the MerkleProof of a vote has
+	// more siblings than the circuit nLevels
+	ErrMerkleProofTooDeep = errors.New("MerkleProof exceeds the circuit nLevels")
+	// ErrResPubStartBlockNotReached is returned when the proof generation of
+	// a Process is requested before its ResPubStartBlock
+	ErrResPubStartBlockNotReached = errors.New("resPubStartBlock not reached yet")
+	// ErrTooManyVotes is returned when the votes of a Process exceed the
+	// circuit nMaxVotes
+	ErrTooManyVotes = errors.New("number of votes exceeds the circuit nMaxVotes")
+	// ErrInvalidVoteValue is returned when a stored vote is not a binary
+	// value, so it can not be counted
+	ErrInvalidVoteValue = errors.New("invalid vote value")
+	// ErrProofFailed is returned when the last proof attempt of a Process
+	// has failed
+	ErrProofFailed = errors.New("proof attempt failed")
+	// ErrSignatureRequired is returned when the vote status is requested
+	// without signature and VoteStatusAuth is enabled
+	ErrSignatureRequired = errors.New("signature required to get the vote status")
+	// ErrVoteStatusRequestExpired is returned when the timestamp of a signed
+	// vote status request is out of the VoteStatusRequestTTL
+	ErrVoteStatusRequestExpired = errors.New("vote status request expired")
+	// ErrReceiptNotFound is returned when the vote of the requested PublicKey
+	// is not in the receipts tree of the Process
+	ErrReceiptNotFound = errors.New("receipt does not exist in the receipts tree")
+)
 
 // VotesAggregator receives the votes and aggregates them to generate a zkProof
 type VotesAggregator struct {
-	db      *db.SQLite
-	chainID uint64 // determined by config
-	prover  *prover.Client
+	db *db.SQLite
+	// receiptsDB stores the receipts tree of each process, under the
+	// processID prefix
+	receiptsDB kvdb.Database
+	chainID    uint64 // determined by config
+	// circuit determines the nMaxVotes & nLevels of the circuit used to
+	// generate the zkProofs
+	circuit types.ZKCircuitMeta
+	// provers balances the proof attempts between the prover-servers
+	provers *prover.Pool
+	// proofTimeout is the deadline of each proof attempt
+	proofTimeout time.Duration
+	// maxProofAttempts is the number of proof attempts after which the
+	// proof generation of a process is considered failed
+	maxProofAttempts int
+	// retryBackoff is the time to wait after the first failed attempt,
+	// doubled after each failed attempt
+	retryBackoff time.Duration
+	// voteStatusAuth determines if a signature of the voter is required to
+	// get the status of its vote
+	voteStatusAuth bool
+	// voteStatusRequestTTL is the maximum difference between the timestamp
+	// of a signed vote status request and the current time
+	voteStatusRequestTTL time.Duration
+	// hideTally determines if the result of the processes is hidden
+	// while they are accepting votes
+	hideTally bool
+	// proveWithoutQuorum determines if the zkProof is generated for the
+	// processes that do not reach the thresholds
+	proveWithoutQuorum bool
+	// verificationKey is used to verify the proofs returned by the prover
+	verificationKey *prover.VerificationKey
+	// callbackSecret is used to check the signature of the proof
+	// completion callbacks sent by the prover-servers
+	callbackSecret []byte
+	// verifier verifies the votes in a pool of workers
+	verifier *verifier
+}
+
+// Options is used to pass the parameters to load a new VotesAggregator
+type Options struct {
+	// SQLite is the db where the processes, votes and proofs are stored
+	SQLite *db.SQLite
+	// ReceiptsDB is the db where the receipts trees of the processes are
+	// kept
+	ReceiptsDB kvdb.Database
+	ChainID    uint64
+	// Circuit determines the configuration of the circuit for which the
+	// zkInputs are generated
+	Circuit types.ZKCircuitMeta
+	// Provers is the pool of prover-servers used to generate the
+	// zkProofs
+	Provers *prover.Pool
+	// ProofTimeout is the deadline of each proof attempt. If zero,
+	// defaults to 30 minutes
+	ProofTimeout time.Duration
+	// MaxProofAttempts is the maximum number of proof attempts of a
+	// process. If zero, defaults to 3
+	MaxProofAttempts int
+	// RetryBackoff is the time to wait after the first failed proof
+	// attempt, doubled after each failed attempt. If zero, defaults to 1
+	// minute
+	RetryBackoff time.Duration
+	// VoteStatusAuth, when set to true, requires a signature of the voter
+	// to return the status of its vote, so that participation is not
+	// public
+	VoteStatusAuth bool
+	// VoteStatusRequestTTL is the maximum age of the signed vote status
+	// requests, so that a leaked signature can not be replayed. If zero,
+	// defaults to 5 minutes
+	VoteStatusRequestTTL time.Duration
+	// HideTally, when set to true, hides the current result of the
+	// processes until they are frozen
+	HideTally bool
+	// ProveWithoutQuorum, when set to true, generates the zkProof of the
+	// processes even if they do not reach the MinParticipation or the
+	// MinPositiveVotes thresholds
+	ProveWithoutQuorum bool
+	// VerificationKey of the circuit, used to verify the proofs before
+	// accepting them. Required.
+	VerificationKey *prover.VerificationKey
+	// CallbackSecret is the secret of this node in the prover-servers,
+	// used to check the signature of the proof completion callbacks. If
+	// empty, the callbacks are rejected and the proofs are only retrieved
+	// by polling
+	CallbackSecret []byte
+	// VerifyWorkers is the number of votes verified concurrently. If zero,
+	// defaults to the number of cpus
+	VerifyWorkers int
+	// VerifyQueueSize is the number of votes that can wait to be verified,
+	// once the queue is full the new votes are rejected with
+	// ErrVerifierBusy. If zero, defaults to 1024
+	VerifyQueueSize int
+	// VerifyCacheSize is the number of verification results kept, so that
+	// the votes sent again are not verified twice. If zero, defaults to
+	// 10000
+	VerifyCacheSize int
+}
+
+// New returns a VotesAggregator with the given Options
+func New(opts Options) (*VotesAggregator, error) {
+	circuit := opts.Circuit
+	if circuit.NMaxVotes <= 0 || circuit.NLevels <= 0 ||
+		circuit.NLevels > types.MaxLevels {
+		return nil, fmt.Errorf("invalid circuit configuration,"+
+			" nMaxVotes: %d, nLevels: %d", circuit.NMaxVotes, circuit.NLevels)
+	}
+	if opts.VerificationKey == nil {
+		return nil, fmt.Errorf("a VerificationKey is required to verify the proofs")
+	}
+	va := &VotesAggregator{
+		db:                   opts.SQLite,
+		receiptsDB:           opts.ReceiptsDB,
+		chainID:              opts.ChainID,
+		circuit:              circuit,
+		provers:              opts.Provers,
+		proofTimeout:         opts.ProofTimeout,
+		maxProofAttempts:     opts.MaxProofAttempts,
+		retryBackoff:         opts.RetryBackoff,
+		voteStatusAuth:       opts.VoteStatusAuth,
+		voteStatusRequestTTL: opts.VoteStatusRequestTTL,
+		hideTally:            opts.HideTally,
+		proveWithoutQuorum:   opts.ProveWithoutQuorum,
+		verificationKey:      opts.VerificationKey,
+		callbackSecret:       opts.CallbackSecret,
+	}
+	if va.proofTimeout == 0 {
+		va.proofTimeout = defaultProofTimeout
+	}
+	if va.maxProofAttempts == 0 {
+		va.maxProofAttempts = defaultMaxProofAttempts
+	}
+	if va.retryBackoff == 0 {
+		va.retryBackoff = defaultRetryBackoff
+	}
+	if va.voteStatusRequestTTL == 0 {
+		va.voteStatusRequestTTL = defaultVoteStatusRequestTTL
+	}
+
+	verifyWorkers := opts.VerifyWorkers
+	if verifyWorkers == 0 {
+		verifyWorkers = runtime.NumCPU()
+	}
+	verifyQueueSize := opts.VerifyQueueSize
+	if verifyQueueSize == 0 {
+		verifyQueueSize = defaultVerifyQueueSize
+	}
+	verifyCacheSize := opts.VerifyCacheSize
+	if verifyCacheSize == 0 {
+		verifyCacheSize = defaultVerifyCacheSize
+	}
+	if verifyWorkers < 0 || verifyQueueSize < 0 || verifyCacheSize < 0 {
+		return nil, fmt.Errorf("invalid vote verification configuration,"+
+			" workers: %d, queue: %d, cache: %d", verifyWorkers,
+			verifyQueueSize, verifyCacheSize)
+	}
+	va.verifier = newVerifier(verifyWorkers, verifyQueueSize, verifyCacheSize,
+		va.verifyVote)
+	return va, nil
 }
 
-// New returns a VotesAggregator with the given SQLite db
-func New(sqlite *db.SQLite, chainID uint64, p *prover.Client) (*VotesAggregator, error) {
-	return &VotesAggregator{db: sqlite, chainID: chainID, prover: p}, nil
+// checkCircuitCapacity returns an error if the Census of the given Process
+// can not be held by the circuit used by the VotesAggregator
+func (va *VotesAggregator) checkCircuitCapacity(process *types.Process) error {
+	maxNLeafs := types.MaxNLeafsForLevels(va.circuit.NLevels)
+	if process.CensusSize > maxNLeafs {
+		return fmt.Errorf("ProcessID: %d, CensusSize (%d) %w"+
+			" (nLevels: %d, max keys: %d)", process.ID, process.CensusSize,
+			ErrCircuitCapacity, va.circuit.NLevels, maxNLeafs)
+	}
+	return nil
 }
 
 // SyncProcesses actively checks if there are any processes closed, to trigger
-// the generation of the zkInputs & zkProof of them. This method is designed to
-// be called in a goroutine
+// the generation of the zkInputs & zkProof of them, and follows the proofs
+// being generated, retrying the failed ones. This method is designed to be
+// called in a goroutine
 func (va *VotesAggregator) SyncProcesses() {
 	for {
 		// if there are Frozen processes, generate their zkProofs
@@ -39,25 +276,197 @@ func (va *VotesAggregator) SyncProcesses() {
 		if err != nil {
 			log.Error(err)
 		}
-		if len(processes) > 0 {
-			process := processes[0]
-			// WIP
-			_ = process
-			// generate zkInputs for the process
-			// wait until prover is ready
-			// send the zkInputs to the prover
-			// zkProof, err := va.proverClient.ComputeProof(zkInputs)
-			// update ProcessStatus to types.ProcessStatusFinished
+		// the quorum of every Frozen process is checked, while the
+		// capacity of the provers is only checked once, before the first
+		// proof is dispatched
+		hasCapacity := va.proversCapacity()
+		for i := 0; i < len(processes); i++ {
+			err = va.generateProof(processes[i].ID, hasCapacity)
+			if errors.Is(err, ErrQuorumNotReached) {
+				log.Info(err)
+			} else if errors.Is(err, ErrProofRetryBackoff) ||
+				errors.Is(err, prover.ErrNoProverAvailable) {
+				log.Debug(err)
+			} else if err != nil {
+				log.Error(err)
+			}
+		}
+
+		// check the proofs being generated
+		processes, err = va.db.ReadProcessesByStatus(
+			types.ProcessStatusProofGenerating)
+		if err != nil {
+			log.Error(err)
+		}
+		for i := 0; i < len(processes); i++ {
+			if err := va.checkProofGeneration(processes[i].ID); err != nil {
+				log.Error(err)
+			}
+		}
+
+		// cancel the proofs that are no longer needed
+		if err := va.cancelClosedProofs(); err != nil {
+			log.Error(err)
 		}
 
 		time.Sleep(syncSleepTime * time.Second)
 	}
 }
 
-// ProcessInfo returns info about the Process
-func (va *VotesAggregator) ProcessInfo(processID uint64) (*types.Process, error) {
-	// TODO add count of votes in the process
-	return va.db.ReadProcessByID(processID)
+// proversCapacity returns a function that reports if the provers have
+// capacity for a new proof, querying them only on its first call
+func (va *VotesAggregator) proversCapacity() func() bool {
+	var checked, capacity bool
+	return func() bool {
+		if !checked {
+			capacity = va.provers.HasCapacity()
+			checked = true
+		}
+		return capacity
+	}
+}
+
+// cancelClosedProofs cancels the pending proof attempts of the processes that
+// have been closed in the SmartContract. The attempts are marked with
+// prover.ErrProofCancelled, also when the prover fails to cancel them, so
+// that they are not retried.
+func (va *VotesAggregator) cancelClosedProofs() error {
+	attempts, err := va.db.GetPendingProofsByProcessStatus(
+		types.ProcessStatusClosed)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(attempts); i++ {
+		err = va.provers.Cancel(attempts[i].Prover, attempts[i].ProofID)
+		if err != nil {
+			log.Warnw("can not cancel proof generation", "processID",
+				attempts[i].ProcessID, "proofID", attempts[i].ProofID,
+				"prover", attempts[i].Prover, "err", err)
+		}
+		err = va.db.SetProofError(attempts[i].ProcessID, attempts[i].ProofID,
+			attempts[i].Prover, []byte{}, []byte{},
+			prover.ErrProofCancelled.Error())
+		if err != nil {
+			return err
+		}
+		log.Infow("proof generation cancelled", "processID",
+			attempts[i].ProcessID, "proofID", attempts[i].ProofID)
+	}
+	return nil
+}
+
+// proofExpired returns true if the given proof attempt is still pending after
+// the proofTimeout
+func (va *VotesAggregator) proofExpired(attempt *types.ProofInDB) bool {
+	return attempt.Error == "" && len(attempt.Proof) == 0 &&
+		time.Since(attempt.InsertedDatetime) > va.proofTimeout
+}
+
+// checkProofGeneration tries to retrieve the proof of the last attempt of the
+// given process. If the attempt has expired, failed in the prover, or its
+// proof has been rejected, the process is set back to ProcessStatusFrozen, so
+// that a new attempt is done.
+func (va *VotesAggregator) checkProofGeneration(processID uint64) error {
+	attempts, err := va.db.GetProofsByProcessID(processID)
+	if err != nil {
+		return err
+	}
+	if len(attempts) == 0 {
+		return fmt.Errorf("ProcessID: %d, no proof attempts found", processID)
+	}
+	last := attempts[0]
+	if va.proofExpired(&last) {
+		err = va.db.SetProofError(processID, last.ProofID, last.Prover,
+			[]byte{}, []byte{}, ErrProofTimeout.Error())
+		if err != nil {
+			return err
+		}
+		log.Warnw("proof attempt expired", "processID", processID,
+			"proofID", last.ProofID)
+		return va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	}
+
+	_, err = va.GetProof(processID)
+	if errors.Is(err, prover.ErrProofFailed) {
+		// retry without waiting for the proofTimeout
+		err = va.db.SetProofError(processID, last.ProofID, last.Prover,
+			[]byte{}, []byte{}, err.Error())
+		if err != nil {
+			return err
+		}
+		log.Warnw("proof attempt failed", "processID", processID,
+			"proofID", last.ProofID, "prover", last.Prover)
+		return va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	}
+	if errors.Is(err, prover.ErrInvalidProof) {
+		log.Warn(err)
+		return va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	}
+	if err != nil {
+		// the proof is not ready yet
+		log.Debug(err)
+	}
+	return nil
+}
+
+// checkQuorum evaluates the MinParticipation and MinPositiveVotes thresholds
+// of the given Process over its stored votes. If they are not reached, the
+// Process is set to ProcessStatusQuorumNotReached and ErrQuorumNotReached is
+// returned, unless the VotesAggregator is configured to prove anyway.
+func (va *VotesAggregator) checkQuorum(process *types.Process) error {
+	// the total weight is not used, as the SmartContract evaluates the
+	// thresholds over the nVotes & result
+	nVotes, _, result, err := va.db.GetVotesTally(process.ID)
+	if err != nil {
+		return err
+	}
+	if process.QuorumReached(nVotes, result) {
+		return nil
+	}
+	if va.proveWithoutQuorum {
+		log.Warnf("ProcessID: %d, quorum not reached (nVotes: %d, result: %d),"+
+			" generating the proof anyway", process.ID, nVotes, result)
+		return nil
+	}
+	if process.Status != types.ProcessStatusQuorumNotReached {
+		err = va.db.UpdateProcessStatus(process.ID,
+			types.ProcessStatusQuorumNotReached)
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w, ProcessID: %d, nVotes: %d, result: %d",
+		ErrQuorumNotReached, process.ID, nVotes, result)
+}
+
+// ProcessInfo returns info about the Process, together with the current count
+// of its votes
+func (va *VotesAggregator) ProcessInfo(processID uint64) (*types.ProcessInfo, error) {
+	process, err := va.db.ReadProcessByID(processID)
+	if err != nil {
+		return nil, err
+	}
+	nVotes, weight, result, err := va.db.GetVotesTally(processID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &types.ProcessInfo{
+		Process:                 *process,
+		NVotes:                  nVotes,
+		Weight:                  weight,
+		MinParticipationReached: process.MinParticipationReached(nVotes),
+	}
+	if process.CensusSize > 0 {
+		info.Participation = float64(nVotes*100) / float64(process.CensusSize)
+	}
+	if va.hideTally && process.Status == types.ProcessStatusOn {
+		return info, nil
+	}
+	minPositiveVotesReached := process.MinPositiveVotesReached(nVotes, result)
+	info.Result = result
+	info.MinPositiveVotesReached = &minPositiveVotesReached
+	return info, nil
 }
 
 // AddVote adds to the VotesAggregator's db the given vote for the given
@@ -72,20 +481,216 @@ func (va *VotesAggregator) AddVote(processID uint64, votePackage types.VotePacka
 	if err != nil {
 		return err
 	}
+	// the VotePackage hash is used as idempotency key, so sending again an
+	// already stored VotePackage succeeds
+	hash, err := votePackage.Hash()
+	if err != nil {
+		return err
+	}
+	stored, err := va.db.HasVotePackage(processID, hash)
+	if err != nil {
+		return err
+	}
+	if stored {
+		return nil
+	}
 	if process.Status != types.ProcessStatusOn {
-		return fmt.Errorf("process ResPubStartBlock (%d) reached,"+
-			" votes can not be added", process.ResPubStartBlock)
+		return fmt.Errorf("process ResPubStartBlock (%d) reached, %w",
+			process.ResPubStartBlock, ErrVotingClosed)
 	}
-
-	// check signature (babyjubjub) and MerkleProof
-	if err := votePackage.Verify(va.chainID, processID, process.CensusRoot); err != nil {
+	if err := va.checkCircuitCapacity(process); err != nil {
 		return err
 	}
+	results, err := va.verifier.verifyVotes(process,
+		[]*types.VotePackage{&votePackage}, [][]byte{hash})
+	if err != nil {
+		return err
+	}
+	if results[0].err != nil {
+		return results[0].err
+	}
 
 	// store VotePackage in the SQL DB for the given CensusRoot
 	return va.db.StoreVotePackage(processID, votePackage)
 }
 
+// verifyVote checks that the MerkleProof of the given vote fits in the circuit,
+// and its signature (babyjubjub) and MerkleProof. If the vote is not valid,
+// the error is returned together with its VoteErrorCode.
+func (va *VotesAggregator) verifyVote(process *types.Process,
+	votePackage *types.VotePackage) (types.VoteErrorCode, error) {
+	// the MerkleProof depth must fit in the circuit
+	siblings, err := arbo.UnpackSiblings(arbo.HashFunctionPoseidon,
+		votePackage.CensusProof.MerkleProof)
+	if err != nil {
+		return types.VoteErrInvalidPackage,
+			fmt.Errorf("%w: %s", ErrInvalidVotePackage, err)
+	}
+	if len(siblings) > va.circuit.NLevels {
+		return types.VoteErrMerkleProofTooDeep, fmt.Errorf("%w (%d), siblings: %d",
+			ErrMerkleProofTooDeep, va.circuit.NLevels, len(siblings))
+	}
+
+	err = votePackage.Verify(va.chainID, process.ID, process.CensusRoot)
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, types.ErrInvalidSignature):
+		return types.VoteErrInvalidSignature, err
+	case errors.Is(err, types.ErrInvalidMerkleProof):
+		return types.VoteErrInvalidMerkleProof, err
+	default:
+		return types.VoteErrInvalidPackage,
+			fmt.Errorf("%w: %s", ErrInvalidVotePackage, err)
+	}
+}
+
+// AddVotes adds to the VotesAggregator's db the given batch of votes for the
+// given processID. The votes are verified in parallel, and the valid ones
+// are stored in a single transaction. The returned results contain, for each
+// vote, if it has been stored or the reason why it was rejected. As in
+// AddVote, the votes already stored are not stored twice.
+func (va *VotesAggregator) AddVotes(processID uint64,
+	votes []types.VotePackage) ([]types.VoteResult, error) {
+	process, err := va.db.ReadProcessByID(processID)
+	if err != nil {
+		return nil, err
+	}
+	if process.Status != types.ProcessStatusOn {
+		return nil, fmt.Errorf("process ResPubStartBlock (%d) reached, %w",
+			process.ResPubStartBlock, ErrVotingClosed)
+	}
+	if err := va.checkCircuitCapacity(process); err != nil {
+		return nil, err
+	}
+
+	results := make([]types.VoteResult, len(votes))
+	// repeated contains the position of the first occurrence of the votes
+	// sent more than once in the batch
+	repeated := make(map[int]int)
+	first := make(map[string]int)
+	var pending []int
+	for i := 0; i < len(votes); i++ {
+		hash, err := votes[i].Hash()
+		if err != nil {
+			results[i] = types.VoteResult{Code: types.VoteErrInvalidPackage,
+				Error: err.Error()}
+			continue
+		}
+		results[i].VotePackageHash = hash
+		if j, ok := first[string(hash)]; ok {
+			repeated[i] = j
+			continue
+		}
+		first[string(hash)] = i
+		stored, err := va.db.HasVotePackage(processID, hash)
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			results[i].Stored = true
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	// verify the signatures & MerkleProofs in the verifier workers
+	pendingVotes := make([]*types.VotePackage, len(pending))
+	pendingHashes := make([][]byte, len(pending))
+	for k, i := range pending {
+		pendingVotes[k] = &votes[i]
+		pendingHashes[k] = results[i].VotePackageHash
+	}
+	verified, err := va.verifier.verifyVotes(process, pendingVotes, pendingHashes)
+	if err != nil {
+		return nil, err
+	}
+	for k, i := range pending {
+		if verified[k].err != nil {
+			results[i].Code = verified[k].code
+			results[i].Error = verified[k].err.Error()
+		}
+	}
+
+	// store the valid votes in the SQL DB for the given CensusRoot
+	var valid []int
+	var validVotes []types.VotePackage
+	for _, i := range pending {
+		if results[i].Code == "" {
+			valid = append(valid, i)
+			validVotes = append(validVotes, votes[i])
+		}
+	}
+	if len(validVotes) > 0 {
+		errs, err := va.db.StoreVotePackages(processID, validVotes)
+		if err != nil {
+			return nil, err
+		}
+		for k, i := range valid {
+			switch {
+			case errs[k] == nil:
+				results[i].Stored = true
+			case errors.Is(errs[k], db.ErrVoteAlreadyStored):
+				results[i].Code = types.VoteErrAlreadyStored
+				results[i].Error = errs[k].Error()
+			default:
+				results[i].Code = types.VoteErrStorage
+				results[i].Error = errs[k].Error()
+			}
+		}
+	}
+
+	for i, j := range repeated {
+		results[i] = results[j]
+	}
+	log.Debugw("votes batch added", "processID", processID,
+		"votes", len(votes), "valid", len(validVotes))
+	return results, nil
+}
+
+// VoteStatus returns the status of the vote of the given PublicKey in the
+// given processID. If the VotesAggregator is configured with VoteStatusAuth, a
+// signature by the PublicKey of the message types.HashVoteStatusRequest is
+// required, with a timestamp within the VoteStatusRequestTTL.
+func (va *VotesAggregator) VoteStatus(processID uint64, pubK *babyjub.PublicKey,
+	sig *babyjub.SignatureComp, timestamp uint64) (*types.VoteStatus, error) {
+	if _, err := va.db.ReadProcessByID(processID); err != nil {
+		return nil, err
+	}
+	if va.voteStatusAuth && sig == nil {
+		return nil, ErrSignatureRequired
+	}
+	if sig != nil {
+		age := time.Since(time.Unix(int64(timestamp), 0))
+		if age > va.voteStatusRequestTTL || age < -va.voteStatusRequestTTL {
+			return nil, fmt.Errorf("%w, timestamp: %d", ErrVoteStatusRequestExpired,
+				timestamp)
+		}
+		err := types.VerifyVoteStatusRequest(va.chainID, processID, pubK,
+			timestamp, *sig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vote, hash, insertedDatetime, err := va.db.ReadVoteStatusByPublicKey(processID, pubK)
+	if errors.Is(err, db.ErrVoteNotInDB) {
+		return &types.VoteStatus{Stored: false}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	voteHash, err := types.HashVote(va.chainID, processID, vote)
+	if err != nil {
+		return nil, err
+	}
+	return &types.VoteStatus{
+		Stored:           true,
+		InsertedDatetime: &insertedDatetime,
+		VoteHash:         voteHash,
+		VotePackageHash:  hash,
+	}, nil
+}
+
 // generateZKInputs will generate the zkInputs for the given processID
 func (va *VotesAggregator) generateZKInputs(processID uint64, nMaxVotes,
 	nLevels /* tmp */ int) (*types.ZKInputs, error) {
@@ -109,11 +714,16 @@ func (va *VotesAggregator) generateZKInputs(processID uint64, nMaxVotes,
 	if err != nil {
 		return nil, err
 	}
+	if len(votes) > nMaxVotes {
+		return nil, fmt.Errorf("ProcessID: %d, %w (%d), number of votes: %d",
+			processID, ErrTooManyVotes, nMaxVotes, len(votes))
+	}
 	r := big.NewInt(0)
 	for i := 0; i < len(votes); i++ {
 		voteBI := arbo.BytesToBigInt(votes[i].Vote)
 		if voteBI.Cmp(big.NewInt(1)) == 1 { // voteBI > 1:
-			return nil, fmt.Errorf("invalid vote value") // TODO better error handling
+			return nil, fmt.Errorf("ProcessID: %d, %w, index: %d",
+				processID, ErrInvalidVoteValue, i)
 		}
 		r = new(big.Int).Add(r, new(big.Int).Mul(voteBI, votes[i].CensusProof.Weight))
 		// TODO ensure that Weight does not overflow the field
@@ -140,8 +750,7 @@ func (va *VotesAggregator) generateZKInputs(processID uint64, nMaxVotes,
 		}
 
 		// prepare the receipt data with the index & pubK
-		key := types.Uint64ToIndex(votes[i].CensusProof.Index)
-		key = key[:int(math.Ceil(float64(nLevels)/8))] //nolint:gomnd
+		key := types.ReceiptKey(votes[i].CensusProof.Index, nLevels)
 		receiptsKeys = append(receiptsKeys, key)
 		pubKHashBytes, err := types.HashPubKBytes(
 			votes[i].CensusProof.PublicKey,
@@ -155,8 +764,13 @@ func (va *VotesAggregator) generateZKInputs(processID uint64, nMaxVotes,
 	z.NVotes = big.NewInt(int64(len(votes)))
 	z.WithReceipts = big.NewInt(1)
 
-	// compute the z.ReceiptsRoot & zk.ReceiptsSiblings
-	err = z.ComputeReceipts(processID, receiptsKeys, receiptsValues)
+	// compute the z.ReceiptsRoot & zk.ReceiptsSiblings, keeping the
+	// receipts tree of the process, discarding any previous one
+	if err = va.resetReceiptsTree(processID); err != nil {
+		return nil, err
+	}
+	err = z.ComputeReceipts(va.receiptsTreeDB(processID), receiptsKeys,
+		receiptsValues)
 	if err != nil {
 		return nil, err
 	}
@@ -164,8 +778,58 @@ func (va *VotesAggregator) generateZKInputs(processID uint64, nMaxVotes,
 	return z, nil
 }
 
+// checkProofAttempts checks the previous proof attempts (sorted from the last
+// one) of the given process, expiring the last attempt if it has reached the
+// proofTimeout. Returns an error if a new attempt can not be done yet.
+func (va *VotesAggregator) checkProofAttempts(process *types.Process,
+	attempts []types.ProofInDB) error {
+	if len(attempts) == 0 {
+		return nil
+	}
+	last := &attempts[0]
+	if va.proofExpired(last) {
+		err := va.db.SetProofError(process.ID, last.ProofID, last.Prover,
+			[]byte{}, []byte{}, ErrProofTimeout.Error())
+		if err != nil {
+			return err
+		}
+		last.Error = ErrProofTimeout.Error()
+		last.ProofAddedDatetime = time.Now()
+	}
+	if last.Error == "" {
+		return nil
+	}
+
+	if len(attempts) >= va.maxProofAttempts {
+		if process.Status != types.ProcessStatusProofFailed {
+			err := va.db.UpdateProcessStatus(process.ID,
+				types.ProcessStatusProofFailed)
+			if err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("%w, ProcessID: %d, attempts: %d, last error: %s",
+			ErrMaxProofAttempts, process.ID, len(attempts), last.Error)
+	}
+	// exponential backoff since the last failure
+	wait := va.retryBackoff << (len(attempts) - 1)
+	if remaining := wait - time.Since(last.ProofAddedDatetime); remaining > 0 {
+		return fmt.Errorf("%w, ProcessID: %d, retry in %s",
+			ErrProofRetryBackoff, process.ID, remaining.Round(time.Second))
+	}
+	return nil
+}
+
 // GenerateProof triggers proof generation through the prover client
 func (va *VotesAggregator) GenerateProof(processID uint64) error {
+	return va.generateProof(processID, nil)
+}
+
+// generateProof triggers proof generation through the prover client. If
+// hasCapacity is not nil, it is called once the process is ready to be
+// proven, and the proof is only dispatched when it returns true.
+func (va *VotesAggregator) generateProof(processID uint64,
+	hasCapacity func() bool) error {
 	// check that process is ready to generate proof
 	// (ResPubStartBlock >= currentEthBlock) if not ready,
 	// return error explaining
@@ -178,77 +842,310 @@ func (va *VotesAggregator) GenerateProof(processID uint64) error {
 		return err
 	}
 
-	if process.ResPubStartBlock < lastSyncBlockNum {
-		return fmt.Errorf("resPubStartBlock not reached yet."+
-			" ResPubStartBlock: %d, LastSyncBlock: %d",
-			process.ResPubStartBlock, lastSyncBlockNum)
+	if lastSyncBlockNum < process.ResPubStartBlock {
+		return fmt.Errorf("%w. ResPubStartBlock: %d, LastSyncBlock: %d",
+			ErrResPubStartBlockNotReached, process.ResPubStartBlock,
+			lastSyncBlockNum)
 	}
-
-	// TODO check if there exists already a proof in db for the processID.
-	// if so, check if time since insertedDatetime is bigger than T (eg. 10
-	// minutes), if so, remove it and continue this function. If not,
-	// return error saying that proof is still not ready
-	_, err = va.db.GetProofByProcessID(processID)
-	if err == nil {
-		// proof exists in db
-		// TODO check if time is ok
-
-		// return nil, as proof is already ready
-		return nil
+	if err := va.checkCircuitCapacity(process); err != nil {
+		return err
 	}
+	// do not spend prover time in a result that would be rejected by
+	// the SmartContract
+	if err := va.checkQuorum(process); err != nil {
+		return err
+	}
+
+	attempts, err := va.db.GetProofsByProcessID(processID)
 	if err != nil {
-		if !strings.Contains(err.Error(), db.ErrProofNotInDB) {
-			return err
-		}
+		return err
+	}
+	if err := va.checkProofAttempts(process, attempts); err != nil {
+		return err
+	}
+	if len(attempts) > 0 && attempts[0].Error == "" {
+		// the proof is already generated or being generated
+		return nil
 	}
 
 	// if this line is reached, means that the proof needs to be generated
 
-	// TODO WIP initially support only for census of 100 voters
-	zki, err := va.generateZKInputs(processID, 128, 7)
+	if hasCapacity != nil && !hasCapacity() {
+		return fmt.Errorf("%w with capacity for a new proof, ProcessID: %d",
+			prover.ErrNoProverAvailable, processID)
+	}
+
+	zki, err := va.generateZKInputs(processID, va.circuit.NMaxVotes,
+		va.circuit.NLevels)
 	if err != nil {
 		return err
 	}
 
-	proofID, err := va.prover.GenProof(processID, zki)
+	// retry the failed attempts in a different prover when possible
+	avoidProver := ""
+	if len(attempts) > 0 {
+		avoidProver = attempts[0].Prover
+	}
+	proverURL, proofID, err := va.provers.GenProof(processID, zki, avoidProver)
 	if err != nil {
 		return err
 	}
 
-	// store proofID in db for the processID
-	err = va.db.StoreProofID(processID, proofID)
+	// store proofID in db for the processID, together with the prover
+	// that holds it
+	err = va.db.StoreProofID(processID, proofID, proverURL)
 	if err != nil {
 		return err
 	}
-	return nil
+	return va.db.UpdateProcessStatus(processID,
+		types.ProcessStatusProofGenerating)
 }
 
-// GetProof returns (if has been computed) the proof for the processID
+// GetProof returns (if has been computed) the proof of the last proof attempt
+// for the processID. The proof retrieved from the prover is verified before
+// storing it, if it is not valid, it is stored as rejected and an error is
+// returned.
 func (va *VotesAggregator) GetProof(processID uint64) (*types.ProofInDB, error) {
 	// first check if proof is already stored in the db
-	proofInDB, err := va.db.GetProofByProcessID(processID)
+	attempts, err := va.db.GetProofsByProcessID(processID)
 	if err != nil {
 		return nil, err
 	}
+	if len(attempts) == 0 {
+		return nil, fmt.Errorf("%w, ProcessID: %d", db.ErrProofNotInDB, processID)
+	}
+	proofInDB := &attempts[0]
+	if proofInDB.Error != "" {
+		return nil, fmt.Errorf("ProcessID: %d, ProofID: %d, %w: %s",
+			processID, proofInDB.ProofID, ErrProofFailed, proofInDB.Error)
+	}
 
 	// if proof does not exist yet in the db, try getting it from the
 	// prover-server
 	if bytes.Equal(proofInDB.Proof, []byte{}) ||
 		bytes.Equal(proofInDB.PublicInputs, []byte{}) {
-		proofBytes, publicInputsBytes, err :=
-			va.prover.GetProof(proofInDB.ProofID)
+		proofBytes, publicInputsBytes, err := va.provers.GetProof(
+			proofInDB.Prover, proofInDB.ProofID)
 		if err != nil {
 			return nil, err
 		}
-		proofInDB.Proof = proofBytes
-		proofInDB.PublicInputs = publicInputsBytes
 
-		// store the retreived proofBytes & publicInputsBytes
-		err = va.db.AddProofToProofID(processID, proofInDB.ProofID,
-			proofBytes, publicInputsBytes)
-		if err != nil {
+		if err := va.storeProof(processID, proofInDB, proofBytes,
+			publicInputsBytes); err != nil {
 			return nil, err
 		}
+		// the proof is already stored, the prover can remove it
+		err = va.provers.Release(proofInDB.Prover, proofInDB.ProofID)
+		if err != nil {
+			log.Warnw("can not release proof", "processID", processID,
+				"proofID", proofInDB.ProofID, "prover", proofInDB.Prover,
+				"err", err)
+		}
 	}
 	return proofInDB, nil
 }
+
+// storeProof verifies the given proof & publicInputs of the given proof
+// attempt, and stores them. If the proof is not valid, it is stored as
+// rejected and an error is returned.
+func (va *VotesAggregator) storeProof(processID uint64, proofInDB *types.ProofInDB,
+	proofBytes, publicInputsBytes []byte) error {
+	if err := va.verifyProof(processID, proofBytes,
+		publicInputsBytes); err != nil {
+		errDB := va.db.SetProofError(processID, proofInDB.ProofID,
+			proofInDB.Prover, proofBytes, publicInputsBytes, err.Error())
+		if errDB != nil {
+			return errDB
+		}
+		return fmt.Errorf("ProcessID: %d, ProofID: %d, proof"+
+			" rejected: %w", processID, proofInDB.ProofID, err)
+	}
+	proofInDB.Proof = proofBytes
+	proofInDB.PublicInputs = publicInputsBytes
+
+	// store the retreived proofBytes & publicInputsBytes
+	err := va.db.AddProofToProofID(processID, proofInDB.ProofID,
+		proofInDB.Prover, proofBytes, publicInputsBytes)
+	if err != nil {
+		return err
+	}
+	return va.db.UpdateProcessStatus(processID,
+		types.ProcessStatusProofGenerated)
+}
+
+// ProofCallback stores the proof sent by a prover-server in a proof
+// completion callback for the given processID, after checking the callback
+// signature. Only the proof of the last proof attempt is accepted, from the
+// prover that was requested to generate it, and while the callback
+// timestamp is in the prover.AuthMaxClockSkew.
+func (va *VotesAggregator) ProofCallback(processID uint64, body []byte,
+	signature string) error {
+	if len(va.callbackSecret) == 0 {
+		return ErrCallbacksDisabled
+	}
+	if !prover.VerifyCallback(va.callbackSecret, body, signature) {
+		return ErrInvalidCallbackSignature
+	}
+	var callback prover.Callback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return err
+	}
+	if callback.ProcessID != processID {
+		return fmt.Errorf("%w, signed for ProcessID: %d", ErrInvalidCallback,
+			callback.ProcessID)
+	}
+	if callback.Expired() {
+		return fmt.Errorf("%w, timestamp %d out of range", ErrInvalidCallback,
+			callback.Timestamp)
+	}
+
+	attempts, err := va.db.GetProofsByProcessID(processID)
+	if err != nil {
+		return err
+	}
+	if len(attempts) == 0 {
+		return fmt.Errorf("%w, ProcessID: %d", db.ErrProofNotInDB, processID)
+	}
+	proofInDB := &attempts[0]
+	if proofInDB.Prover != callback.Prover {
+		return fmt.Errorf("%w, ProcessID: %d, the last proof attempt was not"+
+			" requested to prover %q", ErrInvalidCallback, processID,
+			callback.Prover)
+	}
+	if proofInDB.ProofID != callback.ID {
+		return fmt.Errorf("ProcessID: %d, ProofID: %d is not the last"+
+			" proof attempt", processID, callback.ID)
+	}
+	if proofInDB.Error != "" || len(proofInDB.Proof) != 0 {
+		// the proof attempt has already been resolved
+		return nil
+	}
+
+	err = va.storeProof(processID, proofInDB, callback.Proof,
+		callback.PublicInputs)
+	if errors.Is(err, prover.ErrInvalidProof) {
+		// retry the proof generation
+		errDB := va.db.UpdateProcessStatus(processID,
+			types.ProcessStatusFrozen)
+		if errDB != nil {
+			return errDB
+		}
+	}
+	return err
+}
+
+// verifyProof checks that the public inputs of the given proof match the
+// process data, and verifies the proof with the VerificationKey
+func (va *VotesAggregator) verifyProof(processID uint64, proofBytes,
+	publicInputsBytes []byte) error {
+	proof, err := types.ParseProof(proofBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %s", prover.ErrInvalidProof, err)
+	}
+	publicInputs, err := types.ParsePublicInputs(publicInputsBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %s", prover.ErrInvalidProof, err)
+	}
+
+	// expected public inputs, from the data used to build the ZKInputs
+	process, err := va.db.ReadProcessByID(processID)
+	if err != nil {
+		return err
+	}
+	nVotes, _, result, err := va.db.GetVotesTally(processID)
+	if err != nil {
+		return err
+	}
+	z := &types.ZKInputs{
+		ChainID:    new(big.Int).SetUint64(va.chainID),
+		ProcessID:  new(big.Int).SetUint64(processID),
+		CensusRoot: arbo.BytesToBigInt(process.CensusRoot),
+		NVotes:     new(big.Int).SetUint64(nVotes),
+		Result:     result,
+	}
+	if err := z.CheckPublicInputs(publicInputs); err != nil {
+		return fmt.Errorf("%w: %s", prover.ErrInvalidProof, err)
+	}
+
+	return va.verificationKey.Verify(proof, publicInputs)
+}
+
+// receiptsTreeDB returns the database where the receipts tree of the given
+// processID is stored
+func (va *VotesAggregator) receiptsTreeDB(processID uint64) kvdb.Database {
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint64(prefix, processID)
+	return prefixeddb.NewPrefixedDatabase(va.receiptsDB, prefix)
+}
+
+// resetReceiptsTree removes the stored receipts tree of the given processID
+func (va *VotesAggregator) resetReceiptsTree(processID uint64) error {
+	database := va.receiptsTreeDB(processID)
+	var keys [][]byte
+	err := database.Iterate(nil, func(k, _ []byte) bool {
+		keys = append(keys, append([]byte{}, k...))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	wTx := database.WriteTx()
+	defer wTx.Discard()
+	for i := 0; i < len(keys); i++ {
+		if err := wTx.Delete(keys[i]); err != nil {
+			return err
+		}
+	}
+	return wTx.Commit()
+}
+
+// GetReceipt returns the proof of inclusion of the vote of the given PublicKey
+// in the receipts tree of the given processID, against the ReceiptsRoot
+// published in the SmartContract
+func (va *VotesAggregator) GetReceipt(processID uint64, pubK *babyjub.PublicKey) (
+	*types.ReceiptProof, error) {
+	result, err := va.db.ReadResultByProcessID(processID)
+	if err != nil {
+		return nil, err
+	}
+	vote, err := va.db.ReadVotePackageByPublicKey(processID, pubK)
+	if err != nil {
+		return nil, err
+	}
+
+	receiptsTree, err := arbo.NewTree(arbo.Config{
+		Database:     va.receiptsTreeDB(processID),
+		MaxLevels:    va.circuit.NLevels,
+		HashFunction: arbo.HashFunctionPoseidon,
+	})
+	if err != nil {
+		return nil, err
+	}
+	root, err := receiptsTree.Root()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, result.ReceiptsRoot) {
+		return nil, fmt.Errorf("ProcessID: %d, stored receipts tree root (%x)"+
+			" does not match the published ReceiptsRoot (%x)", processID,
+			root, []byte(result.ReceiptsRoot))
+	}
+
+	key := types.ReceiptKey(vote.CensusProof.Index, va.circuit.NLevels)
+	_, _, siblings, existence, err := receiptsTree.GenProof(key)
+	if err != nil {
+		return nil, err
+	}
+	if !existence {
+		return nil, fmt.Errorf("ProcessID: %d, %w, index: %d", processID,
+			ErrReceiptNotFound, vote.CensusProof.Index)
+	}
+
+	return &types.ReceiptProof{
+		Index:        vote.CensusProof.Index,
+		PublicKey:    vote.CensusProof.PublicKey,
+		Weight:       vote.CensusProof.Weight,
+		ReceiptsRoot: result.ReceiptsRoot,
+		MerkleProof:  siblings,
+	}, nil
+}
@@ -3,18 +3,36 @@ package votesaggregator
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aragon/ovote-node/db"
+	"github.com/aragon/ovote-node/prover"
+	"github.com/aragon/ovote-node/prover/provertest"
 	"github.com/aragon/ovote-node/test"
 	"github.com/aragon/ovote-node/types"
 	qt "github.com/frankban/quicktest"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/vocdoni/arbo"
+	kvdb "go.vocdoni.io/dvote/db"
+	"go.vocdoni.io/dvote/db/pebbledb"
 )
 
+// testVerificationKey returns a random VerificationKey
+func testVerificationKey(c *qt.C) *prover.VerificationKey {
+	vk, err := prover.ParseVerificationKey(test.GenGroth16(c, nil).VerificationKey)
+	c.Assert(err, qt.IsNil)
+	return vk
+}
+
 func baseTestVotesAggregator(c *qt.C, chainID, processID uint64, nVotes, ratio int) (
 	*VotesAggregator, []types.VotePackage) {
 	sqlDB, err := sql.Open("sqlite3", filepath.Join(c.TempDir(), "testdb.sqlite3"))
@@ -24,7 +42,16 @@ func baseTestVotesAggregator(c *qt.C, chainID, processID uint64, nVotes, ratio i
 	err = sqlite.Migrate()
 	c.Assert(err, qt.IsNil)
 
-	va, err := New(sqlite, chainID, nil)
+	receiptsDB, err := pebbledb.New(kvdb.Options{Path: c.TempDir()})
+	c.Assert(err, qt.IsNil)
+	va, err := New(Options{
+		SQLite:     sqlite,
+		ReceiptsDB: receiptsDB,
+		ChainID:    chainID,
+		Circuit:    types.ZKCircuitMeta{NMaxVotes: 128, NLevels: 7},
+		// replaced by the tests that generate proofs
+		VerificationKey: testVerificationKey(c),
+	})
 	c.Assert(err, qt.IsNil)
 
 	// prepare the census
@@ -67,10 +94,13 @@ func TestStoreAndReadVotes(t *testing.T) {
 		c.Assert(err, qt.IsNil)
 	}
 
-	// try to store a vote with already stored index
+	// sending again an already stored vote succeeds without storing it
+	// twice
 	err = va.AddVote(processID, votes[0])
-	c.Assert(err, qt.Not(qt.IsNil))
-	c.Assert(err.Error(), qt.Equals, "UNIQUE constraint failed: votepackages.indx")
+	c.Assert(err, qt.IsNil)
+	nVotesInDB, _, _, err := va.db.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotesInDB, qt.Equals, uint64(nVotes))
 
 	// try to store invalid merkleproofs
 	votes[0].CensusProof.Index = 11
@@ -83,6 +113,597 @@ func TestStoreAndReadVotes(t *testing.T) {
 	c.Assert(err.Error(), qt.Equals, "signature verification failed")
 }
 
+func TestProcessInfo(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.hideTally = true
+
+	info, err := va.ProcessInfo(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.NVotes, qt.Equals, uint64(0))
+	c.Assert(info.MinParticipationReached, qt.IsFalse)
+
+	// add 5 votes, all of them positive
+	for i := 0; i < 5; i++ {
+		err = va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+
+	info, err = va.ProcessInfo(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.NVotes, qt.Equals, uint64(5))
+	c.Assert(info.Weight.Int64(), qt.Equals, int64(5))
+	c.Assert(info.Participation, qt.Equals, float64(50))
+	c.Assert(info.MinParticipationReached, qt.IsTrue)
+	// the tally is hidden while the process is accepting votes
+	c.Assert(info.Result, qt.IsNil)
+	c.Assert(info.MinPositiveVotesReached, qt.IsNil)
+
+	err = va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	c.Assert(err, qt.IsNil)
+
+	info, err = va.ProcessInfo(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Result.Int64(), qt.Equals, int64(5))
+	c.Assert(*info.MinPositiveVotesReached, qt.IsTrue)
+}
+
+// mockProverStatus is the /status response of an idle prover-server mock
+const mockProverStatus = `{"status": "ok", "workers": 1}`
+
+func TestQuorum(t *testing.T) {
+	c := qt.New(t)
+
+	// mock of the prover-server, which accepts any proof generation
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/status" {
+				_, _ = w.Write([]byte(mockProverStatus))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id": 42}`))
+		}))
+	defer ts.Close()
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.provers = prover.NewPool(prover.NewClient(ts.URL))
+
+	// add a single vote, which does not reach the MinParticipation (20%)
+	err := va.AddVote(processID, votes[0])
+	c.Assert(err, qt.IsNil)
+
+	// reach the ResPubStartBlock and freeze the process
+	err = va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	err = va.GenerateProof(processID)
+	c.Assert(errors.Is(err, ErrQuorumNotReached), qt.IsTrue)
+	info, err := va.ProcessInfo(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Status, qt.Equals, types.ProcessStatusQuorumNotReached)
+	c.Assert(info.MinParticipationReached, qt.IsFalse)
+
+	// the proof is not generated
+	_, err = va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// with ProveWithoutQuorum, the proof is generated anyway
+	va.proveWithoutQuorum = true
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	proof, err := va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.ProofID, qt.Equals, uint64(42))
+	info, err = va.ProcessInfo(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Status, qt.Equals, types.ProcessStatusProofGenerating)
+}
+
+func TestQuorumWithoutProverCapacity(t *testing.T) {
+	c := qt.New(t)
+
+	// mock of a prover-server with all its workers busy
+	statusRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/status" {
+				statusRequests++
+				_, _ = w.Write([]byte(`{"status": "ok", "workers": 1, ` +
+					`"busyWorkers": 1}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"id": 42}`))
+		}))
+	defer ts.Close()
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.provers = prover.NewPool(prover.NewClient(ts.URL))
+
+	err := va.AddVote(processID, votes[0])
+	c.Assert(err, qt.IsNil)
+	err = va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	// the quorum is checked without querying the provers
+	hasCapacity := va.proversCapacity()
+	err = va.generateProof(processID, hasCapacity)
+	c.Assert(errors.Is(err, ErrQuorumNotReached), qt.IsTrue)
+	process, err := va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(process.Status, qt.Equals, types.ProcessStatusQuorumNotReached)
+	c.Assert(statusRequests, qt.Equals, 0)
+
+	// the proof is not dispatched while the provers are busy, and their
+	// capacity is only queried once
+	va.proveWithoutQuorum = true
+	err = va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	c.Assert(err, qt.IsNil)
+	for i := 0; i < 2; i++ {
+		err = va.generateProof(processID, hasCapacity)
+		c.Assert(errors.Is(err, prover.ErrNoProverAvailable), qt.IsTrue)
+	}
+	c.Assert(statusRequests, qt.Equals, 1)
+	_, err = va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+// mockProverServer serves the given proof & public inputs for any proofID
+func mockProverServer(proof, publicInputs *[]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if filepath.Base(r.URL.Path) == "public" {
+				_, _ = w.Write(*publicInputs)
+				return
+			}
+			_, _ = w.Write(*proof)
+		}))
+}
+
+// testProofSetup prepares a VotesAggregator with a process with 6 votes, and
+// returns a valid Groth16 proof for the given result
+func testProofSetup(c *qt.C, result int64) (*VotesAggregator, test.Groth16) {
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	for i := 0; i < 6; i++ {
+		err := va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+	process, err := va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+
+	publicInputs := []*big.Int{big.NewInt(int64(chainID)),
+		big.NewInt(int64(processID)), arbo.BytesToBigInt(process.CensusRoot),
+		big.NewInt(42), big.NewInt(6), big.NewInt(result), big.NewInt(1)}
+	g := test.GenGroth16(c, publicInputs)
+	va.verificationKey, err = prover.ParseVerificationKey(g.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	return va, g
+}
+
+func testGetProof(c *qt.C, result int64) (*VotesAggregator, *types.ProofInDB, error) {
+	processID := uint64(123)
+	va, g := testProofSetup(c, result)
+	ts := mockProverServer(&g.Proof, &g.PublicInputs)
+	c.Cleanup(ts.Close)
+	va.provers = prover.NewPool(prover.NewClient(ts.URL))
+
+	err := va.db.StoreProofID(processID, 42, ts.URL)
+	c.Assert(err, qt.IsNil)
+	proof, err := va.GetProof(processID)
+	return va, proof, err
+}
+
+func TestGetProof(t *testing.T) {
+	c := qt.New(t)
+
+	// valid proof
+	va, proof, err := testGetProof(c, 6)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.ProofID, qt.Equals, uint64(42))
+	info, err := va.ProcessInfo(123)
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Status, qt.Equals, types.ProcessStatusProofGenerated)
+
+	// valid proof, but for a different result than the votes stored
+	va, _, err = testGetProof(c, 5)
+	c.Assert(errors.Is(err, prover.ErrInvalidProof), qt.IsTrue)
+	c.Assert(err.Error(), qt.Equals, "ProcessID: 123, ProofID: 42, proof"+
+		" rejected: invalid proof: public input result mismatch, expected: 6,"+
+		" got: 5")
+	// the rejection is recorded
+	proofInDB, err := va.db.GetProofByProcessID(123)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofInDB.Error, qt.Equals, "invalid proof: public input"+
+		" result mismatch, expected: 6, got: 5")
+	_, err = va.GetProof(123)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// proof which does not verify with the verification key
+	va, _, err = testGetProof(c, 6)
+	c.Assert(err, qt.IsNil)
+	other := test.GenGroth16(c, []*big.Int{big.NewInt(1), big.NewInt(2),
+		big.NewInt(3), big.NewInt(4), big.NewInt(5), big.NewInt(6),
+		big.NewInt(7)})
+	va.verificationKey, err = prover.ParseVerificationKey(other.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	proofInDB, err = va.db.GetProofByProcessID(123)
+	c.Assert(err, qt.IsNil)
+	err = va.verifyProof(123, proofInDB.Proof, proofInDB.PublicInputs)
+	c.Assert(err, qt.Equals, prover.ErrInvalidProof)
+}
+
+func TestProofCallback(t *testing.T) {
+	c := qt.New(t)
+
+	processID := uint64(123)
+	va, g := testProofSetup(c, 6)
+	err := va.db.StoreProofID(processID, 42, "prover0")
+	c.Assert(err, qt.IsNil)
+	err = va.db.UpdateProcessStatus(processID,
+		types.ProcessStatusProofGenerating)
+	c.Assert(err, qt.IsNil)
+
+	callback := prover.Callback{ProcessID: processID, Prover: "prover0", ID: 42,
+		Timestamp: time.Now().Unix(), Proof: g.Proof,
+		PublicInputs: g.PublicInputs}
+	body, err := json.Marshal(callback)
+	c.Assert(err, qt.IsNil)
+	secret := []byte("secret")
+
+	// callbacks not enabled
+	err = va.ProofCallback(processID, body, prover.SignCallback(secret, body))
+	c.Assert(err, qt.Equals, ErrCallbacksDisabled)
+
+	// invalid signature
+	va.callbackSecret = secret
+	err = va.ProofCallback(processID, body,
+		prover.SignCallback([]byte("other"), body))
+	c.Assert(err, qt.Equals, ErrInvalidCallbackSignature)
+
+	// callbacks that do not match the last proof attempt
+	sendOther := func(modify func(cb *prover.Callback)) error {
+		other := callback
+		modify(&other)
+		otherBody, err := json.Marshal(other)
+		c.Assert(err, qt.IsNil)
+		return va.ProofCallback(processID, otherBody,
+			prover.SignCallback(secret, otherBody))
+	}
+	err = sendOther(func(cb *prover.Callback) {
+		cb.ID = 41
+	})
+	c.Assert(err, qt.ErrorMatches, ".*is not the last proof attempt")
+	// the proof ids of another prover can be the same
+	err = sendOther(func(cb *prover.Callback) {
+		cb.Prover = "prover1"
+	})
+	c.Assert(errors.Is(err, ErrInvalidCallback), qt.IsTrue)
+	// a callback signed for another process can not be replayed
+	err = sendOther(func(cb *prover.Callback) {
+		cb.ProcessID = processID + 1
+	})
+	c.Assert(errors.Is(err, ErrInvalidCallback), qt.IsTrue)
+	// nor later
+	err = sendOther(func(cb *prover.Callback) {
+		cb.Timestamp = time.Now().Add(-time.Hour).Unix()
+	})
+	c.Assert(errors.Is(err, ErrInvalidCallback), qt.IsTrue)
+
+	// the proof is stored, without polling the prover
+	err = va.ProofCallback(processID, body, prover.SignCallback(secret, body))
+	c.Assert(err, qt.IsNil)
+	proofInDB, err := va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proofInDB.Proof, qt.DeepEquals, g.Proof)
+	c.Assert(proofInDB.PublicInputs, qt.DeepEquals, g.PublicInputs)
+	process, err := va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(process.Status, qt.Equals, types.ProcessStatusProofGenerated)
+
+	// a repeated callback is ignored
+	err = va.ProofCallback(processID, body, prover.SignCallback(secret, body))
+	c.Assert(err, qt.IsNil)
+
+	// an invalid proof is rejected, and the process is set back to Frozen
+	va, g = testProofSetup(c, 5)
+	va.callbackSecret = secret
+	err = va.db.StoreProofID(processID, 42, "prover0")
+	c.Assert(err, qt.IsNil)
+	callback.Proof = g.Proof
+	callback.PublicInputs = g.PublicInputs
+	body, err = json.Marshal(callback)
+	c.Assert(err, qt.IsNil)
+	err = va.ProofCallback(processID, body, prover.SignCallback(secret, body))
+	c.Assert(errors.Is(err, prover.ErrInvalidProof), qt.IsTrue)
+	process, err = va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(process.Status, qt.Equals, types.ProcessStatusFrozen)
+}
+
+// mockProverGenProof returns a mock of the prover-server which assigns
+// consecutive ids starting at firstID, and has no proof ready
+func mockProverGenProof(firstID uint64) *httptest.Server {
+	id := firstID
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/status" {
+				_, _ = w.Write([]byte(mockProverStatus))
+				return
+			}
+			if r.Method == http.MethodPost {
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"id": %d}`, id)))
+				id++
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message": "proof not ready"}`))
+		}))
+}
+
+func TestProofRetry(t *testing.T) {
+	c := qt.New(t)
+
+	mainProver := mockProverGenProof(1)
+	defer mainProver.Close()
+	fallbackProver := mockProverGenProof(101)
+	defer fallbackProver.Close()
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.provers = prover.NewPool(prover.NewClient(mainProver.URL),
+		prover.NewClient(fallbackProver.URL))
+	va.retryBackoff = 0
+	for i := 0; i < 6; i++ {
+		err := va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+	err := va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	checkStatus := func(status types.ProcessStatus) {
+		process, err := va.db.ReadProcessByID(processID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(process.Status, qt.Equals, status)
+	}
+
+	// first attempt, in the main prover
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusProofGenerating)
+
+	// while the attempt is pending, no new attempt is done
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	err = va.checkProofGeneration(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusProofGenerating)
+	attempts, err := va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 1)
+
+	// the attempt expires, and the next attempt goes to a different
+	// prover
+	va.proofTimeout = time.Nanosecond
+	err = va.checkProofGeneration(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusFrozen)
+	va.proofTimeout = time.Hour
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+
+	attempts, err = va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 2)
+	c.Assert(attempts[0].ProofID, qt.Equals, uint64(101))
+	c.Assert(attempts[0].Prover, qt.Equals, fallbackProver.URL)
+	c.Assert(attempts[0].Error, qt.Equals, "")
+	c.Assert(attempts[1].ProofID, qt.Equals, uint64(1))
+	c.Assert(attempts[1].Error, qt.Equals, ErrProofTimeout.Error())
+
+	// after a failure, wait the backoff before retrying
+	va.retryBackoff = time.Hour
+	va.proofTimeout = time.Nanosecond
+	err = va.GenerateProof(processID)
+	c.Assert(errors.Is(err, ErrProofRetryBackoff), qt.IsTrue)
+
+	// third attempt, back in the main prover, as the fallback one failed
+	// the previous attempt
+	va.retryBackoff = 0
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	attempts, err = va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 3)
+	c.Assert(attempts[0].ProofID, qt.Equals, uint64(2))
+	c.Assert(attempts[0].Prover, qt.Equals, mainProver.URL)
+
+	// after the max attempts, the process proof generation fails
+	err = va.GenerateProof(processID)
+	c.Assert(errors.Is(err, ErrMaxProofAttempts), qt.IsTrue)
+	checkStatus(types.ProcessStatusProofFailed)
+	attempts, err = va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 3)
+	for i := 0; i < len(attempts); i++ {
+		c.Assert(attempts[i].Error, qt.Equals, ErrProofTimeout.Error())
+	}
+}
+
+// mockProverFailed returns a mock of the prover-server which assigns
+// consecutive ids starting at firstID, and fails all the proof generations
+func mockProverFailed(firstID uint64) *httptest.Server {
+	id := firstID
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/status":
+				_, _ = w.Write([]byte(mockProverStatus))
+			case r.Method == http.MethodPost:
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"id": %d}`, id)))
+				id++
+			case strings.HasSuffix(r.URL.Path, "/status"):
+				_, _ = w.Write([]byte(`{"status": "failed", "error": "witness"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"message": "proof generation failed"}`))
+			}
+		}))
+}
+
+func TestProofFailedRetry(t *testing.T) {
+	c := qt.New(t)
+
+	failingProver := mockProverFailed(1)
+	defer failingProver.Close()
+	fallbackProver := mockProverGenProof(101)
+	defer fallbackProver.Close()
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.provers = prover.NewPool(prover.NewClient(failingProver.URL),
+		prover.NewClient(fallbackProver.URL))
+	va.retryBackoff = 0
+	// the attempts never expire
+	va.proofTimeout = time.Hour
+	for i := 0; i < 6; i++ {
+		err := va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+	err := va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+
+	// the failed attempt is recorded, and the process is frozen again
+	err = va.checkProofGeneration(processID)
+	c.Assert(err, qt.IsNil)
+	process, err := va.db.ReadProcessByID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(process.Status, qt.Equals, types.ProcessStatusFrozen)
+	attempts, err := va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 1)
+	c.Assert(attempts[0].Error, qt.Matches, "proof generation failed.*witness")
+
+	// the retry goes to the other prover
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	attempts, err = va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 2)
+	c.Assert(attempts[0].Prover, qt.Equals, fallbackProver.URL)
+}
+
+func TestAddVotes(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+
+	// the first vote is already stored
+	err := va.AddVote(processID, votes[0])
+	c.Assert(err, qt.IsNil)
+
+	invalidSig := votes[1]
+	invalidSig.Vote = []byte("invalidvotecontent")
+	invalidMerkleProof := votes[2]
+	invalidMerkleProof.CensusProof.Index = 11
+	invalidPackage := votes[3]
+	invalidPackage.CensusProof.PublicKey = nil
+	batch := append([]types.VotePackage{invalidSig, invalidMerkleProof,
+		invalidPackage}, votes...)
+	// a vote repeated in the batch
+	batch = append(batch, votes[5])
+
+	results, err := va.AddVotes(processID, batch)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(results), qt.Equals, len(batch))
+	c.Assert(results[0].Stored, qt.IsFalse)
+	c.Assert(results[0].Code, qt.Equals, types.VoteErrInvalidSignature)
+	c.Assert(results[0].Error, qt.Equals, "signature verification failed")
+	c.Assert(results[1].Code, qt.Equals, types.VoteErrInvalidMerkleProof)
+	c.Assert(results[2].Code, qt.Equals, types.VoteErrInvalidPackage)
+	c.Assert(results[2].VotePackageHash, qt.IsNil)
+	for i := 3; i < len(batch); i++ {
+		c.Assert(results[i].Stored, qt.IsTrue, qt.Commentf("vote %d", i))
+		c.Assert(results[i].Code, qt.Equals, types.VoteErrorCode(""))
+		hash, err := batch[i].Hash()
+		c.Assert(err, qt.IsNil)
+		c.Assert([]byte(results[i].VotePackageHash), qt.DeepEquals, hash)
+	}
+	nVotesInDB, _, _, err := va.db.GetVotesTally(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nVotesInDB, qt.Equals, uint64(nVotes))
+
+	// sending again the batch does not store the votes twice
+	results, err = va.AddVotes(processID, votes)
+	c.Assert(err, qt.IsNil)
+	for i := 0; i < len(votes); i++ {
+		c.Assert(results[i].Stored, qt.IsTrue)
+	}
+
+	// once the process is frozen, the batch is rejected
+	err = va.db.UpdateProcessStatus(processID, types.ProcessStatusFrozen)
+	c.Assert(err, qt.IsNil)
+	_, err = va.AddVotes(processID, votes)
+	c.Assert(err, qt.ErrorMatches, "process ResPubStartBlock .* reached.*")
+}
+
+func TestCircuitCapacity(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 5
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+
+	// a circuit of 2 levels can only hold a census of 4 keys
+	va.circuit = types.ZKCircuitMeta{NMaxVotes: 8, NLevels: 2}
+	err := va.AddVote(processID, votes[0])
+	c.Assert(err, qt.ErrorMatches, ".*exceeds the circuit capacity.*")
+
+	va.circuit = types.ZKCircuitMeta{NMaxVotes: 8, NLevels: 3}
+	err = va.AddVote(processID, votes[0])
+	c.Assert(err, qt.IsNil)
+
+	_, err = New(Options{SQLite: va.db, ReceiptsDB: va.receiptsDB,
+		ChainID: chainID, Circuit: types.ZKCircuitMeta{NMaxVotes: 8},
+		VerificationKey: va.verificationKey})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// the proofs can not be accepted without verification
+	_, err = New(Options{SQLite: va.db, ReceiptsDB: va.receiptsDB,
+		ChainID: chainID, Circuit: va.circuit})
+	c.Assert(err, qt.ErrorMatches, "a VerificationKey is required.*")
+}
+
 func TestGenerateZKInputs(t *testing.T) {
 	c := qt.New(t)
 	testGenerateZKInputs(c, 3, 3, 1, 60)
@@ -116,3 +737,237 @@ func testGenerateZKInputs(c *qt.C, nMaxVotes, nLevels, nVotes, ratio int) {
 	err = ioutil.WriteFile(filename, s, 0600)
 	c.Assert(err, qt.IsNil)
 }
+
+func TestGetReceipt(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 10
+	nMaxVotes := 16
+	nLevels := 4
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+	va.circuit = types.ZKCircuitMeta{NMaxVotes: nMaxVotes, NLevels: nLevels}
+
+	var err error
+	for i := 0; i < len(votes); i++ {
+		err = va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+
+	// expect error, as the result has not been published yet
+	_, err = va.GetReceipt(processID, votes[0].CensusProof.PublicKey)
+	c.Assert(err, qt.ErrorMatches, db.ErrResultNotInDB.Error()+".*")
+
+	// generate the zkInputs twice, to check that the receipts tree is
+	// rebuilt when regenerating the zkInputs
+	_, err = va.generateZKInputs(processID, nMaxVotes, nLevels)
+	c.Assert(err, qt.IsNil)
+	zki, err := va.generateZKInputs(processID, nMaxVotes, nLevels)
+	c.Assert(err, qt.IsNil)
+
+	// simulate the result publication in the SmartContract
+	receiptsRoot := arbo.BigIntToBytes(arbo.HashFunctionPoseidon.Len(),
+		zki.ReceiptsRoot)
+	err = va.db.StoreResult(processID, receiptsRoot, zki.Result.Uint64(),
+		zki.NVotes.Uint64(), 30)
+	c.Assert(err, qt.IsNil)
+
+	for i := 0; i < len(votes); i++ {
+		receipt, err := va.GetReceipt(processID, votes[i].CensusProof.PublicKey)
+		c.Assert(err, qt.IsNil)
+		c.Assert(receipt.Index, qt.Equals, votes[i].CensusProof.Index)
+		c.Assert(receipt.Verify(receiptsRoot), qt.IsNil)
+	}
+
+	// a receipt does not verify against another root
+	receipt, err := va.GetReceipt(processID, votes[0].CensusProof.PublicKey)
+	c.Assert(err, qt.IsNil)
+	c.Assert(receipt.Verify(types.EmptyRoot), qt.Not(qt.IsNil))
+}
+
+func TestVoteStatus(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 4
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+
+	err := va.AddVote(processID, votes[0])
+	c.Assert(err, qt.IsNil)
+
+	status, err := va.VoteStatus(processID, votes[0].CensusProof.PublicKey, nil, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsTrue)
+	c.Assert(status.InsertedDatetime, qt.Not(qt.IsNil))
+	voteHash, err := types.HashVote(chainID, processID, votes[0].Vote)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.VoteHash.String(), qt.Equals, voteHash.String())
+	votePackageHash, err := votes[0].Hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert([]byte(status.VotePackageHash), qt.DeepEquals, votePackageHash)
+
+	status, err = va.VoteStatus(processID, votes[1].CensusProof.PublicKey, nil, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(status.Stored, qt.IsFalse)
+	c.Assert(status.VoteHash, qt.IsNil)
+	c.Assert(status.VotePackageHash, qt.IsNil)
+
+	// expect error for a process that does not exist
+	_, err = va.VoteStatus(processID+1, votes[0].CensusProof.PublicKey, nil, 0)
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// require the signature of the voter
+	va.voteStatusAuth = true
+	_, err = va.VoteStatus(processID, votes[0].CensusProof.PublicKey, nil, 0)
+	c.Assert(err, qt.ErrorMatches, "signature required.*")
+
+	timestamp := uint64(time.Now().Unix())
+	keys := test.GenUserKeys(1)
+	msg, err := types.HashVoteStatusRequest(chainID, processID,
+		votes[0].CensusProof.PublicKey, timestamp)
+	c.Assert(err, qt.IsNil)
+	// signature by a different key
+	sig := keys.PrivateKeys[0].SignPoseidon(msg).Compress()
+	_, err = va.VoteStatus(processID, votes[0].CensusProof.PublicKey, &sig,
+		timestamp)
+	c.Assert(err, qt.Equals, types.ErrInvalidVoteStatusSignature)
+
+	// the requests out of the VoteStatusRequestTTL are rejected
+	_, err = va.VoteStatus(processID, votes[0].CensusProof.PublicKey, &sig,
+		timestamp-3600)
+	c.Assert(errors.Is(err, ErrVoteStatusRequestExpired), qt.IsTrue)
+	_, err = va.VoteStatus(processID, votes[0].CensusProof.PublicKey, &sig,
+		timestamp+3600)
+	c.Assert(errors.Is(err, ErrVoteStatusRequestExpired), qt.IsTrue)
+}
+
+func TestEndToEndProof(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+
+	// an unreachable prover and a working one, with some latency
+	down := provertest.NewMockProver(c, va.circuit.NMaxVotes, va.circuit.NLevels)
+	down.SetUnavailable(true)
+	mock := provertest.NewMockProver(c, va.circuit.NMaxVotes, va.circuit.NLevels)
+	mock.SetLatency(100 * time.Millisecond)
+	va.provers = prover.NewPool(prover.NewClient(down.URL()),
+		prover.NewClient(mock.URL()))
+	var err error
+	va.verificationKey, err = prover.ParseVerificationKey(mock.VerificationKey)
+	c.Assert(err, qt.IsNil)
+	va.retryBackoff = 0
+
+	// votes are submitted while the process is On
+	for i := 0; i < 6; i++ {
+		err := va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+	err = va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	checkStatus := func(status types.ProcessStatus) {
+		process, err := va.db.ReadProcessByID(processID)
+		c.Assert(err, qt.IsNil)
+		c.Assert(process.Status, qt.Equals, status)
+	}
+
+	// the first attempt fails in the prover, and is retried once expired
+	mock.FailNext(1)
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusProofGenerating)
+	time.Sleep(200 * time.Millisecond)
+	_, err = va.GetProof(processID)
+	c.Assert(err, qt.ErrorMatches, "proof generation failed.*")
+	va.proofTimeout = time.Nanosecond
+	err = va.checkProofGeneration(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusFrozen)
+	va.proofTimeout = time.Hour
+
+	// the second attempt succeeds, after the prover latency
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+	_, err = va.GetProof(processID)
+	c.Assert(err, qt.ErrorMatches, "proof not ready.*")
+	time.Sleep(200 * time.Millisecond)
+	err = va.checkProofGeneration(processID)
+	c.Assert(err, qt.IsNil)
+	checkStatus(types.ProcessStatusProofGenerated)
+
+	proof, err := va.GetProof(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Prover, qt.Equals, mock.URL())
+	c.Assert(proof.ProofID, qt.Equals, uint64(2))
+	c.Assert(proof.Error, qt.Equals, "")
+	publicInputs, err := types.ParsePublicInputs(proof.PublicInputs)
+	c.Assert(err, qt.IsNil)
+	c.Assert(publicInputs[4].Int64(), qt.Equals, int64(6)) // nVotes
+	// once stored, the proof has been released in the prover
+	_, _, err = prover.NewClient(mock.URL()).GetProof(proof.ProofID)
+	c.Assert(err, qt.ErrorMatches, "proof files removed.*")
+
+	attempts, err := va.db.GetProofsByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(attempts), qt.Equals, 2)
+	c.Assert(attempts[1].Error, qt.Equals, ErrProofTimeout.Error())
+}
+
+func TestCancelClosedProofs(t *testing.T) {
+	c := qt.New(t)
+
+	nVotes := 10
+	chainID := uint64(3)
+	processID := uint64(123)
+	va, votes := baseTestVotesAggregator(c, chainID, processID, nVotes, 60)
+
+	mock := provertest.NewMockProver(c, va.circuit.NMaxVotes, va.circuit.NLevels)
+	mock.SetLatency(time.Hour)
+	proverClient := prover.NewClient(mock.URL())
+	va.provers = prover.NewPool(proverClient)
+
+	for i := 0; i < 6; i++ {
+		err := va.AddVote(processID, votes[i])
+		c.Assert(err, qt.IsNil)
+	}
+	err := va.db.InitMeta(chainID, 20)
+	c.Assert(err, qt.IsNil)
+	err = va.db.FrozeProcessesByCurrentBlockNum(20)
+	c.Assert(err, qt.IsNil)
+
+	err = va.GenerateProof(processID)
+	c.Assert(err, qt.IsNil)
+
+	// nothing to cancel while the process is not closed
+	err = va.cancelClosedProofs()
+	c.Assert(err, qt.IsNil)
+	proof, err := va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Error, qt.Equals, "")
+
+	// the process is closed in the contract before the proof is generated
+	err = va.db.CloseProcess(processID)
+	c.Assert(err, qt.IsNil)
+	err = va.cancelClosedProofs()
+	c.Assert(err, qt.IsNil)
+
+	proof, err = va.db.GetProofByProcessID(processID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(proof.Error, qt.Equals, prover.ErrProofCancelled.Error())
+	// the job has been cancelled in the prover
+	err = proverClient.Cancel(proof.ProofID)
+	c.Assert(err, qt.ErrorMatches, "job can not be cancelled.*")
+
+	pending, err := va.db.GetPendingProofsByProcessStatus(
+		types.ProcessStatusClosed)
+	c.Assert(err, qt.IsNil)
+	c.Assert(len(pending), qt.Equals, 0)
+}